@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"gorm.io/gorm"
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+	// dummyHash is checked for unknown usernames, so that they take
+	// as long as wrong passwords.
+	dummyHash, _ = auth.HashPassword("dummy password")
+)
+
+type AccountForm struct {
+	Username string
+	Name     string
+	Email    string
+	Error    string
+}
+
+func (ctr *Controller) renderAccountForm(c echo.Context, status int, name string, form AccountForm) error {
+	data := struct {
+		Form AccountForm
+		Page
+	}{
+		Form: form,
+		Page: ctr.Page(c),
+	}
+	return c.Render(status, name, data)
+}
+
+func (ctr *Controller) LoginForm(c echo.Context) error {
+	return ctr.renderAccountForm(c, http.StatusOK, "login", AccountForm{})
+}
+
+func (ctr *Controller) RegisterForm(c echo.Context) error {
+	return ctr.renderAccountForm(c, http.StatusOK, "register", AccountForm{})
+}
+
+func (ctr *Controller) Register(c echo.Context) error {
+	form := AccountForm{
+		Username: strings.TrimSpace(c.FormValue("username")),
+		Name:     strings.TrimSpace(c.FormValue("name")),
+		Email:    strings.TrimSpace(c.FormValue("email")),
+	}
+	password := c.FormValue("password")
+	if err := ctr.validateAccount(form, password, c.FormValue("confirm")); err != nil {
+		form.Error = err.Error()
+		return ctr.renderAccountForm(c, http.StatusBadRequest, "register", form)
+	}
+	if _, err := ctr.DB.GetCredential(form.Username); err == nil {
+		form.Error = "this username is taken"
+		return ctr.renderAccountForm(c, http.StatusBadRequest, "register", form)
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	user := &models.User{
+		Email: form.Email,
+		Name:  form.Name,
+	}
+	if err := ctr.DB.CreateAccount(user, &models.Credential{
+		Username: form.Username,
+		Hash:     hash,
+	}); err != nil {
+		// another sign up may have taken the username since the check
+		if _, err := ctr.DB.GetCredential(form.Username); err == nil {
+			form.Error = "this username is taken"
+			return ctr.renderAccountForm(c, http.StatusBadRequest, "register", form)
+		}
+		return fmt.Errorf("could not save account: %w", err)
+	}
+	if err := ctr.SignIn(c, user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+func (ctr *Controller) validateAccount(form AccountForm, password string, confirm string) error {
+	if form.Name == "" || !strings.Contains(form.Email, "@") {
+		return fmt.Errorf("name and a valid email are required")
+	}
+	return ctr.validatePassword(form, password, confirm)
+}
+
+func (ctr *Controller) validatePassword(form AccountForm, password string, confirm string) error {
+	if !usernamePattern.MatchString(form.Username) {
+		return fmt.Errorf("username has to be 3-32 letters, digits or ._-")
+	}
+	if password != confirm {
+		return fmt.Errorf("passwords do not match")
+	}
+	return auth.CheckPasswordStrength(password, form.Username, form.Name, form.Email)
+}
+
+func (ctr *Controller) PasswordLogin(c echo.Context) error {
+	form := AccountForm{
+		Username: strings.TrimSpace(c.FormValue("username")),
+	}
+	user, err := ctr.CheckCredential(form.Username, c.FormValue("password"))
+	if err != nil {
+		form.Error = err.Error()
+		return ctr.renderAccountForm(c, http.StatusUnauthorized, "login", form)
+	}
+	return ctr.StartSignIn(c, user)
+}
+
+// CheckCredential verifies the password of a local account. After
+// auth.MaxFailedLogins attempts without the right password the account
+// is locked for auth.LockoutDuration. Locked accounts fail like wrong
+// passwords, so that they do not tell which usernames exist.
+func (ctr *Controller) CheckCredential(username string, password string) (*models.User, error) {
+	errInvalid := errors.New("wrong username or password")
+	credential, err := ctr.DB.GetCredential(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auth.CheckPassword(dummyHash, password)
+		return nil, errInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting credential: %w", err)
+	}
+	userid := strconv.Itoa(credential.UserID)
+	allowed, err := ctr.DB.CountLoginAttempt(userid, auth.MaxFailedLogins, auth.LockoutDuration)
+	if err != nil {
+		return nil, fmt.Errorf("could not count login attempt: %w", err)
+	}
+	if !allowed {
+		auth.CheckPassword(dummyHash, password)
+		return nil, errInvalid
+	}
+	ok, err := auth.CheckPassword(credential.Hash, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalid
+	}
+	if err := ctr.DB.ResetLoginAttempts(userid); err != nil {
+		return nil, fmt.Errorf("could not reset login attempts: %w", err)
+	}
+	return credential.User, nil
+}
+
+func (ctr *Controller) renderPasswordForm(c echo.Context, status int, hasPassword bool, form AccountForm) error {
+	data := struct {
+		Form        AccountForm
+		HasPassword bool
+		Done        bool
+		Page
+	}{
+		Form:        form,
+		HasPassword: hasPassword,
+		Done:        status == http.StatusOK && c.Request().Method == http.MethodPost,
+		Page:        ctr.Page(c),
+	}
+	return c.Render(status, "password", data)
+}
+
+func (ctr *Controller) PasswordForm(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	_, err := ctr.DB.GetCredentialUserID(strconv.Itoa(user.ID))
+	return ctr.renderPasswordForm(c, http.StatusOK, err == nil, AccountForm{})
+}
+
+// ChangePassword changes the password of a local account, or adds one
+// to an account which only used login providers so far.
+func (ctr *Controller) ChangePassword(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	credential, err := ctr.DB.GetCredentialUserID(strconv.Itoa(user.ID))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("error getting credential: %w", err)
+	}
+	hasPassword := credential != nil
+	form := AccountForm{
+		Username: strings.TrimSpace(c.FormValue("username")),
+		Name:     user.Name,
+		Email:    user.Email,
+	}
+	fail := func(message string) error {
+		form.Error = message
+		return ctr.renderPasswordForm(c, http.StatusBadRequest, hasPassword, form)
+	}
+	password := c.FormValue("password")
+	if hasPassword {
+		form.Username = credential.Username
+		if _, err := ctr.CheckCredential(credential.Username, c.FormValue("current")); err != nil {
+			return fail(err.Error())
+		}
+	} else if _, err := ctr.DB.GetCredential(form.Username); err == nil {
+		return fail("this username is taken")
+	}
+	if err := ctr.validatePassword(form, password, c.FormValue("confirm")); err != nil {
+		return fail(err.Error())
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if hasPassword {
+		credential.Hash = hash
+		credential.FailedAttempts = 0
+		err = ctr.DB.UpdateCredential(credential)
+	} else {
+		err = ctr.DB.SaveCredential(&models.Credential{
+			UserID:   user.ID,
+			Username: form.Username,
+			Hash:     hash,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("could not save password: %w", err)
+	}
+	return ctr.renderPasswordForm(c, http.StatusOK, true, AccountForm{})
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/blob"
+	"github.com/vestlog/nix/pkg/media"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/storage"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFileSize     = errors.New("file is too large")
+	ErrTooManyFiles = errors.New("too many files")
+)
+
+// MaxFileName is the length limit of names of uploaded files.
+const MaxFileName = 200
+
+// FileMaxAge is how long browsers use files of published posts without
+// asking again.
+var FileMaxAge = 5 * time.Minute
+
+// upload is a file of the post form whose size and type are checked.
+type upload struct {
+	header      *multipart.FileHeader
+	name        string
+	contentType string
+}
+
+// parseUploads checks the files of the post form, so that the post is
+// not saved if one of them is rejected.
+func (ctr *Controller) parseUploads(c echo.Context) ([]upload, error) {
+	form, err := c.MultipartForm()
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	headers := form.File["attachments"]
+	if len(headers) > ctr.MaxUploadFiles {
+		return nil, fmt.Errorf("%w, at most %d at once", ErrTooManyFiles, ctr.MaxUploadFiles)
+	}
+	uploads := make([]upload, 0, len(headers))
+	for _, header := range headers {
+		name := fileName(header.Filename)
+		if header.Size > ctr.MaxUploadSize {
+			return nil, fmt.Errorf("%s: %w, at most %s", name, ErrFileSize, FileSize(ctr.MaxUploadSize))
+		}
+		head, err := readHead(header)
+		if err != nil {
+			return nil, err
+		}
+		contentType, err := media.Sniff(head)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		uploads = append(uploads, upload{header: header, name: name, contentType: contentType})
+	}
+	return uploads, nil
+}
+
+func readHead(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening upload: %w", err)
+	}
+	defer file.Close()
+	head := make([]byte, media.SniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading upload: %w", err)
+	}
+	return head[:n], nil
+}
+
+// fileName strips the directories and control characters browsers may
+// send with the name of a file.
+func fileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if runes := []rune(name); len(runes) > MaxFileName {
+		name = string(runes[len(runes)-MaxFileName:])
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// saveUploads stores the files checked by parseUploads as attachments
+// of post.
+func (ctr *Controller) saveUploads(post *models.Post, user *models.User, uploads []upload) error {
+	for _, u := range uploads {
+		attachment := &models.Attachment{
+			PostID:      &post.ID,
+			Name:        u.name,
+			ContentType: u.contentType,
+			Size:        u.header.Size,
+		}
+		if user.ID != 0 {
+			attachment.UserID = &user.ID
+		}
+		if err := ctr.storeUpload(attachment, u.header); err != nil {
+			return err
+		}
+		if err := ctr.DB.SaveAttachment(attachment); err != nil {
+			ctr.deleteBlobs(attachment)
+			return fmt.Errorf("error saving attachment: %w", err)
+		}
+	}
+	return nil
+}
+
+// storeUpload puts the file and the thumbnail of an image into the blob
+// store. Images without thumbnails, like WebP or huge ones, are shown
+// as they are.
+func (ctr *Controller) storeUpload(attachment *models.Attachment, header *multipart.FileHeader) error {
+	key, err := blob.NewKey()
+	if err != nil {
+		return err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("error opening upload: %w", err)
+	}
+	defer file.Close()
+	if err := ctr.Blobs.Put(key, file); err != nil {
+		return err
+	}
+	attachment.Key = key
+	if !media.IsImage(attachment.ContentType) {
+		return nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading upload: %w", err)
+	}
+	thumb, err := media.Thumbnail(file, ctr.ThumbnailSize)
+	if err != nil {
+		log.Printf("no thumbnail of %s: %v", attachment.Name, err)
+		return nil
+	}
+	if err := ctr.Blobs.Put(key+"-thumb", bytes.NewReader(thumb.Data)); err != nil {
+		ctr.deleteBlobs(attachment)
+		return err
+	}
+	attachment.ThumbKey = key + "-thumb"
+	attachment.Width = thumb.Width
+	attachment.Height = thumb.Height
+	return nil
+}
+
+func (ctr *Controller) deleteBlobs(attachment *models.Attachment) {
+	if err := deleteBlobs(ctr.Blobs, attachment); err != nil {
+		log.Print(err)
+	}
+}
+
+func deleteBlobs(blobs blob.Store, attachment *models.Attachment) error {
+	for _, key := range []string{attachment.Key, attachment.ThumbKey} {
+		if key == "" {
+			continue
+		}
+		if err := blobs.Delete(key); err != nil {
+			return fmt.Errorf("error deleting blob of attachment %d: %w", attachment.ID, err)
+		}
+	}
+	return nil
+}
+
+// DeleteDetachedAttachments deletes the blobs of attachments which were
+// removed from their posts or whose posts are deleted permanently, and
+// then the attachments, and returns how many.
+func DeleteDetachedAttachments(db storage.Database, blobs blob.Store) (int, error) {
+	attachments, err := db.GetDetachedAttachments()
+	if err != nil {
+		return 0, fmt.Errorf("error getting detached attachments: %w", err)
+	}
+	deleted := 0
+	for i := range attachments {
+		if err := deleteBlobs(blobs, &attachments[i]); err != nil {
+			return deleted, err
+		}
+		if err := db.DeleteAttachment(attachments[i].ID); err != nil {
+			return deleted, fmt.Errorf("error deleting attachment: %w", err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// removeAttachments detaches the attachments checked for removal on the
+// post form and deletes them.
+func (ctr *Controller) removeAttachments(post *models.Post, values []string) error {
+	ids := make([]int, 0, len(values))
+	for _, value := range values {
+		if id, err := strconv.Atoi(value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	n, err := ctr.DB.DetachAttachments(strconv.Itoa(post.ID), ids)
+	if err != nil {
+		return fmt.Errorf("error removing attachments: %w", err)
+	}
+	if n > 0 {
+		if _, err := DeleteDetachedAttachments(ctr.DB, ctr.Blobs); err != nil {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// attachment returns the attachment of the request with its post, if
+// the signed in user may see the post.
+func (ctr *Controller) attachment(c echo.Context) (*models.Attachment, *models.Post, error) {
+	attachment, err := ctr.DB.GetAttachment(c.Param("attachmentid"))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && attachment.PostID == nil) {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting attachment: %w", err)
+	}
+	post, _, err := ctr.viewablePost(c, func() (*models.Post, error) {
+		return ctr.DB.GetPost(strconv.Itoa(*attachment.PostID))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, post, nil
+}
+
+// GetAttachment serves an uploaded file. Images and PDF files are shown
+// in the browser, other files are downloaded.
+func (ctr *Controller) GetAttachment(c echo.Context) error {
+	attachment, post, err := ctr.attachment(c)
+	if err != nil {
+		return err
+	}
+	disposition := "attachment"
+	if media.Inline(attachment.ContentType) {
+		disposition = "inline"
+	}
+	c.Response().Header().Set(echo.HeaderContentType, attachment.ContentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	return ctr.serveBlob(c, post, attachment, attachment.Key, attachment.Name)
+}
+
+// GetThumbnail serves the thumbnail of an image.
+func (ctr *Controller) GetThumbnail(c echo.Context) error {
+	attachment, post, err := ctr.attachment(c)
+	if err != nil {
+		return err
+	}
+	if attachment.ThumbKey == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "thumbnail not found")
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, "inline")
+	return ctr.serveBlob(c, post, attachment, attachment.ThumbKey, "")
+}
+
+// serveBlob writes the blob under key with conditional and range
+// requests handled. Files are only cached by browsers, as they have to
+// disappear with their posts: files of published posts for
+// FileMaxAge, files of other posts are revalidated with their ETag
+// every time.
+func (ctr *Controller) serveBlob(c echo.Context, post *models.Post, attachment *models.Attachment, key string, name string) error {
+	file, err := ctr.Blobs.Open(key)
+	if errors.Is(err, blob.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	if err != nil {
+		return fmt.Errorf("error opening attachment: %w", err)
+	}
+	defer file.Close()
+	header := c.Response().Header()
+	if post.Published() {
+		header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(FileMaxAge.Seconds())))
+	} else {
+		header.Set("Cache-Control", "private, no-cache")
+	}
+	header.Set("ETag", `"`+key+`"`)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	http.ServeContent(c.Response(), c.Request(), name, attachment.CreatedAt, file)
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/moderation"
+	"github.com/vestlog/nix/pkg/sessions"
+)
+
+func commentOwner(comment *models.Comment) int {
+	if comment.UserID == nil {
+		return 0
+	}
+	return *comment.UserID
+}
+
+// CanEditComment reports whether user may edit comment: its author
+// within EditWindow after posting, users who edit any comment always.
+func (ctr *Controller) CanEditComment(user *models.User, comment *models.Comment, now time.Time) bool {
+	return auth.CanModifyWithin(ctr.Role(user), user.ID, commentOwner(comment),
+		auth.PermEditOwnComment, auth.PermEditAnyComment, comment.CreatedAt, now, ctr.EditWindow)
+}
+
+func (ctr *Controller) CanDeleteComment(user *models.User, comment *models.Comment) bool {
+	return auth.CanModify(ctr.Role(user), user.ID, commentOwner(comment),
+		auth.PermDeleteOwnComment, auth.PermDeleteAnyComment)
+}
+
+// commentPerms tells the post page which comments the user may change.
+type commentPerms struct {
+	ctr  *Controller
+	user *models.User
+	now  time.Time
+}
+
+func (p commentPerms) CanEdit(comment *models.CommentNode) bool {
+	return p.user.ID != 0 && p.ctr.CanEditComment(p.user, &comment.Comment, p.now)
+}
+
+func (p commentPerms) CanDelete(comment *models.CommentNode) bool {
+	return p.user.ID != 0 && p.ctr.CanDeleteComment(p.user, &comment.Comment)
+}
+
+func (ctr *Controller) editableComment(c echo.Context) (*models.Comment, error) {
+	comment, err := ctr.DB.GetComment(c.Param("commentid"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "comment not found")
+	}
+	if !ctr.CanEditComment(ctr.ContextUser(c), comment, time.Now()) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "FORBIDDEN")
+	}
+	return comment, nil
+}
+
+func (ctr *Controller) deletableComment(c echo.Context) (*models.Comment, error) {
+	comment, err := ctr.DB.GetComment(c.Param("commentid"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "comment not found")
+	}
+	if !ctr.CanDeleteComment(ctr.ContextUser(c), comment) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "FORBIDDEN")
+	}
+	return comment, nil
+}
+
+func (ctr *Controller) EditCommentForm(c echo.Context) error {
+	comment, err := ctr.editableComment(c)
+	if err != nil {
+		return err
+	}
+	if form := ctr.TakeForm(c); form != nil {
+		comment.Body = form.Get("body")
+	}
+	data := struct {
+		Action  string
+		Cancel  string
+		Comment *models.Comment
+		Page
+	}{
+		Action:  fmt.Sprintf("/admin/comments/%d/edit", comment.ID),
+		Cancel:  ctr.postPath(comment.PostID) + fmt.Sprintf("#comment-%d", comment.ID),
+		Comment: comment,
+		Page:    ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "commentform", data)
+}
+
+func (ctr *Controller) EditComment(c echo.Context) error {
+	comment, err := ctr.editableComment(c)
+	if err != nil {
+		return err
+	}
+	body := c.FormValue("body")
+	if body == "" {
+		return ctr.FormError(c, fmt.Sprintf("/admin/comments/%d/edit", comment.ID),
+			"Comment cannot be empty.")
+	}
+	user := ctr.ContextUser(c)
+	forget := moderation.Tokenize(comment.Body)
+	if err := ctr.Filters.Edit(comment, body, ctr.Moderation.Trusted(ctr.Role(user)), time.Now()); err != nil {
+		return fmt.Errorf("error filtering comment: %w", err)
+	}
+	if err := ctr.DB.UpdateComment(comment, forget); err != nil {
+		return fmt.Errorf("could not update comment: %w", err)
+	}
+	if comment.Status != models.CommentApproved {
+		ctr.Flash(c, sessions.FlashInfo, "Comment is waiting for approval by a moderator.")
+		return c.Redirect(http.StatusFound, ctr.postPath(comment.PostID))
+	}
+	ctr.Flash(c, sessions.FlashSuccess, "Comment is updated.")
+	return c.Redirect(http.StatusFound, ctr.postPath(comment.PostID)+fmt.Sprintf("#comment-%d", comment.ID))
+}
+
+func (ctr *Controller) DeleteCommentForm(c echo.Context) error {
+	comment, err := ctr.deletableComment(c)
+	if err != nil {
+		return err
+	}
+	return ctr.RenderConfirm(c, "Delete comment",
+		"Do you want to move this comment and its replies to the trash?",
+		fmt.Sprintf("/admin/comments/%d/delete", comment.ID),
+		ctr.postPath(comment.PostID)+fmt.Sprintf("#comment-%d", comment.ID))
+}
+
+func (ctr *Controller) DeleteComment(c echo.Context) error {
+	comment, err := ctr.deletableComment(c)
+	if err != nil {
+		return err
+	}
+	if err := ctr.DB.DeleteComment(strconv.Itoa(comment.ID)); err != nil {
+		return fmt.Errorf("could not delete comment: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, "Comment is moved to the trash.")
+	return c.Redirect(http.StatusFound, ctr.postPath(comment.PostID))
+}
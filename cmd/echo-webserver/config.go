@@ -2,21 +2,246 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/blob"
+	"github.com/vestlog/nix/pkg/moderation"
+	"github.com/vestlog/nix/pkg/sessions"
 )
 
-type Provider struct {
-	ClientID     string
-	ClientSecret string
+type Configuration struct {
+	Providers []auth.ProviderConfig
+	BaseURL   string
+	// Deprecated: SessionsKey is used as the only hash key if
+	// Session.Keys is empty.
+	SessionsKey string
+	Session     SessionConfig
+	DSN         string
+	Port        string
+	// DefaultRole is the role of users without an assigned one.
+	DefaultRole string
+	// TOTPIssuer names the site in authenticator apps.
+	TOTPIssuer string
+	// Require2FA lists roles which have to use a second factor,
+	// admin if not set.
+	Require2FA []string
+	// CommentDepth is the number of levels of comment threads shown,
+	// 5 if not set.
+	CommentDepth int
+	// CommentEditWindow is how long authors may edit their comments,
+	// 15m if not set, 0 for always.
+	CommentEditWindow string
+	Moderation        ModerationConfig
+	// PublishInterval is how often scheduled posts are published,
+	// 1m if not set.
+	PublishInterval string
+	// TrashRetention is how long deleted posts and comments are kept
+	// before they are deleted permanently, 720h if not set, 0 for ever.
+	TrashRetention string
+	Attachments    AttachmentConfig
+	// TrustedProxies lists addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header names the client. Without them the
+	// address of the connection is the client.
+	TrustedProxies []string
 }
 
-type Configuration struct {
-	GoogleOAuth   Provider
-	FacebookOAuth Provider
-	SessionsKey   string
-	DSN           string
-	Port          string
+// IPExtractor returns how the client address of requests is found.
+func (conf *Configuration) IPExtractor() (echo.IPExtractor, error) {
+	if len(conf.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range conf.TrustedProxies {
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid trusted proxy %q: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// AttachmentConfig configures files uploaded to posts.
+type AttachmentConfig struct {
+	// Store is the kind of blob store, "fs" if not set, and Location
+	// its directory, "uploads" if not set.
+	Store    string
+	Location string
+	// MaxSize is the size limit of a file in bytes, 10 MiB if not set.
+	MaxSize int64
+	// MaxFiles is how many files may be uploaded at once, 10 if not set.
+	MaxFiles int
+	// ThumbnailSize is the width and height thumbnails of images fit
+	// into, 320 if not set.
+	ThumbnailSize int
+}
+
+func (ac *AttachmentConfig) setDefaults() {
+	if ac.Store == "" {
+		ac.Store = blob.KindFS
+	}
+	if ac.Location == "" {
+		ac.Location = "uploads"
+	}
+	if ac.MaxSize <= 0 {
+		ac.MaxSize = 10 << 20
+	}
+	if ac.MaxFiles <= 0 {
+		ac.MaxFiles = 10
+	}
+	if ac.ThumbnailSize <= 0 {
+		ac.ThumbnailSize = 320
+	}
+}
+
+// BodyLimit is the size limit of requests, which allows for MaxFiles
+// files and the other fields of the post form.
+func (ac *AttachmentConfig) BodyLimit() string {
+	return fmt.Sprintf("%dK", (ac.MaxSize*int64(ac.MaxFiles)+1<<20)/1024)
+}
+
+// ModerationConfig is the policy for new comments, see
+// moderation.Policy. Editors and admins are trusted and first comments
+// are held if not set.
+type ModerationConfig struct {
+	TrustedRoles []string
+	HoldFirst    *bool
+	HoldAll      bool
+	Filters      moderation.FilterConfig
+}
+
+func (m ModerationConfig) Policy() moderation.Policy {
+	policy := moderation.Policy{
+		TrustedRoles: m.TrustedRoles,
+		HoldFirst:    moderation.DefaultPolicy.HoldFirst,
+		HoldAll:      m.HoldAll,
+	}
+	if policy.TrustedRoles == nil {
+		policy.TrustedRoles = moderation.DefaultPolicy.TrustedRoles
+	}
+	if m.HoldFirst != nil {
+		policy.HoldFirst = *m.HoldFirst
+	}
+	return policy
+}
+
+// SessionKey is a pair of keys for session cookies. Hash signs the
+// cookie, the optional Block of 16, 24 or 32 bytes encrypts it.
+type SessionKey struct {
+	Hash  string
+	Block string
+}
+
+// SessionConfig configures the session cookie and session lifetimes.
+// Durations are strings like "30m" or "720h".
+type SessionConfig struct {
+	// Keys sign and encrypt cookies. The first pair is used for new
+	// cookies, the others are still accepted, so a new key is added
+	// in front and the old one removed after AbsoluteTimeout.
+	Keys       []SessionKey
+	CookieName string
+	Domain     string
+	Path       string
+	// Secure defaults to true if BaseURL is https.
+	Secure *bool
+	// SameSite is "lax" (default), "strict" or "none".
+	SameSite        string
+	IdleTimeout     string
+	AbsoluteTimeout string
+}
+
+// KeyPairs returns the keys in the order sessions.NewCookieStore expects.
+func (sc *SessionConfig) KeyPairs() [][]byte {
+	pairs := make([][]byte, 0, 2*len(sc.Keys))
+	for _, key := range sc.Keys {
+		var block []byte
+		if key.Block != "" {
+			block = []byte(key.Block)
+		}
+		pairs = append(pairs, []byte(key.Hash), block)
+	}
+	return pairs
+}
+
+// Apply sets cookie options and timeouts of store.
+func (sc *SessionConfig) Apply(store *sessions.DBStore) error {
+	for i, key := range sc.Keys {
+		if key.Hash == "" {
+			return fmt.Errorf("error: session key %d has no Hash", i)
+		}
+		if n := len(key.Block); n != 0 && n != 16 && n != 24 && n != 32 {
+			return fmt.Errorf("error: Block of session key %d has to be 16, 24 or 32 bytes", i)
+		}
+	}
+	store.Options.Domain = sc.Domain
+	store.Options.Path = sc.Path
+	store.Options.Secure = *sc.Secure
+	switch strings.ToLower(sc.SameSite) {
+	case "lax":
+		store.Options.SameSite = http.SameSiteLaxMode
+	case "strict":
+		store.Options.SameSite = http.SameSiteStrictMode
+	case "none":
+		store.Options.SameSite = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("error: unknown SameSite %q", sc.SameSite)
+	}
+	absolute, err := time.ParseDuration(sc.AbsoluteTimeout)
+	if err != nil || absolute <= 0 {
+		return fmt.Errorf("error: invalid AbsoluteTimeout %q", sc.AbsoluteTimeout)
+	}
+	store.MaxAge(int(absolute.Seconds()))
+	if sc.IdleTimeout != "" {
+		if store.IdleTimeout, err = time.ParseDuration(sc.IdleTimeout); err != nil {
+			return fmt.Errorf("error: invalid IdleTimeout %q: %w", sc.IdleTimeout, err)
+		}
+	}
+	return nil
+}
+
+func (sc *SessionConfig) setDefaults(baseURL string, legacyKey string) {
+	if len(sc.Keys) == 0 && legacyKey != "" {
+		sc.Keys = []SessionKey{{Hash: legacyKey}}
+	}
+	if sc.CookieName == "" {
+		sc.CookieName = "session"
+	}
+	if sc.Path == "" {
+		sc.Path = "/"
+	}
+	if sc.Secure == nil {
+		secure := strings.HasPrefix(baseURL, "https://")
+		sc.Secure = &secure
+	}
+	if sc.SameSite == "" {
+		sc.SameSite = "lax"
+	}
+	if sc.AbsoluteTimeout == "" {
+		sc.AbsoluteTimeout = "720h"
+	}
+	if sc.IdleTimeout == "" {
+		sc.IdleTimeout = "168h"
+	}
 }
 
 var (
@@ -32,4 +257,33 @@ func LoadConfig(filename string) {
 	if err := json.NewDecoder(file).Decode(GlobalConfig); err != nil {
 		log.Fatal(err)
 	}
+	if GlobalConfig.DefaultRole == "" {
+		GlobalConfig.DefaultRole = auth.RoleAuthor
+	}
+	if GlobalConfig.CommentEditWindow == "" {
+		GlobalConfig.CommentEditWindow = "15m"
+	}
+	if GlobalConfig.TrashRetention == "" {
+		GlobalConfig.TrashRetention = "720h"
+	}
+	if GlobalConfig.PublishInterval == "" {
+		GlobalConfig.PublishInterval = PublishInterval.String()
+	}
+	if GlobalConfig.CommentDepth <= 0 {
+		GlobalConfig.CommentDepth = 5
+	}
+	if GlobalConfig.TOTPIssuer == "" {
+		GlobalConfig.TOTPIssuer = "nix"
+	}
+	if GlobalConfig.Require2FA == nil {
+		GlobalConfig.Require2FA = []string{auth.RoleAdmin}
+	}
+	if GlobalConfig.BaseURL == "" {
+		GlobalConfig.BaseURL = "http://localhost:" + GlobalConfig.Port
+	}
+	GlobalConfig.Attachments.setDefaults()
+	GlobalConfig.Session.setDefaults(GlobalConfig.BaseURL, GlobalConfig.SessionsKey)
+	if len(GlobalConfig.Session.Keys) == 0 {
+		log.Fatal("error: no session keys configured")
+	}
 }
@@ -1,28 +1,60 @@
 package main
 
 import (
+	"context"
+	"encoding/gob"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/blob"
+	"github.com/vestlog/nix/pkg/markdown"
 	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/moderation"
 	"github.com/vestlog/nix/pkg/sessions"
 	"github.com/vestlog/nix/pkg/storage"
+	"gorm.io/gorm"
 )
 
 var (
-	StoreName   = "sessionid"
-	StateLength = 32
+	StoreName  = "sessionid"
+	FlowsField = "oauthflows"
+	MaxFlows   = 5
 )
 
 type Controller struct {
-	DB           *storage.GormDatabase
-	Store        *sessions.SessionStore
-	GoogleAuth   *auth.OAuth
-	FacebookAuth *auth.OAuth
-	UserField    string
+	DB          *storage.GormDatabase
+	Store       *sessions.SessionStore
+	Auth        *auth.Registry
+	UserField   string
+	DefaultRole string
+	TOTPIssuer  string
+	// Require2FA lists roles which have to use a second factor.
+	Require2FA []string
+	// CommentDepth is the number of levels of comment threads shown.
+	CommentDepth int
+	Moderation   moderation.Policy
+	Filters      *moderation.Pipeline
+	// EditWindow is how long authors may edit their comments.
+	EditWindow time.Duration
+	// TrashRetention is how long deleted posts and comments are kept,
+	// 0 for ever.
+	TrashRetention time.Duration
+	// Blobs keeps the files uploaded to posts.
+	Blobs blob.Store
+	// MaxUploadSize and MaxUploadFiles limit the size of a file and the
+	// number of files uploaded at once.
+	MaxUploadSize  int64
+	MaxUploadFiles int
+	// ThumbnailSize is the width and height thumbnails of images fit
+	// into.
+	ThumbnailSize int
 }
 
 func (ctr *Controller) SessionMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
@@ -32,6 +64,114 @@ func (ctr *Controller) SessionMiddleware(next echo.HandlerFunc) echo.HandlerFunc
 	}
 }
 
+// CSRF rejects state-changing requests whose token does not match the
+// token of the session.
+func (ctr *Controller) CSRF(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if err := ctr.Store.CheckCSRF(c.Request()); err != nil {
+			return ctr.RenderError(c, http.StatusForbidden,
+				"The form has expired or was sent from another site. Go back, reload the page and try again.")
+		}
+		return next(c)
+	}
+}
+
+// Page returns the data every page needs.
+func (ctr *Controller) Page(c echo.Context) Page {
+	return Page{
+		IsSignedIn: ctr.IsSignedIn(c),
+		csrfToken: func() string {
+			token, err := ctr.Store.CSRFToken(c.Response(), c.Request())
+			if err != nil {
+				c.Logger().Error(err)
+			}
+			return token
+		},
+		flashes: func() []sessions.Flash {
+			flashes, err := ctr.Store.Flashes(c.Response(), c.Request())
+			if err != nil {
+				c.Logger().Error(err)
+			}
+			return flashes
+		},
+		role: func() string {
+			user, ok := ctr.CurrentUser(c)
+			if !ok {
+				return ""
+			}
+			return ctr.Role(user)
+		},
+	}
+}
+
+// Flash adds a message to the next rendered page.
+func (ctr *Controller) Flash(c echo.Context, kind string, message string) {
+	if err := ctr.Store.AddFlash(c.Response(), c.Request(), kind, message); err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// FormError redirects to url with message as an error and the submitted
+// values saved, so that the form there is filled in again.
+func (ctr *Controller) FormError(c echo.Context, url string, message string) error {
+	ctr.Flash(c, sessions.FlashError, message)
+	form, err := c.FormParams()
+	if err == nil {
+		delete(form, sessions.CSRFField)
+		if err := ctr.Store.SaveForm(c.Response(), c.Request(), form); err != nil {
+			c.Logger().Error(err)
+		}
+	}
+	return c.Redirect(http.StatusFound, url)
+}
+
+// TakeForm returns the values saved by FormError, or nil.
+func (ctr *Controller) TakeForm(c echo.Context) url.Values {
+	form, err := ctr.Store.TakeForm(c.Response(), c.Request())
+	if err != nil {
+		c.Logger().Error(err)
+	}
+	return form
+}
+
+// RenderError shows message on the error page.
+func (ctr *Controller) RenderError(c echo.Context, status int, message string) error {
+	data := struct {
+		Status  int
+		Title   string
+		Message string
+		Page
+	}{
+		Status:  status,
+		Title:   http.StatusText(status),
+		Message: message,
+		Page:    ctr.Page(c),
+	}
+	return c.Render(status, "error", data)
+}
+
+// RenderConfirm asks to confirm an action, which is POSTed to action.
+func (ctr *Controller) RenderConfirm(c echo.Context, title string, message string, action string, cancel string) error {
+	data := struct {
+		Title   string
+		Message string
+		Action  string
+		Cancel  string
+		Page
+	}{
+		Title:   title,
+		Message: message,
+		Action:  action,
+		Cancel:  cancel,
+		Page:    ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "confirm", data)
+}
+
 func (ctr *Controller) RestrictAccess(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if !ctr.IsSignedIn(c) {
@@ -41,69 +181,221 @@ func (ctr *Controller) RestrictAccess(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// Require allows only signed in users whose role grants all of perms.
+// The user is stored in the context under UserField.
+func (ctr *Controller) Require(perms ...auth.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := ctr.CurrentUser(c)
+			if !ok {
+				return echo.NewHTTPError(http.StatusForbidden, "FORBIDDEN")
+			}
+			if !auth.HasPermission(ctr.Role(user), perms...) {
+				return echo.NewHTTPError(http.StatusForbidden, "FORBIDDEN")
+			}
+			c.Set(ctr.UserField, user)
+			return next(c)
+		}
+	}
+}
+
+// Role returns the role of user, or DefaultRole if none is assigned.
+func (ctr *Controller) Role(user *models.User) string {
+	if user == nil {
+		return ""
+	}
+	if user.Role == "" {
+		return ctr.DefaultRole
+	}
+	return user.Role
+}
+
+// ContextUser returns the user stored by Require.
+func (ctr *Controller) ContextUser(c echo.Context) *models.User {
+	user, _ := c.Get(ctr.UserField).(*models.User)
+	return user
+}
+
 func (ctr *Controller) IsSignedIn(c echo.Context) bool {
-	user, err := ctr.Store.GetData(c.Request(), ctr.UserField)
-	if err != nil || user == nil {
+	userid, err := ctr.Store.GetData(c.Request(), ctr.UserField)
+	if err != nil {
 		return false
 	}
-	return true
+	_, ok := userid.(int)
+	return ok
 }
 
-func (ctr *Controller) GoogleLogin(c echo.Context) error {
-	return ctr.Login(c, ctr.GoogleAuth)
+// SignIn stores the ID of user in the session. The session gets a new
+// ID first, so an ID planted before sign in becomes useless.
+func (ctr *Controller) SignIn(c echo.Context, user *models.User) error {
+	if err := ctr.Store.Renew(c.Response(), c.Request()); err != nil {
+		return err
+	}
+	return ctr.Store.SaveData(c.Response(), c.Request(), ctr.UserField, user.ID)
 }
 
-func (ctr *Controller) FacebookLogin(c echo.Context) error {
-	return ctr.Login(c, ctr.FacebookAuth)
+func (ctr *Controller) Provider(c echo.Context) (*auth.OAuth, error) {
+	provider, ok := ctr.Auth.Get(c.Param("provider"))
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "unknown provider")
+	}
+	return provider, nil
 }
 
-func (ctr *Controller) Login(c echo.Context, auth *auth.OAuth) error {
-	state, _ := GenerateRandomString(StateLength)
-	if err := ctr.Store.SaveString(c.Response(), c.Request(), "state", state); err != nil {
+func (ctr *Controller) Login(c echo.Context) error {
+	provider, err := ctr.Provider(c)
+	if err != nil {
+		return err
+	}
+	link := c.QueryParam("link") != "" && ctr.IsSignedIn(c)
+	flow, err := auth.NewFlow(provider.Name, link)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := ctr.SaveFlow(c, flow); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-	url := auth.GetAuthURL(state)
+	url := provider.GetAuthURL(flow)
 	return c.Redirect(http.StatusFound, url)
 }
 
-func (ctr *Controller) GoogleCallback(c echo.Context) error {
-	return ctr.Callback(c, ctr.GoogleAuth)
+func (ctr *Controller) Callback(c echo.Context) error {
+	provider, err := ctr.Provider(c)
+	if err != nil {
+		return err
+	}
+	flow, err := ctr.TakeFlow(c, provider.Name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	userinfo, err := provider.GetUserInfo(c.Request().Context(), c.QueryParam("code"), flow)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if flow.Link {
+		return ctr.LinkIdentity(c, provider.Name, userinfo)
+	}
+	user, err := ctr.FindOrCreateUser(provider.Name, userinfo)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return ctr.StartSignIn(c, user)
 }
 
-func (ctr *Controller) FacebookCallback(c echo.Context) error {
-	return ctr.Callback(c, ctr.FacebookAuth)
+func (ctr *Controller) flows(c echo.Context) map[string]auth.Flow {
+	data, err := ctr.Store.GetData(c.Request(), FlowsField)
+	if flows, ok := data.(map[string]auth.Flow); err == nil && ok {
+		return flows
+	}
+	return make(map[string]auth.Flow)
 }
 
-func (ctr *Controller) Callback(c echo.Context, auth *auth.OAuth) error {
-	if err := ctr.OAuthCallbackStateOK(c); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
-	}
-	userinfo, err := auth.GetUserData(c.Request().Context(), c.QueryParam("code"))
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+// SaveFlow keeps the login flow in the session. Expired flows are
+// dropped and at most MaxFlows, the newest, are kept.
+func (ctr *Controller) SaveFlow(c echo.Context, flow *auth.Flow) error {
+	flows := ctr.flows(c)
+	for state, f := range flows {
+		if f.Expired() {
+			delete(flows, state)
+		}
 	}
-	user := &models.User{
-		Email: userinfo["email"].(string),
-		Name:  userinfo["name"].(string),
+	for len(flows) >= MaxFlows {
+		oldest := ""
+		for state, f := range flows {
+			if oldest == "" || f.Expires.Before(flows[oldest].Expires) {
+				oldest = state
+			}
+		}
+		delete(flows, oldest)
 	}
-	id, ok := userinfo["id"].(string)
+	flows[flow.State] = *flow
+	return ctr.Store.SaveData(c.Response(), c.Request(), FlowsField, flows)
+}
+
+// TakeFlow removes the flow matching the callback state from the session,
+// so every state can be used only once.
+func (ctr *Controller) TakeFlow(c echo.Context, provider string) (*auth.Flow, error) {
+	state := c.QueryParam("state")
+	flows := ctr.flows(c)
+	flow, ok := flows[state]
 	if !ok {
-		return echo.NewHTTPError(http.StatusInternalServerError, "id is not a string")
+		return nil, fmt.Errorf("state is not OK")
 	}
-	guser, err := ctr.DB.GetGoogleUser(id)
-	if err != nil {
-		guser = &models.GoogleUser{
-			ID:   id,
-			User: user,
+	delete(flows, state)
+	if err := ctr.Store.SaveData(c.Response(), c.Request(), FlowsField, flows); err != nil {
+		return nil, fmt.Errorf("error: could not save session: %w", err)
+	}
+	if flow.Expired() {
+		return nil, fmt.Errorf("login has expired, please try again")
+	}
+	if flow.Provider != provider {
+		return nil, fmt.Errorf("state belongs to another provider")
+	}
+	return &flow, nil
+}
+
+// FindOrCreateUser returns the user linked to the provider account.
+// Unknown accounts are linked to an existing user with the same verified
+// email, or get a new user.
+func (ctr *Controller) FindOrCreateUser(provider string, info *auth.UserInfo) (*models.User, error) {
+	identity, err := ctr.DB.GetIdentity(provider, info.ID)
+	if err == nil {
+		return identity.User, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("error getting identity: %w", err)
+	}
+	var user *models.User
+	if info.EmailVerified {
+		user, err = ctr.DB.GetUserEmail(info.Email)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("error getting user by email: %w", err)
 		}
-		if err := ctr.DB.SaveGoogleUser(guser); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		if user != nil && !user.EmailVerified {
+			user = nil
 		}
 	}
-	if err := ctr.Store.SaveData(c.Response(), c.Request(), ctr.UserField, guser.User); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if user == nil {
+		user = &models.User{
+			Email:         info.Email,
+			Name:          info.Name,
+			EmailVerified: info.EmailVerified,
+		}
+		if err := ctr.DB.SaveUser(user); err != nil {
+			return nil, fmt.Errorf("could not save user: %w", err)
+		}
 	}
-	return c.Redirect(http.StatusFound, "/")
+	if err := ctr.DB.SaveIdentity(&models.Identity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  info.ID,
+		Email:    info.Email,
+	}); err != nil {
+		return nil, fmt.Errorf("could not save identity: %w", err)
+	}
+	return user, nil
+}
+
+// CurrentUser loads the signed in user of the session from the database,
+// so changes of the user apply at once.
+func (ctr *Controller) CurrentUser(c echo.Context) (*models.User, bool) {
+	userid, err := ctr.Store.GetData(c.Request(), ctr.UserField)
+	if err != nil {
+		return nil, false
+	}
+	id, ok := userid.(int)
+	if !ok {
+		return nil, false
+	}
+	user, err := ctr.DB.GetUser(strconv.Itoa(id))
+	if err != nil {
+		return nil, false
+	}
+	return user, true
+}
+
+func (ctr *Controller) SignoutForm(c echo.Context) error {
+	return ctr.RenderConfirm(c, "Sign out", "Do you want to sign out?", "/admin/signout", "/")
 }
 
 func (ctr *Controller) Signout(c echo.Context) error {
@@ -113,70 +405,165 @@ func (ctr *Controller) Signout(c echo.Context) error {
 	return c.Redirect(http.StatusFound, "/")
 }
 
-func (ctr *Controller) OAuthCallbackStateOK(c echo.Context) error {
-	state, err := ctr.Store.GetString(c.Request(), "state")
+// modifiablePost loads the post of the request if the user in context
+// may change it with the own or any permission.
+func (ctr *Controller) modifiablePost(c echo.Context, own auth.Permission, any auth.Permission) (*models.Post, error) {
+	post, err := ctr.DB.GetPost(c.Param("postid"))
 	if err != nil {
-		return fmt.Errorf("error: could not get session field: %w", err)
+		return nil, echo.NewHTTPError(http.StatusNotFound, "post not found")
 	}
-	if state != c.QueryParam("state") {
-		return fmt.Errorf("state is not OK")
+	user := ctr.ContextUser(c)
+	if !auth.CanModify(ctr.Role(user), user.ID, post.UserID, own, any) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "FORBIDDEN")
 	}
-	return nil
+	return post, nil
+}
+
+func (ctr *Controller) DeletePostForm(c echo.Context) error {
+	post, err := ctr.modifiablePost(c, auth.PermDeleteOwnPost, auth.PermDeleteAnyPost)
+	if err != nil {
+		return err
+	}
+	return ctr.RenderConfirm(c, "Delete post",
+		fmt.Sprintf("Do you want to move %q and its comments to the trash?", post.Title),
+		fmt.Sprintf("/admin/%d/deletepost", post.ID),
+		post.Path())
 }
 
 func (ctr *Controller) DeletePost(c echo.Context) error {
-	if err := ctr.DB.DeletePost(c.Param("postid")); err != nil {
+	post, err := ctr.modifiablePost(c, auth.PermDeleteOwnPost, auth.PermDeleteAnyPost)
+	if err != nil {
+		return err
+	}
+	if err := ctr.DB.DeletePost(strconv.Itoa(post.ID)); err != nil {
 		return fmt.Errorf("could not delete post: %w", err)
 	}
+	ctr.Flash(c, sessions.FlashSuccess, fmt.Sprintf("Post %q is moved to the trash.", post.Title))
 	return c.Redirect(http.StatusFound, "/")
 }
 
 func (ctr *Controller) EditPostForm(c echo.Context) error {
-	postid := c.Param("postid")
-	post, err := ctr.DB.GetPost(postid)
+	post, err := ctr.modifiablePost(c, auth.PermEditOwnPost, auth.PermEditAnyPost)
 	if err != nil {
-		return fmt.Errorf("error getting post from database: %w", err)
-	}
-	data := struct {
-		Action     string
-		Post       *models.Post
-		IsSignedIn bool
-	}{
-		Action:     fmt.Sprintf("/%s/editpost", postid),
-		Post:       post,
-		IsSignedIn: ctr.IsSignedIn(c),
+		return err
 	}
-	return c.Render(http.StatusOK, "postform", data)
+	fillPost(post, ctr.TakeForm(c))
+	return ctr.renderPostForm(c, fmt.Sprintf("/admin/%d/editpost", post.ID), post)
 }
 
 func (ctr *Controller) EditPost(c echo.Context) error {
-	postidstr := c.Param("postid")
-	postid, err := strconv.Atoi(postidstr)
+	post, err := ctr.modifiablePost(c, auth.PermEditOwnPost, auth.PermEditAnyPost)
 	if err != nil {
-		return fmt.Errorf("post ID has to be an integer")
+		return err
 	}
-	post := &models.Post{
-		ID: postid,
-		// Title: html.EscapeString(c.FormValue("title")),
-		// Body:  html.EscapeString(c.FormValue("body")),
-		Title: c.FormValue("title"),
-		Body:  c.FormValue("body"),
+	// post.Title = html.EscapeString(c.FormValue("title"))
+	// post.Body = html.EscapeString(c.FormValue("body"))
+	post.Title = c.FormValue("title")
+	post.Body = c.FormValue("body")
+	post.Slug = c.FormValue("slug")
+	if post.Title == "" || post.Body == "" {
+		return ctr.FormError(c, fmt.Sprintf("/admin/%d/editpost", post.ID),
+			"Title and text cannot be empty.")
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	tags, err := ctr.setPostFields(post, form)
+	if err != nil {
+		return ctr.FormError(c, fmt.Sprintf("/admin/%d/editpost", post.ID),
+			"Post is not saved: "+err.Error()+".")
 	}
-	if err := ctr.DB.UpdatePost(post); err != nil {
+	uploads, err := ctr.parseUploads(c)
+	if err != nil {
+		return ctr.FormError(c, fmt.Sprintf("/admin/%d/editpost", post.ID),
+			"Post is not saved: "+err.Error()+".")
+	}
+	user := ctr.ContextUser(c)
+	if err := ctr.DB.UpdatePost(post, user.ID); err != nil {
 		return fmt.Errorf("error updating post: %w", err)
 	}
-	return c.Redirect(http.StatusFound, "/"+postidstr)
+	if err := ctr.DB.SetPostTags(post, tags); err != nil {
+		return fmt.Errorf("error setting tags: %w", err)
+	}
+	if err := ctr.removeAttachments(post, form["remove"]); err != nil {
+		return err
+	}
+	if err := ctr.saveUploads(post, user, uploads); err != nil {
+		return err
+	}
+	ctr.Flash(c, sessions.FlashSuccess, postSavedMessage(post, "updated"))
+	return c.Redirect(http.StatusFound, post.Path())
+}
+
+func postSavedMessage(post *models.Post, saved string) string {
+	switch post.Status {
+	case models.PostScheduled:
+		return fmt.Sprintf("Post is %s and will be published at %s.", saved,
+			post.PublishAt.Local().Format("2006-01-02 15:04"))
+	case models.PostPublished:
+		return fmt.Sprintf("Post is %s.", saved)
+	}
+	return fmt.Sprintf("Post is %s as %s.", saved, post.Status)
+}
+
+// fillPost sets the fields of post from form values saved by FormError.
+func fillPost(post *models.Post, form url.Values) {
+	if form == nil {
+		return
+	}
+	post.Title = form.Get("title")
+	post.Body = form.Get("body")
+	post.Slug = form.Get("slug")
+	post.Status = form.Get("status")
+	post.PublishAt, _ = parsePublishAt(form.Get("publish_at"))
+	post.Tags = nil
+	for _, name := range strings.Split(form.Get("tags"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			post.Tags = append(post.Tags, models.Tag{Name: name})
+		}
+	}
+	post.CategoryID = nil
+	if id, err := strconv.Atoi(form.Get("category")); err == nil {
+		post.CategoryID = &id
+	}
 }
 
 func (ctr *Controller) CreatePostForm(c echo.Context) error {
+	post := new(models.Post)
+	fillPost(post, ctr.TakeForm(c))
+	return ctr.renderPostForm(c, "/admin/createpost", post)
+}
+
+func (ctr *Controller) renderPostForm(c echo.Context, action string, post *models.Post) error {
+	categories, err := ctr.DB.GetCategories()
+	if err != nil {
+		return fmt.Errorf("error getting categories: %w", err)
+	}
+	attachments := []models.Attachment{}
+	if post.ID != 0 {
+		if attachments, err = ctr.DB.GetAttachmentsPostID(strconv.Itoa(post.ID)); err != nil {
+			return fmt.Errorf("error getting attachments: %w", err)
+		}
+	}
 	data := struct {
-		Action     string
-		Post       *models.Post
-		IsSignedIn bool
+		Action      string
+		Post        *models.Post
+		Statuses    []string
+		Categories  []models.CategoryNode
+		Attachments []models.Attachment
+		MaxFiles    int
+		MaxSize     string
+		Page
 	}{
-		Action:     "/admin/createpost",
-		Post:       new(models.Post),
-		IsSignedIn: ctr.IsSignedIn(c),
+		Action:      action,
+		Post:        post,
+		Statuses:    models.PostStatuses,
+		Categories:  models.CategoryTree(categories),
+		Attachments: attachments,
+		MaxFiles:    ctr.MaxUploadFiles,
+		MaxSize:     FileSize(ctr.MaxUploadSize),
+		Page:        ctr.Page(c),
 	}
 	return c.Render(http.StatusOK, "postform", data)
 }
@@ -185,25 +572,48 @@ func (ctr *Controller) CreatePost(c echo.Context) error {
 	title := c.FormValue("title")
 	body := c.FormValue("body")
 	if title == "" || body == "" {
-		return fmt.Errorf("title or body cannot be empty")
-	}
-	rawuser, err := ctr.Store.GetData(c.Request(), "user")
-	if err != nil {
-		err = fmt.Errorf("error: could not get user data: %w", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return ctr.FormError(c, "/admin/createpost", "Title and text cannot be empty.")
 	}
-	user, ok := rawuser.(*models.User)
-	if !ok {
-		return echo.NewHTTPError(http.StatusInternalServerError, "user is wrong")
-	}
-	if err := ctr.DB.SavePost(&models.Post{
+	user := ctr.ContextUser(c)
+	post := &models.Post{
 		UserID: user.ID,
 		Title:  title,
 		Body:   body,
-	}); err != nil {
+		Slug:   c.FormValue("slug"),
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	tags, err := ctr.setPostFields(post, form)
+	if err != nil {
+		return ctr.FormError(c, "/admin/createpost", "Post is not saved: "+err.Error()+".")
+	}
+	uploads, err := ctr.parseUploads(c)
+	if err != nil {
+		return ctr.FormError(c, "/admin/createpost", "Post is not saved: "+err.Error()+".")
+	}
+	if err := ctr.DB.SavePost(post); err != nil {
 		return fmt.Errorf("could not save post: %w", err)
 	}
-	return c.Redirect(http.StatusFound, "/")
+	if err := ctr.DB.SetPostTags(post, tags); err != nil {
+		return fmt.Errorf("error setting tags: %w", err)
+	}
+	if err := ctr.saveUploads(post, user, uploads); err != nil {
+		return err
+	}
+	ctr.Flash(c, sessions.FlashSuccess, postSavedMessage(post, "created"))
+	return c.Redirect(http.StatusFound, post.Path())
+}
+
+// Preview renders the Markdown of the body form value for the preview
+// tab of the post form.
+func (ctr *Controller) Preview(c echo.Context) error {
+	out, err := markdown.HTML(c.FormValue("body"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.HTML(http.StatusOK, out)
 }
 
 func (ctr *Controller) GetAllPosts(c echo.Context) error {
@@ -211,49 +621,115 @@ func (ctr *Controller) GetAllPosts(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	data := struct {
-		Posts      []models.Post
-		IsSignedIn bool
-	}{
-		Posts:      posts,
-		IsSignedIn: ctr.IsSignedIn(c),
+	return ctr.renderPosts(c, "", posts)
+}
+
+// viewablePost returns the post found by get if the signed in user may
+// see it, and the user.
+func (ctr *Controller) viewablePost(c echo.Context, get func() (*models.Post, error)) (*models.Post, *models.User, error) {
+	user, ok := ctr.CurrentUser(c)
+	if !ok {
+		user = &models.User{}
+	}
+	post, err := get()
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !ctr.CanViewPost(user, post)) {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, "post not found")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting post: %w", err)
 	}
-	return c.Render(http.StatusOK, "index", data)
+	return post, user, nil
+}
+
+// RedirectPost permanently redirects the former /:postid URLs of posts
+// to their slugs.
+func (ctr *Controller) RedirectPost(c echo.Context) error {
+	post, _, err := ctr.viewablePost(c, func() (*models.Post, error) {
+		return ctr.DB.GetPost(c.Param("postid"))
+	})
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusMovedPermanently, post.Path())
+}
+
+// postPath returns the URL path of the post with id, or its former path
+// which redirects there if the post cannot be read.
+func (ctr *Controller) postPath(id int) string {
+	post, err := ctr.DB.GetPost(strconv.Itoa(id))
+	if err != nil {
+		return fmt.Sprintf("/%d", id)
+	}
+	return post.Path()
 }
 
 func (ctr *Controller) GetPost(c echo.Context) error {
-	id := c.Param("postid")
-	post, err := ctr.DB.GetPost(id)
+	name, err := url.PathUnescape(c.Param("slug"))
 	if err != nil {
-		return fmt.Errorf("error getting post: %w", err)
+		return echo.NewHTTPError(http.StatusNotFound, "post not found")
 	}
-	comments, err := ctr.DB.GetCommentsPostID(id)
+	post, user, err := ctr.viewablePost(c, func() (*models.Post, error) {
+		return ctr.DB.GetPostSlug(name)
+	})
+	if err != nil {
+		return err
+	}
+	// former slugs redirect to the current one
+	if post.Slug != name {
+		return c.Redirect(http.StatusMovedPermanently, post.Path())
+	}
+	id := strconv.Itoa(post.ID)
+	comments, err := ctr.DB.GetCommentTree(id, ctr.CommentDepth)
 	if err != nil {
 		return fmt.Errorf("error getting comments for postid %s: %w", id, err)
 	}
-	rawuser, err := ctr.Store.GetData(c.Request(), ctr.UserField)
+	attachments, err := ctr.DB.GetAttachmentsPostID(id)
 	if err != nil {
-		err = fmt.Errorf("error: could not get user data: %w", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return fmt.Errorf("error getting attachments for postid %s: %w", id, err)
+	}
+	role := ctr.Role(user)
+	comment := &models.Comment{
+		Name:  user.Name,
+		Email: user.Email,
+	}
+	if form := ctr.TakeForm(c); form != nil {
+		comment.Name = form.Get("name")
+		comment.Email = form.Get("email")
+		comment.Body = form.Get("body")
+		if parent, err := strconv.Atoi(form.Get("parent")); err == nil {
+			comment.ParentID = &parent
+		}
 	}
-	user, ok := rawuser.(*models.User)
-	if !ok {
-		user = &models.User{}
+	replyTo := 0
+	if comment.ParentID != nil {
+		replyTo = *comment.ParentID
 	}
 	data := struct {
-		Post       *models.Post
-		Comments   []models.Comment
-		Prefix     string
-		Name       string
-		Email      string
-		IsSignedIn bool
+		Post        *models.Post
+		Attachments []models.Attachment
+		Comments    []*models.CommentNode
+		Prefix      string
+		Comment     *models.Comment
+		ReplyTo     int
+		Perms       commentPerms
+		CanEdit     bool
+		CanDelete   bool
+		CanComment  bool
+		Page
 	}{
-		Post:       post,
-		Comments:   comments,
-		Prefix:     "/admin",
-		Name:       user.Name,
-		Email:      user.Email,
-		IsSignedIn: ctr.IsSignedIn(c),
+		Post:        post,
+		Attachments: attachments,
+		Comments:    comments,
+		Prefix:      "/admin",
+		Comment:     comment,
+		ReplyTo:     replyTo,
+		Perms:       commentPerms{ctr: ctr, user: user, now: time.Now()},
+		CanEdit: auth.CanModify(role, user.ID, post.UserID,
+			auth.PermEditOwnPost, auth.PermEditAnyPost),
+		CanDelete: auth.CanModify(role, user.ID, post.UserID,
+			auth.PermDeleteOwnPost, auth.PermDeleteAnyPost),
+		CanComment: post.Published() && auth.HasPermission(role, auth.PermComment),
+		Page:       ctr.Page(c),
 	}
 	return c.Render(http.StatusOK, "post", data)
 }
@@ -262,30 +738,80 @@ func (ctr *Controller) CreateComment(c echo.Context) error {
 	name := c.FormValue("name")
 	email := c.FormValue("email")
 	body := c.FormValue("body")
-	if name == "" || email == "" || body == "" {
-		return fmt.Errorf("name or email or body cannot be empty")
-	}
 	postidstr := c.Param("postid")
 	postid, err := strconv.Atoi(postidstr)
 	if err != nil {
-		return fmt.Errorf("post id has to be an integer")
+		return echo.NewHTTPError(http.StatusNotFound, "post id has to be an integer")
+	}
+	post, err := ctr.DB.GetPost(postidstr)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !post.Published()) {
+		return echo.NewHTTPError(http.StatusNotFound, "post not found")
+	}
+	if err != nil {
+		return fmt.Errorf("error getting post: %w", err)
+	}
+	if name == "" || email == "" || body == "" {
+		return ctr.FormError(c, post.Path(), "Name, email and comment cannot be empty.")
 	}
-	if err := ctr.DB.SaveComment(&models.Comment{
+	user := ctr.ContextUser(c)
+	comment := &models.Comment{
 		PostID: postid,
+		UserID: &user.ID,
 		Name:   name,
 		Email:  email,
 		Body:   body,
-	}); err != nil {
+	}
+	if parentid := c.FormValue("parent"); parentid != "" {
+		parent, err := ctr.DB.GetComment(parentid)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && parent.PostID != postid) {
+			return echo.NewHTTPError(http.StatusBadRequest, "parent comment does not belong to the post")
+		}
+		if err != nil {
+			return fmt.Errorf("error getting parent comment: %w", err)
+		}
+		comment.ParentID = &parent.ID
+	}
+	comment.IP = c.RealIP()
+	comment.BodyHash = moderation.BodyHash(body)
+	decision, err := ctr.Filters.Run(&moderation.Input{Comment: comment, Now: time.Now()})
+	if err != nil {
+		return fmt.Errorf("error filtering comment: %w", err)
+	}
+	if decision.Action == moderation.Reject {
+		return ctr.FormError(c, post.Path(), "Comment is not added: "+decision.Rejection+".")
+	}
+	approved, err := ctr.DB.CountApprovedCommentsUserID(strconv.Itoa(user.ID))
+	if err != nil {
+		return fmt.Errorf("error counting comments: %w", err)
+	}
+	role := ctr.Role(user)
+	comment.Status = ctr.Moderation.Status(role, approved)
+	if !ctr.Moderation.Trusted(role) {
+		comment.Status = decision.Status(comment.Status)
+	}
+	comment.SpamScore = decision.Score
+	comment.FilterNotes = decision.Notes()
+	if err := ctr.DB.SaveComment(comment); err != nil {
 		return fmt.Errorf("could not save comment for post %d : %w", postid, err)
 	}
-	return c.Redirect(http.StatusFound, "/"+postidstr)
+	// spam is not told apart from held comments, so that spammers do
+	// not learn what passes the filters
+	if comment.Status != models.CommentApproved {
+		ctr.Flash(c, sessions.FlashInfo, "Comment is waiting for approval by a moderator.")
+	} else {
+		ctr.Flash(c, sessions.FlashSuccess, "Comment is added.")
+	}
+	return c.Redirect(http.StatusFound, post.Path())
 }
 
 func NotImplemented(c echo.Context) error {
 	return c.String(http.StatusOK, "Not implemented yet.")
 }
 
-func CreateController(dsn string, authkey []byte) (*Controller, error) {
+func CreateController(dsn string, session *SessionConfig, defaultRole string) (*Controller, error) {
+	if !auth.ValidRole(defaultRole) {
+		return nil, fmt.Errorf("error: unknown default role %q", defaultRole)
+	}
 	db, err := storage.CreateGormDatabase(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("error creating database: %w", err)
@@ -293,10 +819,22 @@ func CreateController(dsn string, authkey []byte) (*Controller, error) {
 	if err := db.CreateTables(); err != nil {
 		return nil, fmt.Errorf("error: could not migrate database: %w", err)
 	}
-	store := sessions.CreateCookieStore("session", authkey)
-	return &Controller{
-		DB:        db,
-		Store:     store,
-		UserField: "user",
-	}, nil
+	gob.Register(map[string]auth.Flow{})
+	gob.Register(PendingSignIn{})
+	ctr := &Controller{
+		DB:          db,
+		UserField:   "user",
+		DefaultRole: defaultRole,
+		Moderation:  moderation.DefaultPolicy,
+	}
+	store := sessions.NewDBStore(db, ctr.UserField, session.KeyPairs()...)
+	if err := session.Apply(store); err != nil {
+		return nil, err
+	}
+	go store.Cleanup(context.Background(), sessions.CleanupInterval)
+	ctr.Store = &sessions.SessionStore{
+		Store: store,
+		Name:  session.CookieName,
+	}
+	return ctr, nil
 }
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"html/template"
 	"log"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/vestlog/nix/pkg/auth"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/endpoints"
+	"github.com/vestlog/nix/pkg/blob"
 )
 
 var (
@@ -19,63 +22,139 @@ func main() {
 	flag.Parse()
 	LoadConfig(*conffilepath)
 
-	goauth := &oauth2.Config{
-		ClientID:     GlobalConfig.GoogleOAuth.ClientID,
-		ClientSecret: GlobalConfig.GoogleOAuth.ClientSecret,
-		Endpoint:     endpoints.Google,
-		RedirectURL:  "http://localhost:8080/google/callback",
-		Scopes:       []string{"openid", "email", "profile"},
-	}
-	fbauth := &oauth2.Config{
-		ClientID:     GlobalConfig.FacebookOAuth.ClientID,
-		ClientSecret: GlobalConfig.FacebookOAuth.ClientSecret,
-		Endpoint:     endpoints.Facebook,
-		RedirectURL:  "http://localhost:8080/facebook/callback",
-		Scopes:       []string{"public_profile", "email"},
-	}
-
 	ctr, err := CreateController(
 		GlobalConfig.DSN,
-		[]byte(GlobalConfig.SessionsKey),
+		&GlobalConfig.Session,
+		GlobalConfig.DefaultRole,
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
-	ctr.GoogleAuth = &auth.OAuth{
-		Conf:    goauth,
-		InfoURL: auth.GoogleInfoURL,
+	ctr.TOTPIssuer = GlobalConfig.TOTPIssuer
+	ctr.Require2FA = GlobalConfig.Require2FA
+	ctr.CommentDepth = GlobalConfig.CommentDepth
+	ctr.Moderation = GlobalConfig.Moderation.Policy()
+	ctr.Filters, err = GlobalConfig.Moderation.Filters.Pipeline(ctr.DB)
+	if err != nil {
+		log.Fatal(err)
 	}
-	ctr.FacebookAuth = &auth.OAuth{
-		Conf:    fbauth,
-		InfoURL: auth.FacebookInfoURL,
+	ctr.EditWindow, err = time.ParseDuration(GlobalConfig.CommentEditWindow)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error: invalid CommentEditWindow: %w", err))
+	}
+	publishInterval, err := time.ParseDuration(GlobalConfig.PublishInterval)
+	if err != nil || publishInterval <= 0 {
+		log.Fatal(fmt.Errorf("error: invalid PublishInterval %q", GlobalConfig.PublishInterval))
+	}
+	go PublishScheduled(context.Background(), ctr.DB, publishInterval)
+	ctr.TrashRetention, err = time.ParseDuration(GlobalConfig.TrashRetention)
+	if err != nil || ctr.TrashRetention < 0 {
+		log.Fatal(fmt.Errorf("error: invalid TrashRetention %q", GlobalConfig.TrashRetention))
+	}
+	ctr.Blobs, err = blob.Open(GlobalConfig.Attachments.Store, GlobalConfig.Attachments.Location)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctr.MaxUploadSize = GlobalConfig.Attachments.MaxSize
+	ctr.MaxUploadFiles = GlobalConfig.Attachments.MaxFiles
+	ctr.ThumbnailSize = GlobalConfig.Attachments.ThumbnailSize
+	if ctr.TrashRetention > 0 {
+		go PurgeTrash(context.Background(), ctr.DB, ctr.Blobs, ctr.TrashRetention, PurgeInterval)
+	}
+	ctr.Auth, err = auth.CreateRegistry(GlobalConfig.BaseURL, GlobalConfig.Providers)
+	if err != nil {
+		log.Fatal(err)
 	}
 	e := echo.New()
 	// e.Debug = true
-	e.Renderer = CreateTemplate()
+	if e.IPExtractor, err = GlobalConfig.IPExtractor(); err != nil {
+		log.Fatal(err)
+	}
+	e.Renderer = CreateTemplate(template.FuncMap{
+		"Providers": ctr.Auth.Names,
+	})
 
 	e.Use(middleware.Logger())
+	e.Use(middleware.BodyLimit(GlobalConfig.Attachments.BodyLimit()))
 	e.Use(ctr.SessionMiddleware)
+	e.Use(ctr.CSRF)
 
 	e.GET("/", ctr.GetAllPosts)
-	e.GET("/:postid", ctr.GetPost)
+	e.GET("/tags", ctr.Tags)
+	e.GET("/tags/:tag", ctr.TagPosts)
+	e.GET("/categories", ctr.Categories)
+	e.GET("/categories/:slug", ctr.CategoryPosts)
+	e.GET("/posts/:slug", ctr.GetPost)
+	e.GET("/:postid", ctr.RedirectPost)
+	e.GET("/attachments/:attachmentid/:name", ctr.GetAttachment)
+	e.GET("/thumbnails/:attachmentid", ctr.GetThumbnail)
 
 	restricted := e.Group("/admin")
-	restricted.Use(ctr.RestrictAccess)
-	restricted.GET("/:postid/editpost", ctr.EditPostForm)
-	restricted.POST("/:postid/editpost", ctr.EditPost)
-	restricted.GET("/createpost", ctr.CreatePostForm)
-	restricted.POST("/createpost", ctr.CreatePost)
-	restricted.POST("/:postid/addcomment", ctr.CreateComment)
-	restricted.GET("/:postid/deletepost", ctr.DeletePost)
-	restricted.GET("/signout", ctr.Signout)
+	restricted.Use(ctr.RestrictAccess, ctr.Enforce2FA)
+	editor := ctr.Require(auth.PermEditOwnPost)
+	restricted.GET("/:postid/editpost", ctr.EditPostForm, editor)
+	restricted.POST("/:postid/editpost", ctr.EditPost, editor)
+	restricted.GET("/:postid/history", ctr.History, editor)
+	restricted.POST("/:postid/revisions/:revisionid/restore", ctr.RestoreRevision, editor)
+	author := ctr.Require(auth.PermCreatePost)
+	restricted.GET("/createpost", ctr.CreatePostForm, author)
+	restricted.POST("/createpost", ctr.CreatePost, author)
+	restricted.GET("/posts", ctr.Posts, editor)
+	restricted.POST("/preview", ctr.Preview)
+	restricted.POST("/:postid/addcomment", ctr.CreateComment, ctr.Require(auth.PermComment))
+	deleter := ctr.Require(auth.PermDeleteOwnPost)
+	restricted.GET("/:postid/deletepost", ctr.DeletePostForm, deleter)
+	restricted.POST("/:postid/deletepost", ctr.DeletePost, deleter)
+	restricted.GET("/signout", ctr.SignoutForm)
+	restricted.POST("/signout", ctr.Signout)
+	restricted.GET("/settings", ctr.Settings)
+	restricted.GET("/password", ctr.PasswordForm)
+	restricted.POST("/password", ctr.ChangePassword)
+	restricted.GET("/tokens", ctr.Tokens)
+	restricted.POST("/tokens", ctr.CreateToken)
+	restricted.POST("/tokens/:tokenid/revoke", ctr.RevokeToken)
+	admin := ctr.Require(auth.PermManageUsers)
+	restricted.GET("/users", ctr.Users, admin)
+	restricted.POST("/users/:userid/role", ctr.SetRole, admin)
+	categories := ctr.Require(auth.PermManageCategories)
+	restricted.GET("/categories", ctr.ManageCategories, categories)
+	restricted.POST("/categories", ctr.CreateCategory, categories)
+	restricted.GET("/categories/:categoryid/delete", ctr.DeleteCategoryForm, categories)
+	restricted.POST("/categories/:categoryid/delete", ctr.DeleteCategory, categories)
+	trash := ctr.Require(auth.PermManageTrash)
+	restricted.GET("/trash", ctr.Trash, trash)
+	restricted.POST("/trash/posts/:postid/restore", ctr.RestorePost, trash)
+	restricted.GET("/trash/posts/:postid/purge", ctr.PurgePostForm, trash)
+	restricted.POST("/trash/posts/:postid/purge", ctr.PurgePost, trash)
+	restricted.POST("/trash/comments/:commentid/restore", ctr.RestoreComment, trash)
+	restricted.GET("/trash/comments/:commentid/purge", ctr.PurgeCommentForm, trash)
+	restricted.POST("/trash/comments/:commentid/purge", ctr.PurgeComment, trash)
+	moderator := ctr.Require(auth.PermModerate)
+	restricted.GET("/comments", ctr.ModerationQueue, moderator)
+	restricted.POST("/comments", ctr.ModerateComments, moderator)
+	commenter := ctr.Require(auth.PermComment)
+	restricted.GET("/comments/:commentid/edit", ctr.EditCommentForm, commenter)
+	restricted.POST("/comments/:commentid/edit", ctr.EditComment, commenter)
+	restricted.GET("/comments/:commentid/delete", ctr.DeleteCommentForm, commenter)
+	restricted.POST("/comments/:commentid/delete", ctr.DeleteComment, commenter)
+	restricted.POST("/settings/unlink/:provider", ctr.UnlinkIdentity)
+	restricted.POST("/settings/sessions/:sessionid/revoke", ctr.RevokeSession)
+	restricted.POST("/settings/sessions/revoke", ctr.RevokeOtherSessions)
+	restricted.GET("/2fa", ctr.TwoFactor)
+	restricted.POST("/2fa/enable", ctr.EnableTwoFactor)
+	restricted.POST("/2fa/recovery", ctr.RegenerateRecoveryCodes)
+	restricted.POST("/2fa/disable", ctr.DisableTwoFactor)
 
-	gauth := e.Group("/google")
-	gauth.GET("/login", ctr.GoogleLogin)
-	gauth.GET("/callback", ctr.GoogleCallback)
+	e.GET("/login", ctr.LoginForm)
+	e.POST("/login", ctr.PasswordLogin)
+	e.GET("/login/2fa", ctr.ChallengeForm)
+	e.POST("/login/2fa", ctr.Challenge)
+	e.GET("/register", ctr.RegisterForm)
+	e.POST("/register", ctr.Register)
 
-	fauth := e.Group("/facebook")
-	fauth.GET("/login", ctr.FacebookLogin)
-	fauth.GET("/callback", ctr.FacebookCallback)
+	oauth := e.Group("/auth/:provider")
+	oauth.GET("/login", ctr.Login)
+	oauth.GET("/callback", ctr.Callback)
 
 	e.GET("/favicon.ico", NotImplemented)
 	e.Static("/static", "static")
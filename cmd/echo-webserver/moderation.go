@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/moderation"
+	"github.com/vestlog/nix/pkg/sessions"
+)
+
+// ModerationQueue lists comments with the status given by the status
+// query parameter, pending ones by default.
+func (ctr *Controller) ModerationQueue(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status == "" {
+		status = models.CommentPending
+	}
+	if !models.ValidCommentStatus(status) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown comment status")
+	}
+	comments, err := ctr.DB.GetCommentsStatus(status)
+	if err != nil {
+		return fmt.Errorf("error getting comments: %w", err)
+	}
+	data := struct {
+		Status   string
+		Statuses []string
+		Comments []models.Comment
+		Page
+	}{
+		Status:   status,
+		Statuses: models.CommentStatuses,
+		Comments: comments,
+		Page:     ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "moderation", data)
+}
+
+// ModerateComments sets the status of all selected comments at once.
+func (ctr *Controller) ModerateComments(c echo.Context) error {
+	status := c.FormValue("status")
+	if !models.ValidCommentStatus(status) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown comment status")
+	}
+	form, err := c.FormParams()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ids := make([]int, 0, len(form["id"]))
+	for _, value := range form["id"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "comment id has to be an integer")
+		}
+		ids = append(ids, id)
+	}
+	back := "/admin/comments"
+	if from := c.FormValue("from"); models.ValidCommentStatus(from) {
+		back += "?status=" + from
+	}
+	if len(ids) == 0 {
+		ctr.Flash(c, sessions.FlashError, "No comments are selected.")
+		return c.Redirect(http.StatusFound, back)
+	}
+	changed, err := ctr.DB.SetCommentsStatus(ids, status)
+	if err != nil {
+		return fmt.Errorf("could not change comments: %w", err)
+	}
+	if err := ctr.train(ids, status); err != nil {
+		return err
+	}
+	ctr.Flash(c, sessions.FlashSuccess, fmt.Sprintf("%d comments are now %s.", changed, status))
+	return c.Redirect(http.StatusFound, back)
+}
+
+// train lets the spam classifier learn from the decision of a moderator.
+func (ctr *Controller) train(ids []int, status string) error {
+	comments, err := ctr.DB.GetCommentsIDs(ids)
+	if err != nil {
+		return fmt.Errorf("error getting comments: %w", err)
+	}
+	class := moderation.TrainingClass(status)
+	for i := range comments {
+		tokens := moderation.Tokenize(comments[i].Body)
+		if err := ctr.DB.TrainComment(&comments[i], class, tokens); err != nil {
+			return fmt.Errorf("could not train spam filter: %w", err)
+		}
+	}
+	return nil
+}
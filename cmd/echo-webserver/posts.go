@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/storage"
+)
+
+// PublishTimeLayout is the format of the publish_at form value, the
+// value of datetime-local inputs.
+const PublishTimeLayout = "2006-01-02T15:04"
+
+var (
+	ErrPostStatus = errors.New("unknown post status")
+	ErrPublishAt  = errors.New("scheduled posts need a publish time in the future")
+)
+
+// CanViewPost reports whether user may see post: published posts are
+// public, others are seen by users who may edit them.
+func (ctr *Controller) CanViewPost(user *models.User, post *models.Post) bool {
+	if post.Published() {
+		return true
+	}
+	return user.ID != 0 && auth.CanModify(ctr.Role(user), user.ID, post.UserID,
+		auth.PermEditOwnPost, auth.PermEditAnyPost)
+}
+
+// parsePublishAt reads a publish_at form value in the local time zone.
+func parsePublishAt(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation(PublishTimeLayout, value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// setPostStatus sets the status and publish time of post from the
+// status and publish_at form values; an empty status publishes.
+// Published posts keep the time they were first published.
+func setPostStatus(post *models.Post, form url.Values, now time.Time) error {
+	status := form.Get("status")
+	if status == "" {
+		status = models.PostPublished
+	}
+	if !models.ValidPostStatus(status) {
+		return ErrPostStatus
+	}
+	switch status {
+	case models.PostDraft:
+		post.PublishAt = nil
+	case models.PostScheduled:
+		publishAt, err := parsePublishAt(form.Get("publish_at"))
+		if err != nil || publishAt == nil || !publishAt.After(now) {
+			return ErrPublishAt
+		}
+		t := publishAt.UTC()
+		post.PublishAt = &t
+	case models.PostPublished:
+		if !post.Published() || post.PublishAt == nil {
+			t := now.UTC()
+			post.PublishAt = &t
+		}
+	}
+	post.Status = status
+	return nil
+}
+
+// Posts lists the posts of a status, by default drafts, which the user
+// may edit.
+func (ctr *Controller) Posts(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status == "" {
+		status = models.PostDraft
+	}
+	if !models.ValidPostStatus(status) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown status")
+	}
+	user := ctr.ContextUser(c)
+	all := auth.HasPermission(ctr.Role(user), auth.PermEditAnyPost)
+	userID := user.ID
+	if all {
+		userID = 0
+	}
+	posts, err := ctr.DB.GetPostsStatus(status, userID)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Status   string
+		Statuses []string
+		Posts    []models.Post
+		All      bool
+		Page
+	}{
+		Status:   status,
+		Statuses: models.PostStatuses,
+		Posts:    posts,
+		All:      all,
+		Page:     ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "posts", data)
+}
+
+// PublishInterval is how often scheduled posts are checked, if not
+// configured.
+var PublishInterval = time.Minute
+
+// PublishScheduled publishes scheduled posts once they are due, checking
+// at start and every interval until ctx is done.
+func PublishScheduled(ctx context.Context, db storage.Database, interval time.Duration) {
+	publish := func(now time.Time) {
+		n, err := db.PublishDuePosts(now)
+		if err != nil {
+			log.Printf("error: could not publish scheduled posts: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("published %d scheduled posts", n)
+		}
+	}
+	publish(time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			publish(now)
+		}
+	}
+}
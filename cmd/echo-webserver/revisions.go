@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/diff"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
+	"gorm.io/gorm"
+)
+
+// findRevision returns the revision with the id of the query param name,
+// or def when the param is not set.
+func findRevision(c echo.Context, revisions []models.PostRevision, name string, def int) (*models.PostRevision, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return &revisions[def], nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid revision")
+	}
+	for i := range revisions {
+		if revisions[i].ID == id {
+			return &revisions[i], nil
+		}
+	}
+	return nil, echo.NewHTTPError(http.StatusNotFound, "revision not found")
+}
+
+// History lists the revisions of a post and the difference between the
+// revisions of the from and to query params, by default the last edit.
+func (ctr *Controller) History(c echo.Context) error {
+	post, err := ctr.modifiablePost(c, auth.PermEditOwnPost, auth.PermEditAnyPost)
+	if err != nil {
+		return err
+	}
+	revisions, err := ctr.DB.GetPostRevisions(strconv.Itoa(post.ID))
+	if err != nil {
+		return fmt.Errorf("error getting revisions: %w", err)
+	}
+	data := struct {
+		Post      *models.Post
+		Revisions []models.PostRevision
+		From      *models.PostRevision
+		To        *models.PostRevision
+		Diff      []diff.Line
+		Page
+	}{
+		Post:      post,
+		Revisions: revisions,
+		Page:      ctr.Page(c),
+	}
+	if len(revisions) > 0 {
+		last := len(revisions) - 1
+		from := last
+		if from > 0 {
+			from--
+		}
+		if data.From, err = findRevision(c, revisions, "from", from); err != nil {
+			return err
+		}
+		if data.To, err = findRevision(c, revisions, "to", last); err != nil {
+			return err
+		}
+		data.Diff = diff.Lines(data.From.Body, data.To.Body)
+	}
+	return c.Render(http.StatusOK, "history", data)
+}
+
+// RestoreRevision saves the content of a revision as the new revision
+// of its post.
+func (ctr *Controller) RestoreRevision(c echo.Context) error {
+	post, err := ctr.modifiablePost(c, auth.PermEditOwnPost, auth.PermEditAnyPost)
+	if err != nil {
+		return err
+	}
+	revision, err := ctr.DB.GetPostRevision(strconv.Itoa(post.ID), c.Param("revisionid"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "revision not found")
+	}
+	if err != nil {
+		return fmt.Errorf("error getting revision: %w", err)
+	}
+	post.Title = revision.Title
+	post.Body = revision.Body
+	if err := ctr.DB.UpdatePost(post, ctr.ContextUser(c).ID); err != nil {
+		return fmt.Errorf("error updating post: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess,
+		fmt.Sprintf("Revision of %s is restored.", revision.CreatedAt.Format("2006-01-02 15:04")))
+	return c.Redirect(http.StatusFound, fmt.Sprintf("/admin/%d/history", post.ID))
+}
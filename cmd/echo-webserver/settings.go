@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
+	"gorm.io/gorm"
+)
+
+type LinkedProvider struct {
+	Name     string
+	Identity *models.Identity
+}
+
+func (ctr *Controller) Settings(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	identities, err := ctr.DB.GetIdentitiesUserID(strconv.Itoa(user.ID))
+	if err != nil {
+		return fmt.Errorf("error getting identities: %w", err)
+	}
+	providers := make([]LinkedProvider, 0)
+	for _, name := range ctr.Auth.Names() {
+		provider := LinkedProvider{Name: name}
+		for i := range identities {
+			if identities[i].Provider == name {
+				provider.Identity = &identities[i]
+			}
+		}
+		providers = append(providers, provider)
+	}
+	_, err = ctr.DB.GetCredentialUserID(strconv.Itoa(user.ID))
+	hasPassword := err == nil
+	active, err := ctr.DB.GetSessionsUserID(strconv.Itoa(user.ID))
+	if err != nil {
+		return fmt.Errorf("error getting sessions: %w", err)
+	}
+	data := struct {
+		User        *models.User
+		Providers   []LinkedProvider
+		CanUnlink   bool
+		HasPassword bool
+		Sessions    []models.Session
+		Current     string
+		Page
+	}{
+		User:        user,
+		Providers:   providers,
+		CanUnlink:   len(identities) > 1 || hasPassword,
+		HasPassword: hasPassword,
+		Sessions:    active,
+		Current:     ctr.currentSession(c),
+		Page:        ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "settings", data)
+}
+
+// LinkIdentity adds the provider account to the signed in user.
+func (ctr *Controller) LinkIdentity(c echo.Context, provider string, info *auth.UserInfo) error {
+	user, ok := ctr.CurrentUser(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusForbidden, "FORBIDDEN")
+	}
+	identity, err := ctr.DB.GetIdentity(provider, info.ID)
+	if err == nil {
+		if identity.UserID != user.ID {
+			return echo.NewHTTPError(http.StatusConflict,
+				"this account is already linked to another user")
+		}
+		return c.Redirect(http.StatusFound, "/admin/settings")
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("error getting identity: %w", err)
+	}
+	if err := ctr.DB.SaveIdentity(&models.Identity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  info.ID,
+		Email:    info.Email,
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.Redirect(http.StatusFound, "/admin/settings")
+}
+
+func (ctr *Controller) UnlinkIdentity(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	userid := strconv.Itoa(user.ID)
+	identities, err := ctr.DB.GetIdentitiesUserID(userid)
+	if err != nil {
+		return fmt.Errorf("error getting identities: %w", err)
+	}
+	_, err = ctr.DB.GetCredentialUserID(userid)
+	if len(identities) < 2 && err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			"the last sign-in method cannot be removed")
+	}
+	if err := ctr.DB.DeleteIdentity(userid, c.Param("provider")); err != nil {
+		return fmt.Errorf("could not unlink provider: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, fmt.Sprintf("%s is unlinked.", c.Param("provider")))
+	return c.Redirect(http.StatusFound, "/admin/settings")
+}
+
+func (ctr *Controller) currentSession(c echo.Context) string {
+	return sessions.HashID(ctr.Store.ID(c.Request()))
+}
+
+func (ctr *Controller) RevokeSession(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	err := ctr.DB.DeleteSessionUserID(strconv.Itoa(user.ID), c.Param("sessionid"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "session not found")
+	}
+	if err != nil {
+		return fmt.Errorf("could not revoke session: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, "Session is revoked.")
+	return c.Redirect(http.StatusFound, "/admin/settings")
+}
+
+// RevokeOtherSessions signs the user out everywhere but here.
+func (ctr *Controller) RevokeOtherSessions(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	userid := strconv.Itoa(user.ID)
+	active, err := ctr.DB.GetSessionsUserID(userid)
+	if err != nil {
+		return fmt.Errorf("error getting sessions: %w", err)
+	}
+	current := ctr.currentSession(c)
+	for _, session := range active {
+		if session.ID == current {
+			continue
+		}
+		if err := ctr.DB.DeleteSessionUserID(userid, session.ID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("could not revoke session: %w", err)
+		}
+	}
+	ctr.Flash(c, sessions.FlashSuccess, "Other sessions are signed out.")
+	return c.Redirect(http.StatusFound, "/admin/settings")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
+	"github.com/vestlog/nix/pkg/slug"
+	"gorm.io/gorm"
+)
+
+// MaxTags is the number of tags a post may have.
+const MaxTags = 10
+
+var (
+	ErrTooManyTags = fmt.Errorf("posts have at most %d tags", MaxTags)
+	ErrCategory    = errors.New("unknown category")
+)
+
+// parseTags turns the comma separated tags form value into tag names.
+func parseTags(value string) ([]string, error) {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = slug.Make(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+	return names, nil
+}
+
+// setPostFields sets the status, publish time and category of post from
+// the post form and returns its tags.
+func (ctr *Controller) setPostFields(post *models.Post, form url.Values) ([]string, error) {
+	if err := setPostStatus(post, form, time.Now()); err != nil {
+		return nil, err
+	}
+	post.Category = nil
+	post.CategoryID = nil
+	if value := form.Get("category"); value != "" {
+		category, err := ctr.findCategory(value)
+		if err != nil {
+			return nil, err
+		}
+		post.CategoryID = &category.ID
+	}
+	return parseTags(form.Get("tags"))
+}
+
+// findCategory returns the category with the id value.
+func (ctr *Controller) findCategory(value string) (*models.Category, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, ErrCategory
+	}
+	categories, err := ctr.DB.GetCategories()
+	if err != nil {
+		return nil, fmt.Errorf("error getting categories: %w", err)
+	}
+	for i := range categories {
+		if categories[i].ID == id {
+			return &categories[i], nil
+		}
+	}
+	return nil, ErrCategory
+}
+
+// renderPosts shows posts on the index page under heading.
+func (ctr *Controller) renderPosts(c echo.Context, heading string, posts []models.Post) error {
+	data := struct {
+		Heading string
+		Posts   []models.Post
+		Page
+	}{
+		Heading: heading,
+		Posts:   posts,
+		Page:    ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "index", data)
+}
+
+// Tags lists the tags of published posts.
+func (ctr *Controller) Tags(c echo.Context) error {
+	tags, err := ctr.DB.GetTags()
+	if err != nil {
+		return fmt.Errorf("error getting tags: %w", err)
+	}
+	data := struct {
+		Tags []models.TagCount
+		Page
+	}{
+		Tags: tags,
+		Page: ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "tags", data)
+}
+
+func (ctr *Controller) TagPosts(c echo.Context) error {
+	name := slug.Make(c.Param("tag"))
+	posts, err := ctr.DB.GetPostsTag(name)
+	if err != nil {
+		return fmt.Errorf("error getting posts of tag %s: %w", name, err)
+	}
+	return ctr.renderPosts(c, "Posts tagged "+name, posts)
+}
+
+// Categories shows the category tree.
+func (ctr *Controller) Categories(c echo.Context) error {
+	return ctr.renderCategories(c, "categories")
+}
+
+func (ctr *Controller) renderCategories(c echo.Context, name string) error {
+	categories, err := ctr.DB.GetCategories()
+	if err != nil {
+		return fmt.Errorf("error getting categories: %w", err)
+	}
+	data := struct {
+		Categories []models.CategoryNode
+		Category   *models.Category
+		Page
+	}{
+		Categories: models.CategoryTree(categories),
+		Category:   &models.Category{},
+		Page:       ctr.Page(c),
+	}
+	if form := ctr.TakeForm(c); form != nil {
+		data.Category.Name = form.Get("name")
+		if parent, err := strconv.Atoi(form.Get("parent")); err == nil {
+			data.Category.ParentID = &parent
+		}
+	}
+	return c.Render(http.StatusOK, name, data)
+}
+
+// CategoryPosts lists the published posts of a category and its
+// descendants.
+func (ctr *Controller) CategoryPosts(c echo.Context) error {
+	category, err := ctr.DB.GetCategory(c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "category not found")
+	}
+	if err != nil {
+		return fmt.Errorf("error getting category: %w", err)
+	}
+	posts, err := ctr.DB.GetPostsCategory(category.ID)
+	if err != nil {
+		return fmt.Errorf("error getting posts of category %s: %w", category.Slug, err)
+	}
+	return ctr.renderPosts(c, category.Name, posts)
+}
+
+// ManageCategories shows the category tree with forms to add and
+// delete categories.
+func (ctr *Controller) ManageCategories(c echo.Context) error {
+	return ctr.renderCategories(c, "managecategories")
+}
+
+func (ctr *Controller) CreateCategory(c echo.Context) error {
+	name := strings.TrimSpace(c.FormValue("name"))
+	category := &models.Category{
+		Name: name,
+		Slug: slug.Make(name),
+	}
+	if category.Slug == "" {
+		return ctr.FormError(c, "/admin/categories", "Name has to contain letters or digits.")
+	}
+	if value := c.FormValue("parent"); value != "" {
+		parent, err := ctr.findCategory(value)
+		if err != nil {
+			return ctr.FormError(c, "/admin/categories", "Category is not saved: "+err.Error()+".")
+		}
+		category.ParentID = &parent.ID
+	}
+	if _, err := ctr.DB.GetCategory(category.Slug); err == nil {
+		return ctr.FormError(c, "/admin/categories",
+			fmt.Sprintf("Category %q already exists.", category.Slug))
+	}
+	if err := ctr.DB.SaveCategory(category); err != nil {
+		return fmt.Errorf("could not save category: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, fmt.Sprintf("Category %q is created.", category.Name))
+	return c.Redirect(http.StatusFound, "/admin/categories")
+}
+
+func (ctr *Controller) DeleteCategoryForm(c echo.Context) error {
+	category, err := ctr.findCategory(c.Param("categoryid"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "category not found")
+	}
+	return ctr.RenderConfirm(c, "Delete category",
+		fmt.Sprintf("Do you want to delete %q? Its subcategories move up and its posts lose their category.", category.Name),
+		fmt.Sprintf("/admin/categories/%d/delete", category.ID), "/admin/categories")
+}
+
+func (ctr *Controller) DeleteCategory(c echo.Context) error {
+	category, err := ctr.findCategory(c.Param("categoryid"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "category not found")
+	}
+	if err := ctr.DB.DeleteCategory(category.ID); err != nil {
+		return fmt.Errorf("could not delete category: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, fmt.Sprintf("Category %q is deleted.", category.Name))
+	return c.Redirect(http.StatusFound, "/admin/categories")
+}
@@ -5,8 +5,15 @@ import (
 	"html/template"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/markdown"
+	"github.com/vestlog/nix/pkg/media"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
 )
 
 type Template struct {
@@ -17,6 +24,99 @@ func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Con
 	return t.templates.ExecuteTemplate(w, name, data)
 }
 
+// Page is embedded in the data of every page. It holds what the header
+// and the forms of a page need.
+type Page struct {
+	IsSignedIn bool
+	csrfToken  func() string
+	flashes    func() []sessions.Flash
+	role       func() string
+}
+
+// CSRFToken returns the CSRF token of the session. It is created on
+// first use, so pages without forms do not start a session.
+func (p Page) CSRFToken() string {
+	if p.csrfToken == nil {
+		return ""
+	}
+	return p.csrfToken()
+}
+
+// Flashes returns the flash messages of the session, which are removed
+// from it once the page is rendered.
+func (p Page) Flashes() []sessions.Flash {
+	if p.flashes == nil {
+		return nil
+	}
+	return p.flashes()
+}
+
+// Can reports whether the signed in user has the permission perm, so
+// that pages only link what the user may open.
+func (p Page) Can(perm string) bool {
+	if !p.IsSignedIn || p.role == nil {
+		return false
+	}
+	return auth.HasPermission(p.role(), auth.Permission(perm))
+}
+
+// AlertClass maps the kind of a flash message to a Bootstrap alert class.
+func AlertClass(kind string) string {
+	switch kind {
+	case sessions.FlashSuccess:
+		return "alert-success"
+	case sessions.FlashError:
+		return "alert-danger"
+	}
+	return "alert-info"
+}
+
+// CSRFField returns the hidden form field with the CSRF token.
+func CSRFField(token string) template.HTML {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		sessions.CSRFField, template.HTMLEscapeString(token)))
+}
+
+// Thread is the data of the recursive "comments" template: the comments
+// of one level and the data of the whole page.
+type Thread struct {
+	Comments []*models.CommentNode
+	Root     interface{}
+}
+
+func NewThread(comments []*models.CommentNode, root interface{}) Thread {
+	return Thread{Comments: comments, Root: root}
+}
+
+// ExcerptLength is the length of post excerpts on the index page.
+var ExcerptLength = 300
+
+// Excerpt returns the beginning of a Markdown body as plain text.
+func Excerpt(src string) string {
+	return markdown.Excerpt(src, ExcerptLength)
+}
+
+// Indent prefixes names of nested categories in select options.
+func Indent(depth int) string {
+	return strings.Repeat("\u00a0\u00a0", depth)
+}
+
+// IsID reports whether the optional id is set to id.
+func IsID(id int, optional *int) bool {
+	return optional != nil && *optional == id
+}
+
+// FileSize writes a number of bytes in B, KB or MB.
+func FileSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
 func IncludeHTML(path string) (template.HTML, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -25,9 +125,32 @@ func IncludeHTML(path string) (template.HTML, error) {
 	return template.HTML(string(data)), nil
 }
 
-func CreateTemplate() *Template {
+// ProviderIcon returns the SVG icon of a login provider, or its name
+// if there is no icon for it.
+func ProviderIcon(name string) template.HTML {
+	icon, err := IncludeHTML(filepath.Join("static", "svg", filepath.Base(name)+".svg"))
+	if err != nil {
+		return template.HTML(template.HTMLEscapeString(name))
+	}
+	return icon
+}
+
+func CreateTemplate(funcs template.FuncMap) *Template {
 	funcMap := template.FuncMap{
-		"IncludeHTML": IncludeHTML,
+		"IncludeHTML":  IncludeHTML,
+		"ProviderIcon": ProviderIcon,
+		"CSRFField":    CSRFField,
+		"AlertClass":   AlertClass,
+		"Markdown":     markdown.Render,
+		"Excerpt":      Excerpt,
+		"Thread":       NewThread,
+		"Indent":       Indent,
+		"IsID":         IsID,
+		"FileSize":     FileSize,
+		"IsImage":      media.IsImage,
+	}
+	for name, f := range funcs {
+		funcMap[name] = f
 	}
 	t := template.Must(template.New("").Funcs(funcMap).ParseGlob("templates/*.html"))
 	return &Template{
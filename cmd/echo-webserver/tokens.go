@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
+	"gorm.io/gorm"
+)
+
+// renderTokens lists the tokens of the signed in user. created is the
+// plain text of a new token, which is shown only once.
+func (ctr *Controller) renderTokens(c echo.Context, status int, created string, formError string) error {
+	user, _ := ctr.CurrentUser(c)
+	tokens, err := ctr.DB.GetAPITokensUserID(strconv.Itoa(user.ID))
+	if err != nil {
+		return fmt.Errorf("error getting tokens: %w", err)
+	}
+	data := struct {
+		Tokens  []models.APIToken
+		Scopes  []string
+		Created string
+		Error   string
+		Page
+	}{
+		Tokens:  tokens,
+		Scopes:  []string{auth.ScopeRead, auth.ScopeWrite},
+		Created: created,
+		Error:   formError,
+		Page:    ctr.Page(c),
+	}
+	return c.Render(status, "tokens", data)
+}
+
+func (ctr *Controller) Tokens(c echo.Context) error {
+	return ctr.renderTokens(c, http.StatusOK, "", "")
+}
+
+func (ctr *Controller) CreateToken(c echo.Context) error {
+	name := strings.TrimSpace(c.FormValue("name"))
+	scope := c.FormValue("scope")
+	if name == "" || len(name) > 64 {
+		return ctr.renderTokens(c, http.StatusBadRequest, "", "name has to be 1-64 characters")
+	}
+	if !auth.ValidScope(scope) {
+		return ctr.renderTokens(c, http.StatusBadRequest, "", "unknown scope")
+	}
+	raw, hash, err := auth.GenerateToken()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	user, _ := ctr.CurrentUser(c)
+	if err := ctr.DB.SaveAPIToken(&models.APIToken{
+		UserID: user.ID,
+		Name:   name,
+		Scope:  scope,
+		Hash:   hash,
+	}); err != nil {
+		return fmt.Errorf("could not save token: %w", err)
+	}
+	return ctr.renderTokens(c, http.StatusOK, raw, "")
+}
+
+func (ctr *Controller) RevokeToken(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	err := ctr.DB.DeleteAPIToken(strconv.Itoa(user.ID), c.Param("tokenid"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "token not found")
+	}
+	if err != nil {
+		return fmt.Errorf("could not revoke token: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, "Token is revoked.")
+	return c.Redirect(http.StatusFound, "/admin/tokens")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/blob"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
+	"github.com/vestlog/nix/pkg/storage"
+	"gorm.io/gorm"
+)
+
+// PurgeInterval is how often the trash is emptied of posts and comments
+// older than the retention period.
+var PurgeInterval = time.Hour
+
+// Trash lists deleted posts and comments.
+func (ctr *Controller) Trash(c echo.Context) error {
+	posts, err := ctr.DB.GetDeletedPosts()
+	if err != nil {
+		return fmt.Errorf("error getting deleted posts: %w", err)
+	}
+	comments, err := ctr.DB.GetDeletedComments()
+	if err != nil {
+		return fmt.Errorf("error getting deleted comments: %w", err)
+	}
+	data := struct {
+		Posts     []models.Post
+		Comments  []models.Comment
+		Retention string
+		Page
+	}{
+		Posts:     posts,
+		Comments:  comments,
+		Retention: formatRetention(ctr.TrashRetention),
+		Page:      ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "trash", data)
+}
+
+// formatRetention writes whole days as days, it is empty if the trash
+// is kept for ever.
+func formatRetention(d time.Duration) string {
+	switch {
+	case d == 0:
+		return ""
+	case d == 24*time.Hour:
+		return "1 day"
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// trashResult turns the error of a trash action into a response.
+func (ctr *Controller) trashResult(c echo.Context, err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "not found in the trash")
+	}
+	if err != nil {
+		return fmt.Errorf("error changing trash: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, message)
+	return c.Redirect(http.StatusFound, "/admin/trash")
+}
+
+func (ctr *Controller) RestorePost(c echo.Context) error {
+	err := ctr.DB.RestorePost(c.Param("postid"))
+	return ctr.trashResult(c, err, "Post is restored with its comments.")
+}
+
+func (ctr *Controller) PurgePostForm(c echo.Context) error {
+	return ctr.RenderConfirm(c, "Delete post permanently",
+		"Do you want to delete this post with its comments, revisions and files permanently? This cannot be undone.",
+		fmt.Sprintf("/admin/trash/posts/%s/purge", c.Param("postid")), "/admin/trash")
+}
+
+func (ctr *Controller) PurgePost(c echo.Context) error {
+	err := ctr.DB.PurgePost(c.Param("postid"))
+	if err == nil {
+		if _, err := DeleteDetachedAttachments(ctr.DB, ctr.Blobs); err != nil {
+			c.Logger().Error(err)
+		}
+	}
+	return ctr.trashResult(c, err, "Post is deleted permanently.")
+}
+
+func (ctr *Controller) RestoreComment(c echo.Context) error {
+	err := ctr.DB.RestoreComment(c.Param("commentid"))
+	return ctr.trashResult(c, err, "Comment is restored with its replies.")
+}
+
+func (ctr *Controller) PurgeCommentForm(c echo.Context) error {
+	return ctr.RenderConfirm(c, "Delete comment permanently",
+		"Do you want to delete this comment with its replies permanently? This cannot be undone.",
+		fmt.Sprintf("/admin/trash/comments/%s/purge", c.Param("commentid")), "/admin/trash")
+}
+
+func (ctr *Controller) PurgeComment(c echo.Context) error {
+	err := ctr.DB.PurgeComment(c.Param("commentid"))
+	return ctr.trashResult(c, err, "Comment is deleted permanently.")
+}
+
+// PurgeTrash permanently deletes posts and comments which are in the
+// trash for longer than retention, and the files of deleted posts,
+// every interval until ctx is done.
+func PurgeTrash(ctx context.Context, db storage.Database, blobs blob.Store, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := db.PurgeDeleted(now.Add(-retention))
+			if err != nil {
+				log.Printf("error: could not empty trash: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d posts and comments from the trash", n)
+			}
+			if n, err := DeleteDetachedAttachments(db, blobs); err != nil {
+				log.Print(err)
+			} else if n > 0 {
+				log.Printf("deleted %d files of deleted posts", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
+	"gorm.io/gorm"
+	"rsc.io/qr"
+)
+
+var (
+	PendingField = "pending2fa"
+	EnrollField  = "totpenroll"
+	// ChallengeLifetime is how long the second factor can be entered
+	// after the first one.
+	ChallengeLifetime = 5 * time.Minute
+	// After MaxChallengeAttempts codes without a right one the second
+	// factor of the user is locked for ChallengeLockout.
+	MaxChallengeAttempts = 5
+	ChallengeLockout     = 15 * time.Minute
+)
+
+var ErrTooManyCodes = errors.New("too many wrong codes")
+
+// PendingSignIn is a sign in waiting for the second factor.
+type PendingSignIn struct {
+	UserID  int
+	Expires time.Time
+}
+
+// StartSignIn signs user in after the first factor. Users with a second
+// factor are only signed in after passing the challenge.
+func (ctr *Controller) StartSignIn(c echo.Context, user *models.User) error {
+	_, err := ctr.DB.GetTOTP(strconv.Itoa(user.ID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := ctr.SignIn(c, user); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		return c.Redirect(http.StatusFound, "/")
+	}
+	if err != nil {
+		return fmt.Errorf("error getting second factor: %w", err)
+	}
+	if err := ctr.Store.Renew(c.Response(), c.Request()); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	// A previous user of the session stays signed out until the challenge.
+	if err := ctr.Store.SaveData(c.Response(), c.Request(), ctr.UserField, nil); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	pending := PendingSignIn{
+		UserID:  user.ID,
+		Expires: time.Now().Add(ChallengeLifetime),
+	}
+	if err := ctr.Store.SaveData(c.Response(), c.Request(), PendingField, pending); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.Redirect(http.StatusFound, "/login/2fa")
+}
+
+func (ctr *Controller) pendingSignIn(c echo.Context) (*PendingSignIn, bool) {
+	data, err := ctr.Store.GetData(c.Request(), PendingField)
+	pending, ok := data.(PendingSignIn)
+	if err != nil || !ok || time.Now().After(pending.Expires) {
+		return nil, false
+	}
+	return &pending, true
+}
+
+func (ctr *Controller) renderChallenge(c echo.Context, status int, message string) error {
+	data := struct {
+		Error string
+		Page
+	}{
+		Error: message,
+		Page:  ctr.Page(c),
+	}
+	return c.Render(status, "twofactor", data)
+}
+
+func (ctr *Controller) ChallengeForm(c echo.Context) error {
+	if _, ok := ctr.pendingSignIn(c); !ok {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	return ctr.renderChallenge(c, http.StatusOK, "")
+}
+
+// Challenge checks the second factor, a TOTP or a recovery code, of a
+// pending sign in. Too many wrong codes end the sign in and lock the
+// second factor for a while.
+func (ctr *Controller) Challenge(c echo.Context) error {
+	pending, ok := ctr.pendingSignIn(c)
+	if !ok {
+		ctr.Flash(c, sessions.FlashError, "Sign in has expired, please sign in again.")
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	user, err := ctr.DB.GetUser(strconv.Itoa(pending.UserID))
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	code := strings.TrimSpace(c.FormValue("code"))
+	recovery := len(code) > auth.TOTPDigits
+	err = ctr.checkSecondFactor(user, code, recovery)
+	if errors.Is(err, ErrTooManyCodes) {
+		if err := ctr.Store.SaveData(c.Response(), c.Request(), PendingField, nil); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		ctr.Flash(c, sessions.FlashError, "Too many wrong codes, please sign in again later.")
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	if errors.Is(err, auth.ErrInvalidCode) {
+		return ctr.renderChallenge(c, http.StatusUnauthorized, "Wrong code, try again.")
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctr.Store.SaveData(c.Response(), c.Request(), PendingField, nil); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := ctr.SignIn(c, user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if recovery {
+		left, _ := ctr.DB.CountRecoveryCodes(strconv.Itoa(user.ID))
+		ctr.Flash(c, sessions.FlashInfo,
+			fmt.Sprintf("A recovery code was used, %d are left. Generate new ones in the settings.", left))
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// checkSecondFactor checks a TOTP or a recovery code of user. Every code
+// is counted in the database before it is checked, so that the limit
+// holds across sign ins and concurrent requests; ErrTooManyCodes is
+// returned while the second factor is locked.
+func (ctr *Controller) checkSecondFactor(user *models.User, code string, recovery bool) error {
+	userid := strconv.Itoa(user.ID)
+	allowed, err := ctr.DB.CountTOTPAttempt(userid, MaxChallengeAttempts, ChallengeLockout)
+	if err != nil {
+		return fmt.Errorf("could not count code attempt: %w", err)
+	}
+	if !allowed {
+		return ErrTooManyCodes
+	}
+	if recovery {
+		err = ctr.DB.UseRecoveryCode(userid, auth.HashRecoveryCode(code))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = auth.ErrInvalidCode
+		}
+	} else {
+		err = ctr.checkTOTP(user, code)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctr.DB.ResetTOTPAttempts(userid); err != nil {
+		return fmt.Errorf("could not reset code attempts: %w", err)
+	}
+	return nil
+}
+
+// checkTOTP validates a code of the second factor of user and stores
+// its time step, so that it cannot be used again.
+func (ctr *Controller) checkTOTP(user *models.User, code string) error {
+	totp, err := ctr.DB.GetTOTP(strconv.Itoa(user.ID))
+	if err != nil {
+		return fmt.Errorf("error getting second factor: %w", err)
+	}
+	step, err := auth.ValidateTOTP(totp.Secret, code, time.Now(), totp.LastStep)
+	if err != nil {
+		return err
+	}
+	err = ctr.DB.UseTOTPStep(strconv.Itoa(user.ID), step)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// a concurrent request used the code first
+		return auth.ErrInvalidCode
+	}
+	if err != nil {
+		return fmt.Errorf("could not save second factor: %w", err)
+	}
+	return nil
+}
+
+// Requires2FA reports whether the role of user has to use a second factor.
+func (ctr *Controller) Requires2FA(user *models.User) bool {
+	role := ctr.Role(user)
+	for _, r := range ctr.Require2FA {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Enforce2FA sends signed in users whose role requires a second factor
+// to its setup until they have one.
+func (ctr *Controller) Enforce2FA(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path := c.Request().URL.Path
+		if strings.HasPrefix(path, "/admin/2fa") || strings.HasPrefix(path, "/admin/signout") {
+			return next(c)
+		}
+		user, ok := ctr.CurrentUser(c)
+		if !ok || !ctr.Requires2FA(user) {
+			return next(c)
+		}
+		_, err := ctr.DB.GetTOTP(strconv.Itoa(user.ID))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctr.Flash(c, sessions.FlashError, "Your role requires two-factor authentication, please set it up first.")
+			return c.Redirect(http.StatusFound, "/admin/2fa")
+		}
+		if err != nil {
+			return fmt.Errorf("error getting second factor: %w", err)
+		}
+		return next(c)
+	}
+}
+
+// enrollSecret returns the secret being set up, kept in the session
+// until it is confirmed with a code.
+func (ctr *Controller) enrollSecret(c echo.Context) (string, error) {
+	if secret, err := ctr.Store.GetString(c.Request(), EnrollField); err == nil && secret != "" {
+		return secret, nil
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := ctr.Store.SaveString(c.Response(), c.Request(), EnrollField, secret); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// QRCode returns a PNG data URL of the QR code of text.
+func QRCode(text string) (template.URL, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", fmt.Errorf("error: could not encode QR code: %w", err)
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG())), nil
+}
+
+func (ctr *Controller) TwoFactor(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	userid := strconv.Itoa(user.ID)
+	data := struct {
+		Enabled   bool
+		Required  bool
+		Remaining int64
+		Secret    string
+		QR        template.URL
+		Page
+	}{
+		Required: ctr.Requires2FA(user),
+		Page:     ctr.Page(c),
+	}
+	_, err := ctr.DB.GetTOTP(userid)
+	switch {
+	case err == nil:
+		data.Enabled = true
+		if data.Remaining, err = ctr.DB.CountRecoveryCodes(userid); err != nil {
+			return fmt.Errorf("error counting recovery codes: %w", err)
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if data.Secret, err = ctr.enrollSecret(c); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		account := user.Email
+		if account == "" {
+			account = user.Name
+		}
+		if data.QR, err = QRCode(auth.TOTPURI(ctr.TOTPIssuer, account, data.Secret)); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	default:
+		return fmt.Errorf("error getting second factor: %w", err)
+	}
+	return c.Render(http.StatusOK, "totp", data)
+}
+
+func (ctr *Controller) EnableTwoFactor(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	secret, err := ctr.Store.GetString(c.Request(), EnrollField)
+	if err != nil || secret == "" {
+		return c.Redirect(http.StatusFound, "/admin/2fa")
+	}
+	step, err := auth.ValidateTOTP(secret, c.FormValue("code"), time.Now(), 0)
+	if err != nil {
+		ctr.Flash(c, sessions.FlashError, "Wrong code, check the time of your device and try again.")
+		return c.Redirect(http.StatusFound, "/admin/2fa")
+	}
+	if err := ctr.DB.SaveTOTP(&models.TOTP{
+		UserID:   user.ID,
+		Secret:   secret,
+		LastStep: step,
+	}); err != nil {
+		return fmt.Errorf("could not save second factor: %w", err)
+	}
+	if err := ctr.Store.SaveString(c.Response(), c.Request(), EnrollField, ""); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return ctr.renderRecoveryCodes(c, user)
+}
+
+// renderRecoveryCodes replaces the recovery codes of user and shows
+// the new ones once.
+func (ctr *Controller) renderRecoveryCodes(c echo.Context, user *models.User) error {
+	codes, hashes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	stored := make([]models.RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		stored[i] = models.RecoveryCode{UserID: user.ID, Hash: hash}
+	}
+	if err := ctr.DB.ReplaceRecoveryCodes(strconv.Itoa(user.ID), stored); err != nil {
+		return fmt.Errorf("could not save recovery codes: %w", err)
+	}
+	data := struct {
+		Codes []string
+		Page
+	}{
+		Codes: codes,
+		Page:  ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "recoverycodes", data)
+}
+
+func (ctr *Controller) RegenerateRecoveryCodes(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	if err := ctr.checkSecondFactor(user, c.FormValue("code"), false); err != nil {
+		ctr.Flash(c, sessions.FlashError, "Wrong code, recovery codes are not changed.")
+		return c.Redirect(http.StatusFound, "/admin/2fa")
+	}
+	return ctr.renderRecoveryCodes(c, user)
+}
+
+func (ctr *Controller) DisableTwoFactor(c echo.Context) error {
+	user, _ := ctr.CurrentUser(c)
+	if ctr.Requires2FA(user) {
+		return echo.NewHTTPError(http.StatusForbidden, "your role requires two-factor authentication")
+	}
+	if err := ctr.checkSecondFactor(user, c.FormValue("code"), false); err != nil {
+		ctr.Flash(c, sessions.FlashError, "Wrong code, two-factor authentication stays on.")
+		return c.Redirect(http.StatusFound, "/admin/2fa")
+	}
+	if err := ctr.DB.DeleteTOTP(strconv.Itoa(user.ID)); err != nil {
+		return fmt.Errorf("could not delete second factor: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, "Two-factor authentication is off.")
+	return c.Redirect(http.StatusFound, "/admin/settings")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/sessions"
+)
+
+func (ctr *Controller) Users(c echo.Context) error {
+	users, err := ctr.DB.GetUsers()
+	if err != nil {
+		return fmt.Errorf("error getting users: %w", err)
+	}
+	for i := range users {
+		users[i].Role = ctr.Role(&users[i])
+	}
+	data := struct {
+		Users   []models.User
+		Roles   []string
+		Current *models.User
+		Page
+	}{
+		Users:   users,
+		Roles:   auth.RoleNames,
+		Current: ctr.ContextUser(c),
+		Page:    ctr.Page(c),
+	}
+	return c.Render(http.StatusOK, "users", data)
+}
+
+func (ctr *Controller) SetRole(c echo.Context) error {
+	role := c.FormValue("role")
+	if !auth.ValidRole(role) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown role")
+	}
+	userid := c.Param("userid")
+	// an admin demoting themselves could leave nobody to manage roles
+	if userid == strconv.Itoa(ctr.ContextUser(c).ID) {
+		return echo.NewHTTPError(http.StatusBadRequest, "you cannot change your own role")
+	}
+	if err := ctr.DB.SetUserRole(userid, role); err != nil {
+		return fmt.Errorf("could not set role: %w", err)
+	}
+	ctr.Flash(c, sessions.FlashSuccess, fmt.Sprintf("Role of user %s is now %s.", userid, role))
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
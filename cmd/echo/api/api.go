@@ -1,21 +1,50 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/moderation"
+	"github.com/vestlog/nix/pkg/slug"
 	"github.com/vestlog/nix/pkg/storage"
 	"gorm.io/gorm/logger"
 )
 
+// DefaultCommentDepth is the depth of comment threads returned by the
+// API if MaxCommentDepth is not set.
+const DefaultCommentDepth = 5
+
 type EchoApi struct {
 	DB storage.Database
+	// MaxCommentDepth limits the depth of comment threads, deeper replies
+	// are returned on the last level.
+	MaxCommentDepth int
+	// DefaultRole is the role of users without one, author if not set.
+	DefaultRole string
+	// EditWindow is how long authors may edit their comments, 0 for always.
+	EditWindow time.Duration
+	// Filters check edited comments; Moderation decides whose edits
+	// are trusted.
+	Filters    *moderation.Pipeline
+	Moderation moderation.Policy
 }
 
+var (
+	ErrInvalidDepth       = errors.New("depth has to be a positive integer")
+	ErrRevisionsForbidden = errors.New("only users who may edit the post can read its revisions")
+)
+
 // GetAllPosts godoc
-// @Summary Get all posts
+// @Summary Get all published posts
+// @Description Get all published posts with their tags and category, or only those with a tag.
 // @Produce json
 // @Produce xml
+// @Param tag query string false "tag name"
 // @Success 200 {array} object
 // @Router /api/v1/posts [get]
 func (api *EchoApi) GetAllPosts(c echo.Context) error {
@@ -23,7 +52,11 @@ func (api *EchoApi) GetAllPosts(c echo.Context) error {
 	var data interface{}
 	var err error
 
-	data, err = api.DB.GetPosts()
+	if tag := c.QueryParam("tag"); tag != "" {
+		data, err = api.DB.GetPostsTag(slug.Make(tag))
+	} else {
+		data, err = api.DB.GetPosts()
+	}
 	if err != nil {
 		status = http.StatusInternalServerError
 		data = ErrMap(err)
@@ -33,30 +66,114 @@ func (api *EchoApi) GetAllPosts(c echo.Context) error {
 
 // GetPost godoc
 // @Summary Get post from ID
-// @Description Get a single post for a given ID
+// @Description Get a single published post for a given ID
 // @Produce json
 // @Produce xml
 // @Param id path int true "post id"
 // @Success 200 {object} object
 // @Router /api/v1/posts/{id} [get]
 func (api *EchoApi) GetPost(c echo.Context) error {
+	post, status, err := api.publishedPost(c.Param("id"))
+	if err != nil {
+		return Encode(c, status, ErrMap(err))
+	}
+	return Encode(c, status, post)
+}
+
+// publishedPost returns the post with id if it is published, otherwise
+// the status to respond with and the error.
+func (api *EchoApi) publishedPost(id string) (*models.Post, int, error) {
+	post, err := api.DB.GetPost(id)
+	if err == nil && !post.Published() {
+		err = logger.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, logger.ErrRecordNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	return post, http.StatusOK, nil
+}
+
+// GetPostComments godoc
+// @Summary Get comment threads of a post
+// @Description Get the comments of a post with their replies nested in Replies.
+// @Description Threads deeper than depth are cut, deeper replies are returned on the last level.
+// @Produce json
+// @Produce xml
+// @Param id path int true "post id"
+// @Param depth query int false "maximum depth, limited by the server"
+// @Success 200 {array} object
+// @Failure 400 {object} object
+// @Router /api/v1/posts/{id}/comments [get]
+func (api *EchoApi) GetPostComments(c echo.Context) error {
 	id := c.Param("id")
-	status := http.StatusOK
-	var data interface{}
+	depth := api.MaxCommentDepth
+	if depth <= 0 {
+		depth = DefaultCommentDepth
+	}
+	if param := c.QueryParam("depth"); param != "" {
+		requested, err := strconv.Atoi(param)
+		if err != nil || requested < 1 {
+			return Encode(c, http.StatusBadRequest, ErrMap(ErrInvalidDepth))
+		}
+		if requested < depth {
+			depth = requested
+		}
+	}
+	if _, status, err := api.publishedPost(id); err != nil {
+		return Encode(c, status, ErrMap(err))
+	}
+	data, err := api.DB.GetCommentTree(id, depth)
+	if err != nil {
+		return Encode(c, http.StatusInternalServerError, ErrMap(err))
+	}
+	return Encode(c, http.StatusOK, data)
+}
 
-	data, err := api.DB.GetPost(id)
+// GetPostRevisions godoc
+// @Summary Get revisions of a post
+// @Description Get the saved versions of the title and body of a post, the oldest first.
+// @Description Needs read scope and a user who may edit the post, as revisions include unpublished versions.
+// @Produce json
+// @Produce xml
+// @Security BearerToken
+// @Param id path int true "post id"
+// @Success 200 {array} object
+// @Failure 401 {object} object
+// @Failure 403 {object} object
+// @Failure 404 {object} object
+// @Router /api/v1/posts/{id}/revisions [get]
+func (api *EchoApi) GetPostRevisions(c echo.Context) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c, "", ErrTokenRequired)
+	}
+	id := c.Param("id")
+	post, err := api.DB.GetPost(id)
+	if errors.Is(err, logger.ErrRecordNotFound) {
+		return Encode(c, http.StatusNotFound, ErrMap(err))
+	}
 	if err != nil {
-		status = http.StatusInternalServerError
-		if err == logger.ErrRecordNotFound {
-			status = http.StatusNotFound
+		return Encode(c, http.StatusInternalServerError, ErrMap(err))
+	}
+	if !auth.CanModify(api.Role(user), user.ID, post.UserID, auth.PermEditOwnPost, auth.PermEditAnyPost) {
+		if !post.Published() {
+			return Encode(c, http.StatusNotFound, ErrMap(logger.ErrRecordNotFound))
 		}
-		data = ErrMap(err)
+		return Encode(c, http.StatusForbidden, ErrMap(ErrRevisionsForbidden))
 	}
-	return Encode(c, status, data)
+	data, err := api.DB.GetPostRevisions(id)
+	if err != nil {
+		return Encode(c, http.StatusInternalServerError, ErrMap(err))
+	}
+	return Encode(c, http.StatusOK, data)
 }
 
 // GetAllComments godoc
 // @Summary Get all comments
+// @Description Get the approved comments of published posts
 // @Produce json
 // @Produce xml
 // @Success 200 {array} object
@@ -75,7 +192,7 @@ func (api *EchoApi) GetAllComments(c echo.Context) error {
 
 // GetComment godoc
 // @Summary Get comment from ID
-// @Description Get a single comment for a given ID
+// @Description Get a single approved comment of a published post for a given ID
 // @Produce json
 // @Produce xml
 // @Param id path int true "comment id"
@@ -86,7 +203,12 @@ func (api *EchoApi) GetComment(c echo.Context) error {
 	status := http.StatusOK
 	var data interface{}
 
-	data, err := api.DB.GetComment(id)
+	comment, err := api.DB.GetComment(id)
+	if err == nil {
+		// comments are public only on published posts
+		_, status, err = api.publishedPost(strconv.Itoa(comment.PostID))
+	}
+	data = comment
 	if err != nil {
 		status = http.StatusInternalServerError
 		if err == logger.ErrRecordNotFound {
@@ -97,6 +219,23 @@ func (api *EchoApi) GetComment(c echo.Context) error {
 	return Encode(c, status, data)
 }
 
+// GetCurrentUser godoc
+// @Summary Get the token owner
+// @Description Get the user of the API token, needs read scope
+// @Produce json
+// @Produce xml
+// @Security BearerToken
+// @Success 200 {object} object
+// @Failure 401 {object} object
+// @Router /api/v1/user [get]
+func (api *EchoApi) GetCurrentUser(c echo.Context) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return Encode(c, http.StatusUnauthorized, ErrMap(ErrTokenRequired))
+	}
+	return Encode(c, http.StatusOK, user)
+}
+
 func Encode(c echo.Context, status int, data interface{}) error {
 	if c.Request().Header.Get("Accept") == "text/xml" {
 		return c.XMLPretty(status, data, " ")
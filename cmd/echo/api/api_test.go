@@ -11,6 +11,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
 	"github.com/vestlog/nix/pkg/models"
 	mock "github.com/vestlog/nix/pkg/storage/mock_storage"
 	"gorm.io/gorm/logger"
@@ -49,6 +50,29 @@ func TestGetPost(t *testing.T) {
 	}
 }
 
+func TestGetPostUnpublished(t *testing.T) {
+	for _, status := range []string{models.PostDraft, models.PostScheduled, models.PostArchived} {
+		ctrl := gomock.NewController(t)
+		m := mock.NewMockDatabase(ctrl)
+		m.EXPECT().GetPost(gomock.Eq("1")).Return(&models.Post{ID: 1, Status: status}, nil)
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		api := &EchoApi{DB: m}
+		if err := api.GetPost(c); err != nil {
+			t.Error(err)
+		}
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s post: got %v, expected %v", status, rec.Code, http.StatusNotFound)
+		}
+		ctrl.Finish()
+	}
+}
+
 func TestGetPostErrNotExist(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -115,6 +139,33 @@ func TestGetAllPosts(t *testing.T) {
 	}
 }
 
+func TestGetAllPostsTag(t *testing.T) {
+	posts := []models.Post{
+		{ID: 1, Title: "tagged", Tags: []models.Tag{{Name: "go-tips"}}},
+	}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockDatabase(ctrl)
+	m.EXPECT().GetPostsTag(gomock.Eq("go-tips")).Return(posts, nil)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/?tag=Go+Tips", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/")
+	api := &EchoApi{DB: m}
+	if err := api.GetAllPosts(c); err != nil {
+		t.Error(err)
+	}
+	var r []models.Post
+	if err := json.NewDecoder(rec.Body).Decode(&r); err != nil {
+		t.Errorf("could not decode json: %v", err)
+	}
+	if !reflect.DeepEqual(posts, r) {
+		t.Errorf("expected %v, got %v", posts, r)
+	}
+}
+
 func TestGetAllPostsErr(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -157,6 +208,7 @@ func TestGetComment(t *testing.T) {
 	defer ctrl.Finish()
 	m := mock.NewMockDatabase(ctrl)
 	m.EXPECT().GetComment(gomock.Eq("1")).Return(comment, nil)
+	m.EXPECT().GetPost(gomock.Eq("1")).Return(&models.Post{ID: 1, Status: models.PostPublished}, nil)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -178,6 +230,32 @@ func TestGetComment(t *testing.T) {
 	}
 }
 
+func TestGetCommentDraftPost(t *testing.T) {
+	comment := &models.Comment{ID: 1, PostID: 2, Body: "text", Status: models.CommentApproved}
+	for _, status := range []string{models.PostDraft, models.PostScheduled, models.PostArchived} {
+		ctrl := gomock.NewController(t)
+		m := mock.NewMockDatabase(ctrl)
+		m.EXPECT().GetComment(gomock.Eq("1")).Return(comment, nil)
+		m.EXPECT().GetPost(gomock.Eq("2")).Return(&models.Post{ID: 2, Status: status}, nil)
+
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		api := &EchoApi{DB: m}
+		if err := api.GetComment(c); err != nil {
+			t.Error(err)
+		}
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("comment on %s post: got %v, expected %v", status, rec.Code, http.StatusNotFound)
+		}
+		ctrl.Finish()
+	}
+}
+
 func TestGetCommentErrNotExist(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -273,3 +351,120 @@ func TestGetAllCommentsErr(t *testing.T) {
 			http.StatusNotFound)
 	}
 }
+
+func TestGetPostComments(t *testing.T) {
+	tree := []*models.CommentNode{
+		{
+			Comment: models.Comment{PostID: 1, ID: 1, Body: "top"},
+			Replies: []*models.CommentNode{
+				{Comment: models.Comment{PostID: 1, ID: 2, Body: "reply"}, Depth: 1},
+			},
+		},
+	}
+	tests := []struct {
+		query  string
+		depth  int
+		status int
+	}{
+		{"", 3, http.StatusOK},
+		{"?depth=2", 2, http.StatusOK},
+		{"?depth=10", 3, http.StatusOK},
+		{"?depth=0", 0, http.StatusBadRequest},
+		{"?depth=x", 0, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		m := mock.NewMockDatabase(ctrl)
+		if test.status == http.StatusOK {
+			m.EXPECT().GetPost(gomock.Eq("1")).Return(&models.Post{ID: 1}, nil)
+			m.EXPECT().GetCommentTree(gomock.Eq("1"), gomock.Eq(test.depth)).Return(tree, nil)
+		}
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/:id/comments")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		api := &EchoApi{
+			DB:              m,
+			MaxCommentDepth: 3,
+		}
+		if err := api.GetPostComments(c); err != nil {
+			t.Error(err)
+		}
+		if rec.Code != test.status {
+			t.Errorf("%q: got %v, expected %v", test.query, rec.Code, test.status)
+		}
+		if test.status == http.StatusOK {
+			var r []struct {
+				ID      int
+				Replies []struct{ ID int }
+			}
+			json.NewDecoder(rec.Body).Decode(&r)
+			if len(r) != 1 || len(r[0].Replies) != 1 || r[0].Replies[0].ID != 2 {
+				t.Errorf("unexpected comments %s", rec.Body)
+			}
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetPostRevisions(t *testing.T) {
+	revisions := []models.PostRevision{
+		{ID: 1, PostID: 1, Title: "old"},
+		{ID: 2, PostID: 1, Title: "new"},
+	}
+	published := &models.Post{ID: 1, UserID: 1, Status: models.PostPublished}
+	draft := &models.Post{ID: 1, UserID: 1, Status: models.PostDraft}
+	tests := []struct {
+		name   string
+		user   *models.User
+		post   *models.Post
+		err    error
+		status int
+	}{
+		{"editor", &models.User{ID: 2, Role: auth.RoleEditor}, published, nil, http.StatusOK},
+		{"author of draft", &models.User{ID: 1}, draft, nil, http.StatusOK},
+		{"other author", &models.User{ID: 2}, published, nil, http.StatusForbidden},
+		{"other author of draft", &models.User{ID: 2}, draft, nil, http.StatusNotFound},
+		{"missing post", &models.User{ID: 2, Role: auth.RoleEditor}, nil, logger.ErrRecordNotFound, http.StatusNotFound},
+		{"no token", nil, nil, nil, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		m := mock.NewMockDatabase(ctrl)
+		api := &EchoApi{DB: m}
+		e := echo.New()
+		e.Use(api.Authenticate)
+		e.GET("/posts/:id/revisions", api.GetPostRevisions, RequireScope(auth.ScopeRead))
+		req := httptest.NewRequest(http.MethodGet, "/posts/1/revisions", nil)
+		if test.user != nil {
+			raw, hash, err := auth.GenerateToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			token := &models.APIToken{ID: 3, User: test.user, Scope: auth.ScopeRead, Hash: hash}
+			m.EXPECT().GetAPIToken(gomock.Eq(hash)).Return(token, nil)
+			m.EXPECT().TouchAPIToken(gomock.Eq(3), gomock.Any()).Return(nil)
+			m.EXPECT().GetPost(gomock.Eq("1")).Return(test.post, test.err)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+raw)
+		}
+		if test.status == http.StatusOK {
+			m.EXPECT().GetPostRevisions(gomock.Eq("1")).Return(revisions, nil)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: got %v, expected %v", test.name, rec.Code, test.status)
+		}
+		if test.status == http.StatusOK {
+			var r []models.PostRevision
+			json.NewDecoder(rec.Body).Decode(&r)
+			if len(r) != 2 || r[1].Title != "new" {
+				t.Errorf("%s: unexpected revisions %s", test.name, rec.Body)
+			}
+		}
+		ctrl.Finish()
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"gorm.io/gorm"
+)
+
+// Context keys set by Authenticate.
+var (
+	UserKey  = "user"
+	TokenKey = "token"
+)
+
+var (
+	ErrInvalidToken      = errors.New("invalid or revoked token")
+	ErrTokenRequired     = errors.New("token required")
+	ErrInsufficientScope = errors.New("token scope is insufficient")
+)
+
+// Authenticate checks "Authorization: Bearer <token>" and attaches the
+// token and its user to the context. Requests without the header
+// continue anonymously; RequireScope rejects them where needed.
+func (api *EchoApi) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Request().Header.Get(echo.HeaderAuthorization)
+		if header == "" {
+			return next(c)
+		}
+		seq := strings.SplitN(header, " ", 2)
+		if len(seq) != 2 || !strings.EqualFold(seq[0], "Bearer") || !auth.LooksLikeToken(seq[1]) {
+			return unauthorized(c, "invalid_token", ErrInvalidToken)
+		}
+		token, err := api.DB.GetAPIToken(auth.HashToken(seq[1]))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return unauthorized(c, "invalid_token", ErrInvalidToken)
+		}
+		if err != nil {
+			return Encode(c, http.StatusInternalServerError, ErrMap(err))
+		}
+		if err := api.DB.TouchAPIToken(token.ID, time.Now()); err != nil {
+			c.Logger().Errorf("could not update token last use: %v", err)
+		}
+		c.Set(TokenKey, token)
+		c.Set(UserKey, token.User)
+		return next(c)
+	}
+}
+
+// RequireScope rejects requests without a token allowing scope.
+// It has to run after Authenticate.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := c.Get(TokenKey).(*models.APIToken)
+			if !ok {
+				return unauthorized(c, "", ErrTokenRequired)
+			}
+			if !auth.ScopeAllows(token.Scope, scope) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate,
+					`Bearer error="insufficient_scope", scope="`+scope+`"`)
+				return Encode(c, http.StatusForbidden, ErrMap(ErrInsufficientScope))
+			}
+			return next(c)
+		}
+	}
+}
+
+// CurrentUser returns the user of the request token, if any.
+func CurrentUser(c echo.Context) (*models.User, bool) {
+	user, ok := c.Get(UserKey).(*models.User)
+	return user, ok && user != nil
+}
+
+func unauthorized(c echo.Context, code string, err error) error {
+	value := "Bearer"
+	if code != "" {
+		value += ` error="` + code + `"`
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, value)
+	return Encode(c, http.StatusUnauthorized, ErrMap(err))
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	mock "github.com/vestlog/nix/pkg/storage/mock_storage"
+	"gorm.io/gorm"
+)
+
+func serveAuthenticated(api *EchoApi, header string, scope string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(api.Authenticate)
+	e.GET("/user", api.GetCurrentUser, RequireScope(scope))
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	if header != "" {
+		req.Header.Set(echo.HeaderAuthorization, header)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthenticate(t *testing.T) {
+	raw, hash, err := auth.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{ID: 1, Name: "name"}
+	token := &models.APIToken{ID: 2, UserID: 1, User: user, Scope: auth.ScopeRead, Hash: hash}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockDatabase(ctrl)
+	m.EXPECT().GetAPIToken(gomock.Eq(hash)).Return(token, nil).Times(2)
+	m.EXPECT().TouchAPIToken(gomock.Eq(2), gomock.Any()).Return(nil).Times(2)
+	api := &EchoApi{
+		DB: m,
+	}
+
+	rec := serveAuthenticated(api, "Bearer "+raw, auth.ScopeRead)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got %v, expected %v: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	rec = serveAuthenticated(api, "Bearer "+raw, auth.ScopeWrite)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("read token on write route: got %v, expected %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAuthenticateRejected(t *testing.T) {
+	raw, hash, _ := auth.GenerateToken()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockDatabase(ctrl)
+	m.EXPECT().GetAPIToken(gomock.Eq(hash)).Return(nil, gorm.ErrRecordNotFound)
+	api := &EchoApi{
+		DB: m,
+	}
+
+	tests := map[string]string{
+		"missing":   "",
+		"malformed": "Bearer nix_short",
+		"scheme":    "Basic " + raw,
+		"revoked":   "Bearer " + raw,
+	}
+	for name, header := range tests {
+		rec := serveAuthenticated(api, header, auth.ScopeRead)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %v, expected %v", name, rec.Code, http.StatusUnauthorized)
+		}
+		if rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+			t.Errorf("%s: WWW-Authenticate header is missing", name)
+		}
+	}
+}
+
+func TestAuthenticateErr(t *testing.T) {
+	raw, hash, _ := auth.GenerateToken()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockDatabase(ctrl)
+	m.EXPECT().GetAPIToken(gomock.Eq(hash)).Return(nil, errors.New("some error"))
+	api := &EchoApi{
+		DB: m,
+	}
+
+	rec := serveAuthenticated(api, "Bearer "+raw, auth.ScopeRead)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got %v, expected %v", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/moderation"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrForbidden = errors.New("not allowed to change this comment")
+	ErrEmptyBody = errors.New("body cannot be empty")
+)
+
+// CommentUpdate is the request body of comment updates.
+type CommentUpdate struct {
+	Body string
+}
+
+// Role returns the role of user, DefaultRole if it has none.
+func (api *EchoApi) Role(user *models.User) string {
+	if user.Role != "" {
+		return user.Role
+	}
+	if api.DefaultRole != "" {
+		return api.DefaultRole
+	}
+	return auth.RoleAuthor
+}
+
+func (api *EchoApi) comment(c echo.Context) (*models.Comment, error) {
+	comment, err := api.DB.GetComment(c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, Encode(c, http.StatusNotFound, ErrMap(err))
+	}
+	if err != nil {
+		return nil, Encode(c, http.StatusInternalServerError, ErrMap(err))
+	}
+	return comment, nil
+}
+
+func commentOwner(comment *models.Comment) int {
+	if comment.UserID == nil {
+		return 0
+	}
+	return *comment.UserID
+}
+
+// UpdateComment godoc
+// @Summary Update a comment
+// @Description Change the body of a comment. Authors may edit their comments within the edit window, admins always.
+// @Description Edits pass the content filters again and may need approval.
+// @Accept json
+// @Produce json
+// @Produce xml
+// @Security BearerToken
+// @Param id path int true "comment id"
+// @Param comment body CommentUpdate true "new body"
+// @Success 200 {object} object
+// @Failure 400 {object} object
+// @Failure 403 {object} object
+// @Failure 404 {object} object
+// @Router /api/v1/comments/{id} [put]
+func (api *EchoApi) UpdateComment(c echo.Context) error {
+	user, _ := CurrentUser(c)
+	update := new(CommentUpdate)
+	if err := c.Bind(update); err != nil {
+		return Encode(c, http.StatusBadRequest, ErrMap(err))
+	}
+	if update.Body == "" {
+		return Encode(c, http.StatusBadRequest, ErrMap(ErrEmptyBody))
+	}
+	comment, err := api.comment(c)
+	if comment == nil {
+		return err
+	}
+	role := api.Role(user)
+	now := time.Now()
+	if !auth.CanModifyWithin(role, user.ID, commentOwner(comment),
+		auth.PermEditOwnComment, auth.PermEditAnyComment, comment.CreatedAt, now, api.EditWindow) {
+		return Encode(c, http.StatusForbidden, ErrMap(ErrForbidden))
+	}
+	forget := moderation.Tokenize(comment.Body)
+	if err := api.Filters.Edit(comment, update.Body, api.Moderation.Trusted(role), now); err != nil {
+		return Encode(c, http.StatusInternalServerError, ErrMap(err))
+	}
+	if err := api.DB.UpdateComment(comment, forget); err != nil {
+		return Encode(c, http.StatusInternalServerError, ErrMap(err))
+	}
+	return Encode(c, http.StatusOK, comment)
+}
+
+// DeleteComment godoc
+// @Summary Delete a comment
+// @Description Move a comment with its replies to the trash, where admins restore or purge it. Authors may delete their comments, admins any.
+// @Produce json
+// @Produce xml
+// @Security BearerToken
+// @Param id path int true "comment id"
+// @Success 204
+// @Failure 403 {object} object
+// @Failure 404 {object} object
+// @Router /api/v1/comments/{id} [delete]
+func (api *EchoApi) DeleteComment(c echo.Context) error {
+	user, _ := CurrentUser(c)
+	comment, err := api.comment(c)
+	if comment == nil {
+		return err
+	}
+	if !auth.CanModify(api.Role(user), user.ID, commentOwner(comment),
+		auth.PermDeleteOwnComment, auth.PermDeleteAnyComment) {
+		return Encode(c, http.StatusForbidden, ErrMap(ErrForbidden))
+	}
+	if err := api.DB.DeleteComment(strconv.Itoa(comment.ID)); err != nil {
+		return Encode(c, http.StatusInternalServerError, ErrMap(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	mock "github.com/vestlog/nix/pkg/storage/mock_storage"
+)
+
+func serveComment(api *EchoApi, method string, raw string, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(api.Authenticate)
+	e.PUT("/comments/:id", api.UpdateComment, RequireScope(auth.ScopeWrite))
+	e.DELETE("/comments/:id", api.DeleteComment, RequireScope(auth.ScopeWrite))
+	req := httptest.NewRequest(method, "/comments/7", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+raw)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUpdateDeleteComment(t *testing.T) {
+	owner := 1
+	tests := []struct {
+		name    string
+		method  string
+		user    *models.User
+		scope   string
+		created time.Time
+		status  int
+	}{
+		{"author edits", http.MethodPut, &models.User{ID: 1}, auth.ScopeWrite, time.Now(), http.StatusOK},
+		{"author edits late", http.MethodPut, &models.User{ID: 1}, auth.ScopeWrite, time.Now().Add(-time.Hour), http.StatusForbidden},
+		{"admin edits late", http.MethodPut, &models.User{ID: 2, Role: auth.RoleAdmin}, auth.ScopeWrite, time.Now().Add(-time.Hour), http.StatusOK},
+		{"other user edits", http.MethodPut, &models.User{ID: 2}, auth.ScopeWrite, time.Now(), http.StatusForbidden},
+		{"read token edits", http.MethodPut, &models.User{ID: 1}, auth.ScopeRead, time.Now(), http.StatusForbidden},
+		{"author deletes late", http.MethodDelete, &models.User{ID: 1}, auth.ScopeWrite, time.Now().Add(-time.Hour), http.StatusNoContent},
+		{"other user deletes", http.MethodDelete, &models.User{ID: 2, Role: auth.RoleEditor}, auth.ScopeWrite, time.Now(), http.StatusForbidden},
+	}
+	for _, test := range tests {
+		raw, hash, err := auth.GenerateToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := &models.APIToken{ID: 3, User: test.user, Scope: test.scope, Hash: hash}
+		comment := &models.Comment{ID: 7, PostID: 1, UserID: &owner, Body: "old",
+			Status: models.CommentApproved, CreatedAt: test.created}
+
+		ctrl := gomock.NewController(t)
+		m := mock.NewMockDatabase(ctrl)
+		m.EXPECT().GetAPIToken(gomock.Eq(hash)).Return(token, nil)
+		m.EXPECT().TouchAPIToken(gomock.Eq(3), gomock.Any()).Return(nil)
+		if test.scope == auth.ScopeWrite {
+			m.EXPECT().GetComment(gomock.Eq("7")).Return(comment, nil)
+		}
+		switch {
+		case test.status == http.StatusOK:
+			m.EXPECT().UpdateComment(gomock.Any(), gomock.Any()).Return(nil)
+		case test.status == http.StatusNoContent:
+			m.EXPECT().DeleteComment(gomock.Eq("7")).Return(nil)
+		}
+		api := &EchoApi{DB: m, EditWindow: 15 * time.Minute}
+		rec := serveComment(api, test.method, raw, `{"Body": "new"}`)
+		if rec.Code != test.status {
+			t.Errorf("%s: got %d, expected %d: %s", test.name, rec.Code, test.status, rec.Body)
+		}
+		if test.status == http.StatusOK && (comment.Body != "new" || comment.EditedAt == nil) {
+			t.Errorf("%s: comment is not edited: %+v", test.name, comment)
+		}
+		ctrl.Finish()
+	}
+}
@@ -26,6 +26,7 @@ var doc = `{
     "paths": {
         "/api/v1/comments": {
             "get": {
+                "description": "Get the approved comments of published posts",
                 "produces": [
                     "application/json",
                     "text/xml"
@@ -46,7 +47,7 @@ var doc = `{
         },
         "/api/v1/comments/{id}": {
             "get": {
-                "description": "Get a single comment for a given ID",
+                "description": "Get a single approved comment of a published post for a given ID",
                 "produces": [
                     "application/json",
                     "text/xml"
@@ -69,15 +70,123 @@ var doc = `{
                         }
                     }
                 }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Change the body of a comment. Authors may edit their comments within the edit window, admins always.\nEdits pass the content filters again and may need approval.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml"
+                ],
+                "summary": "Update a comment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "comment id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "new body",
+                        "name": "comment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CommentUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Move a comment with its replies to the trash, where admins restore or purge it. Authors may delete their comments, admins any.",
+                "produces": [
+                    "application/json",
+                    "text/xml"
+                ],
+                "summary": "Delete a comment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "comment id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": ""
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                }
             }
         },
         "/api/v1/posts": {
             "get": {
+                "description": "Get all published posts with their tags and category, or only those with a tag.",
                 "produces": [
                     "application/json",
                     "text/xml"
                 ],
-                "summary": "Get all posts",
+                "summary": "Get all published posts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "tag name",
+                        "name": "tag",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -93,7 +202,7 @@ var doc = `{
         },
         "/api/v1/posts/{id}": {
             "get": {
-                "description": "Get a single post for a given ID",
+                "description": "Get a single published post for a given ID",
                 "produces": [
                     "application/json",
                     "text/xml"
@@ -117,6 +226,147 @@ var doc = `{
                     }
                 }
             }
+        },
+        "/api/v1/posts/{id}/comments": {
+            "get": {
+                "description": "Get the comments of a post with their replies nested in Replies.\nThreads deeper than depth are cut, deeper replies are returned on the last level.",
+                "produces": [
+                    "application/json",
+                    "text/xml"
+                ],
+                "summary": "Get comment threads of a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "post id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum depth, limited by the server",
+                        "name": "depth",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "object"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/posts/{id}/revisions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get the saved versions of the title and body of a post, the oldest first.\nNeeds read scope and a user who may edit the post, as revisions include unpublished versions.",
+                "produces": [
+                    "application/json",
+                    "text/xml"
+                ],
+                "summary": "Get revisions of a post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "post id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "object"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get the user of the API token, needs read scope",
+                "produces": [
+                    "application/json",
+                    "text/xml"
+                ],
+                "summary": "Get the token owner",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.CommentUpdate": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerToken": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -1,18 +1,25 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
 
 	"github.com/vestlog/nix/cmd/echo/api"
 	_ "github.com/vestlog/nix/cmd/echo/docs"
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/moderation"
 	"github.com/vestlog/nix/pkg/storage"
 )
 
 var (
-	dsn = "storage.db"
+	dsn          = "storage.db"
+	commentDepth = flag.Int("depth", api.DefaultCommentDepth, "maximum depth of comment threads")
+	editWindow   = flag.Duration("edit-window", 15*time.Minute, "how long authors may edit their comments, 0 for always")
+	defaultRole  = flag.String("default-role", auth.RoleAuthor, "role of users without one")
 )
 
 // @title NIX echo API
@@ -20,22 +27,41 @@ var (
 // @description This is a sample server.
 // @host localhost:8080
 // @BasePath /api/v1/
+// @securityDefinitions.apikey BearerToken
+// @in header
+// @name Authorization
 func main() {
+	flag.Parse()
 	db, err := storage.CreateGormDatabase(dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
+	filters, err := moderation.FilterConfig{}.Pipeline(db)
+	if err != nil {
+		log.Fatal(err)
+	}
 	a := &api.EchoApi{
-		DB: db,
+		DB:              db,
+		MaxCommentDepth: *commentDepth,
+		DefaultRole:     *defaultRole,
+		EditWindow:      *editWindow,
+		Filters:         filters,
+		Moderation:      moderation.DefaultPolicy,
 	}
 	e := echo.New()
 	// e.Debug = true
 	// e.Use(middleware.Logger())
+	e.Use(a.Authenticate)
 
 	e.GET("/api/v1/posts", a.GetAllPosts)
 	e.GET("/api/v1/posts/:id", a.GetPost)
+	e.GET("/api/v1/posts/:id/comments", a.GetPostComments)
+	e.GET("/api/v1/posts/:id/revisions", a.GetPostRevisions, api.RequireScope(auth.ScopeRead))
 	e.GET("/api/v1/comments", a.GetAllComments)
 	e.GET("/api/v1/comments/:id", a.GetComment)
+	e.PUT("/api/v1/comments/:id", a.UpdateComment, api.RequireScope(auth.ScopeWrite))
+	e.DELETE("/api/v1/comments/:id", a.DeleteComment, api.RequireScope(auth.ScopeWrite))
+	e.GET("/api/v1/user", a.GetCurrentUser, api.RequireScope(auth.ScopeRead))
 	e.GET("/api/v1/swagger/*", echoSwagger.WrapHandler)
 
 	e.Logger.Fatal(e.Start(":8080"))
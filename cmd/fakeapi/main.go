@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/vestlog/nix/pkg/fakeapi"
+)
+
+var (
+	addr = flag.String("addr", ":8081", "address to listen on")
+	opts = fakeapi.DefaultOptions
+)
+
+func main() {
+	flag.IntVar(&opts.Users, "users", opts.Users, "number of users")
+	flag.IntVar(&opts.PostsPerUser, "posts", opts.PostsPerUser, "posts per user")
+	flag.IntVar(&opts.CommentsPerPost, "comments", opts.CommentsPerPost, "comments per post")
+	flag.Int64Var(&opts.Seed, "seed", opts.Seed, "seed for generated data and faults")
+	flag.DurationVar(&opts.Latency, "latency", 0, "delay before every response")
+	flag.Float64Var(&opts.ErrorRate, "errors", 0, "share of requests answered with 500")
+	flag.Float64Var(&opts.RateLimitRate, "ratelimit", 0, "share of requests answered with 429")
+	flag.Float64Var(&opts.MalformedRate, "malformed", 0, "share of responses with truncated JSON")
+	flag.Parse()
+
+	log.Println("Starting fake API on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, fakeapi.NewServer(opts)))
+}
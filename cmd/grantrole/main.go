@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/storage"
+)
+
+var (
+	dsn      = flag.String("dsn", "storage.db?_foreign_keys=ON", "DSN of the webserver database")
+	userID   = flag.Int("user", 0, "ID of the user")
+	email    = flag.String("email", "", "email of the user, if -user is not given")
+	username = flag.String("username", "", "username of a local account, if -user is not given")
+	role     = flag.String("role", "", "role to grant: "+strings.Join(auth.RoleNames, ", "))
+	list     = flag.Bool("list", false, "list users and their roles")
+)
+
+func main() {
+	flag.Parse()
+	db, err := storage.CreateGormDatabase(*dsn)
+	if err != nil {
+		log.Fatal("Could not create DB connection:", err)
+	}
+	if err := db.CreateTables(); err != nil {
+		log.Fatal(err)
+	}
+	if *list {
+		users, err := db.GetUsers()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, user := range users {
+			fmt.Printf("%d\t%s\t%s\t%s\n", user.ID, user.Role, user.Email, user.Name)
+		}
+		return
+	}
+	if !auth.ValidRole(*role) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	user, err := findUser(db)
+	if err != nil {
+		log.Fatal("Could not find user: ", err)
+	}
+	if err := db.SetUserRole(strconv.Itoa(user.ID), *role); err != nil {
+		log.Fatal("Could not set role: ", err)
+	}
+	fmt.Printf("%s <%s> is now %s\n", user.Name, user.Email, *role)
+}
+
+func findUser(db *storage.GormDatabase) (*models.User, error) {
+	switch {
+	case *userID != 0:
+		return db.GetUser(strconv.Itoa(*userID))
+	case *email != "":
+		return db.GetUserEmail(*email)
+	case *username != "":
+		credential, err := db.GetCredential(*username)
+		if err != nil {
+			return nil, err
+		}
+		return credential.User, nil
+	}
+	return nil, fmt.Errorf("one of -user, -email or -username is required")
+}
@@ -1,27 +1,30 @@
 package main
 
 import (
+	"flag"
 	"log"
-	"sync"
 
-	cl "github.com/vestlog/nix/pkg/client"
-	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/source"
 	"github.com/vestlog/nix/pkg/storage"
 )
 
 var (
 	baseurl = "https://jsonplaceholder.typicode.com/"
-	dsn     = "storage.db"
-	userID  = 7
+
+	kind   = flag.String("source", source.KindAPI, "source kind: api, json, csv or db")
+	from   = flag.String("from", baseurl, "API URL, JSON dump, CSV directory or DSN to import from")
+	dsn    = flag.String("dsn", "storage.db", "DSN of the database to import into")
+	userID = flag.Int("user", 7, "import posts of this user, 0 for all users")
 )
 
 func main() {
-	client, err := cl.CreateAPIClient(dsn, baseurl)
+	flag.Parse()
+	src, err := source.Open(*kind, *from)
 	if err != nil {
-		log.Fatal("Error creating client:", err)
+		log.Fatal("Error creating source:", err)
 	}
 	// db, err := nix.CreateSQLiteDatabase(dsn)
-	db, err := storage.CreateGormDatabase(dsn)
+	db, err := storage.CreateGormDatabase(*dsn)
 	if err != nil {
 		log.Fatal("Could not create DB connection:", err)
 	}
@@ -29,33 +32,7 @@ func main() {
 	if err := db.CreateTables(); err != nil {
 		log.Fatal(err)
 	}
-	posts, err := client.GetPosts(userID)
-	if err != nil {
-		log.Fatal("Error getting posts:", err)
-	}
-	wg := &sync.WaitGroup{}
-	for _, post := range posts {
-		if err := db.SavePost(&post); err != nil {
-			log.Fatal("Could not save post:", err)
-		}
-		wg.Add(1)
-		go func(post models.Post) {
-			defer wg.Done()
-			comments, err := client.GetComments(post.ID)
-			if err != nil {
-				log.Fatal(err)
-			}
-			for _, comment := range comments {
-				wg.Add(1)
-				go func(comment models.Comment) {
-					defer wg.Done()
-					if err := db.SaveComment(&comment); err != nil {
-						log.Println(err)
-						return
-					}
-				}(comment)
-			}
-		}(post)
+	if err := source.Import(src, db, *userID); err != nil {
+		log.Fatal(err)
 	}
-	wg.Wait()
 }
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/vestlog/nix/pkg/models"
 	"github.com/vestlog/nix/pkg/storage"
+	"gorm.io/gorm"
 )
 
 type API struct {
@@ -30,7 +33,12 @@ func (api *API) handlePosts(w http.ResponseWriter, r *http.Request) {
 	var data interface{}
 	var err error
 	if len(seq) > 2 && seq[2] != "" {
-		data, err = api.db.GetPost(seq[2])
+		var post *models.Post
+		post, err = api.db.GetPost(seq[2])
+		if err == nil && !post.Published() {
+			err = gorm.ErrRecordNotFound
+		}
+		data = post
 	} else {
 		data, err = api.db.GetPosts()
 	}
@@ -45,7 +53,16 @@ func (api *API) handleComments(w http.ResponseWriter, r *http.Request) {
 	var data interface{}
 	var err error
 	if len(seq) > 2 && seq[2] != "" {
-		data, err = api.db.GetComment(seq[2])
+		var comment *models.Comment
+		comment, err = api.db.GetComment(seq[2])
+		if err == nil {
+			var post *models.Post
+			post, err = api.db.GetPost(strconv.Itoa(comment.PostID))
+			if err == nil && !post.Published() {
+				err = gorm.ErrRecordNotFound
+			}
+		}
+		data = comment
 	} else {
 		data, err = api.db.GetComments()
 	}
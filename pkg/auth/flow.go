@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Flow is the state of one login attempt, kept in the session between
+// the redirect to the provider and the callback.
+type Flow struct {
+	Provider string
+	State    string
+	Nonce    string
+	// Verifier is the PKCE code verifier (RFC 7636).
+	Verifier string
+	// Link adds the account to the signed in user instead of signing in.
+	Link    bool
+	Expires time.Time
+}
+
+var FlowLifetime = 10 * time.Minute
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error: could not rand.Read: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewFlow generates state, nonce and code verifier for a login.
+func NewFlow(provider string, link bool) (*Flow, error) {
+	flow := &Flow{
+		Provider: provider,
+		Link:     link,
+		Expires:  time.Now().Add(FlowLifetime),
+	}
+	for _, field := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		value, err := randomString(32)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+	}
+	return flow, nil
+}
+
+func (f *Flow) Expired() bool {
+	return time.Now().After(f.Expires)
+}
+
+// S256Challenge returns the PKCE code challenge for a verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyChallenge reports whether verifier matches an S256 challenge.
+func VerifyChallenge(verifier string, challenge string) bool {
+	expected := S256Challenge(verifier)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func (f *Flow) authURLOptions(oidc bool) []oauth2.AuthCodeOption {
+	options := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", S256Challenge(f.Verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if oidc {
+		options = append(options, oauth2.SetAuthURLParam("nonce", f.Nonce))
+	}
+	return options
+}
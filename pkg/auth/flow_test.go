@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestS256Challenge(t *testing.T) {
+	// example from RFC 7636, appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if result := S256Challenge(verifier); result != challenge {
+		t.Errorf("expected %s, got %s", challenge, result)
+	}
+	if !VerifyChallenge(verifier, challenge) {
+		t.Error("verifier does not match its challenge")
+	}
+	if VerifyChallenge(verifier+"x", challenge) {
+		t.Error("wrong verifier matches challenge")
+	}
+}
+
+func TestNewFlow(t *testing.T) {
+	a, err := NewFlow("google", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewFlow("google", false)
+	if a.State == b.State || a.Nonce == b.Nonce || a.Verifier == b.Verifier {
+		t.Error("flows share random values")
+	}
+	if len(a.Verifier) < 43 {
+		t.Errorf("verifier is too short: %d", len(a.Verifier))
+	}
+	if a.Expired() {
+		t.Error("new flow is expired")
+	}
+	a.Expires = time.Now().Add(-time.Second)
+	if !a.Expired() {
+		t.Error("flow is not expired")
+	}
+}
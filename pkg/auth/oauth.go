@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"golang.org/x/oauth2"
 )
@@ -13,36 +14,124 @@ const (
 	GoogleInfoURL   = "https://openidconnect.googleapis.com/v1/userinfo"
 )
 
+// UserInfo is the provider-independent identity returned after login.
+type UserInfo struct {
+	ID            string
+	Email         string
+	Name          string
+	EmailVerified bool
+}
+
 type OAuth struct {
-	Conf    *oauth2.Config
-	InfoURL string
+	Name       string
+	Conf       *oauth2.Config
+	InfoURL    string
+	Fields     map[string]string
+	TrustEmail bool
+	// Verifier is set for OpenID Connect providers.
+	Verifier *Verifier
 }
 
-func (a *OAuth) GetAuthURL(state string) string {
-	url := a.Conf.AuthCodeURL(state)
+// GetAuthURL returns the provider login URL with the state and PKCE
+// challenge of the flow. The nonce is only sent to OpenID Connect providers.
+func (a *OAuth) GetAuthURL(flow *Flow) string {
+	url := a.Conf.AuthCodeURL(flow.State, flow.authURLOptions(a.Verifier != nil)...)
 	return url
 }
 
-func (a *OAuth) GetUserData(ctx context.Context, code string) (map[string]interface{}, error) {
-	token, err := a.Conf.Exchange(context.Background(), code)
-	if err != nil {
-		return nil, fmt.Errorf("error: could not exchange code for token: %w", err)
-	}
+func (a *OAuth) GetUserData(ctx context.Context, token *oauth2.Token) (map[string]interface{}, error) {
 	client := a.Conf.Client(ctx, token)
 	resp, err := client.Get(a.InfoURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	// sub(id), name, email
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error: userinfo returned %s", resp.Status)
+	}
 	data := make(map[string]interface{})
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
 		return nil, err
 	}
-	// fix for data from google, where "sub" field is used instead of "id"
-	if _, ok := data["id"]; !ok {
-		data["id"] = data["sub"]
-		delete(data, "sub")
-	}
 	return data, nil
 }
+
+// GetUserInfo exchanges code for a token using the flow's PKCE verifier
+// and returns the identity. For OpenID Connect providers it comes from
+// the verified ID token, otherwise the userinfo response is mapped
+// using Fields.
+func (a *OAuth) GetUserInfo(ctx context.Context, code string, flow *Flow) (*UserInfo, error) {
+	token, err := a.Conf.Exchange(ctx, code,
+		oauth2.SetAuthURLParam("code_verifier", flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error: could not exchange code for token: %w", err)
+	}
+	if a.Verifier != nil {
+		return a.verifiedUserInfo(ctx, token, flow.Nonce)
+	}
+	data, err := a.GetUserData(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return a.mapUserInfo(data)
+}
+
+func (a *OAuth) verifiedUserInfo(ctx context.Context, token *oauth2.Token, nonce string) (*UserInfo, error) {
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidToken)
+	}
+	claims, err := a.Verifier.Verify(ctx, raw, nonce)
+	if err != nil {
+		return nil, err
+	}
+	info := claims.UserInfo()
+	if info.Email != "" || a.InfoURL == "" {
+		return info, nil
+	}
+	// some providers only put profile claims into the userinfo response
+	data, err := a.GetUserData(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	extra, err := a.mapUserInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if extra.ID != info.ID {
+		return nil, fmt.Errorf("error: userinfo subject does not match ID token")
+	}
+	return extra, nil
+}
+
+func (a *OAuth) mapUserInfo(data map[string]interface{}) (*UserInfo, error) {
+	info := &UserInfo{
+		ID:    a.field(data, "id"),
+		Email: a.field(data, "email"),
+		Name:  a.field(data, "name"),
+	}
+	verified := a.field(data, "email_verified")
+	info.EmailVerified = info.Email != "" && (a.TrustEmail || verified == "true")
+	if info.ID == "" {
+		return nil, fmt.Errorf("error: %s userinfo has no %q field", a.Name, a.Fields["id"])
+	}
+	return info, nil
+}
+
+func (a *OAuth) field(data map[string]interface{}, name string) string {
+	key, ok := a.Fields[name]
+	if !ok {
+		key = name
+	}
+	switch value := data[key].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return fmt.Sprint(value)
+	}
+	return ""
+}
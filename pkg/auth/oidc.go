@@ -0,0 +1,376 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid ID token")
+
+	// DiscoveryClient is used for discovery documents and key sets.
+	DiscoveryClient = &http.Client{
+		Timeout: 10 * time.Second,
+	}
+)
+
+// Discovery is the subset of an OpenID provider configuration used here.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover reads <issuer>/.well-known/openid-configuration.
+func Discover(ctx context.Context, issuer string) (*Discovery, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	doc := &Discovery{}
+	if err := getJSON(ctx, url, doc); err != nil {
+		return nil, fmt.Errorf("error: could not discover %s: %w", issuer, err)
+	}
+	if doc.Issuer != issuer {
+		return nil, fmt.Errorf("error: discovery issuer %q does not match %q", doc.Issuer, issuer)
+	}
+	return doc, nil
+}
+
+func getJSON(ctx context.Context, url string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := DiscoveryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// audience is the "aud" claim, which is either a string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// flexBool accepts both true and "true", as some providers send strings.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	*b = flexBool(string(bytes.Trim(data, `"`)) == "true")
+	return nil
+}
+
+// Claims are the standard claims of an ID token.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	GivenName         string   `json:"given_name"`
+	FamilyName        string   `json:"family_name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// UserInfo maps the standard claims to a provider-independent identity.
+func (c *Claims) UserInfo() *UserInfo {
+	name := c.Name
+	if name == "" {
+		name = strings.TrimSpace(c.GivenName + " " + c.FamilyName)
+	}
+	if name == "" {
+		name = c.PreferredUsername
+	}
+	return &UserInfo{
+		ID:            c.Subject,
+		Email:         c.Email,
+		Name:          name,
+		EmailVerified: c.Email != "" && bool(c.EmailVerified),
+	}
+}
+
+// Verifier checks ID tokens of one provider. Keys are fetched from
+// JWKSURL on first use and again when a token has an unknown key ID,
+// at most once per KeysRefresh.
+type Verifier struct {
+	Issuer   string
+	ClientID string
+	JWKSURL  string
+	// Leeway allows for clock skew when checking expiry.
+	Leeway time.Duration
+	Now    func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+var KeysRefresh = time.Minute
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verify checks signature, issuer, audience, expiry and nonce
+// of a raw ID token.
+func (v *Verifier) Verify(ctx context.Context, raw string, nonce string) (*Claims, error) {
+	seq := strings.Split(raw, ".")
+	if len(seq) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	header := &tokenHeader{}
+	if err := decodeSegment(seq[0], header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(seq[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %v", ErrInvalidToken, err)
+	}
+	key, err := v.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Algorithm, key, []byte(seq[0]+"."+seq[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	claims := &Claims{}
+	if err := decodeSegment(seq[1], claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(claims, nonce); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+func (v *Verifier) checkClaims(claims *Claims, nonce string) error {
+	if claims.Issuer != v.Issuer {
+		return fmt.Errorf("issuer %q is not %q", claims.Issuer, v.Issuer)
+	}
+	if !claims.Audience.contains(v.ClientID) {
+		return fmt.Errorf("token is not issued for %q", v.ClientID)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != v.ClientID {
+		return fmt.Errorf("authorized party %q is not %q", claims.AuthorizedParty, v.ClientID)
+	}
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	if time.Unix(claims.Expiry, 0).Add(v.Leeway).Before(now()) {
+		return fmt.Errorf("token is expired")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return fmt.Errorf("nonce does not match")
+	}
+	if claims.Subject == "" {
+		return fmt.Errorf("token has no subject")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.keys[kid]; ok || time.Since(v.fetched) < KeysRefresh {
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown key ID %q", ErrInvalidToken, kid)
+		}
+		return key, nil
+	}
+	keys, err := FetchKeys(ctx, v.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+	v.fetched = time.Now()
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key ID %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// FetchKeys reads RSA and EC signing keys of a JSON Web Key Set by key ID.
+// Keys of other types are skipped.
+func FetchKeys(ctx context.Context, url string) (map[string]crypto.PublicKey, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := getJSON(ctx, url, &set); err != nil {
+		return nil, fmt.Errorf("error: could not get key set: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("error: key %q: %w", jwk.KeyID, err)
+		}
+		if key != nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	return keys, nil
+}
+
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, nil
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// algorithms are the accepted signature algorithms. HMAC and "none"
+// are deliberately missing.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	hashType, ok := algorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hashType.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hashType, digest, signature)
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("malformed signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("signature is not valid")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testProvider is a stand-in OpenID provider which signs ID tokens
+// with keys generated for the test.
+type testProvider struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	// claims of the ID token returned by the token endpoint
+	claims map[string]interface{}
+	// challenge is the PKCE challenge the token request has to match
+	challenge string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{rsaKey: rsaKey, ecKey: ecKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			UserinfoEndpoint:      p.URL + "/userinfo",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":            p.claims["sub"],
+			"email":          "info@example.com",
+			"email_verified": true,
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := func(n *big.Int) string {
+			return base64.RawURLEncoding.EncodeToString(n.Bytes())
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA", "kid": "rsa", "use": "sig",
+					"n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E))),
+				},
+				{
+					"kty": "EC", "kid": "ec", "crv": "P-256",
+					"x": encode(ecKey.X), "y": encode(ecKey.Y),
+				},
+				{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if !VerifyChallenge(r.FormValue("code_verifier"), p.challenge) {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token",
+			"token_type":   "Bearer",
+			"id_token":     p.sign(t, "RS256", "rsa", p.claims),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	p.claims = p.validClaims()
+	return p
+}
+
+func (p *testProvider) validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            p.URL,
+		"sub":            "subject",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "nonce",
+		"email":          "mail@example.com",
+		"email_verified": true,
+		"given_name":     "John",
+		"family_name":    "Smith",
+	}
+}
+
+func (p *testProvider) sign(t *testing.T, alg string, kid string, claims map[string]interface{}) string {
+	segment := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(map[string]string{"alg": alg, "kid": kid}) + "." + segment(claims)
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, h.Sum(nil))
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, p.ecKey, h.Sum(nil))
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *testProvider) verifier() *Verifier {
+	return &Verifier{
+		Issuer:   p.URL,
+		ClientID: "client",
+		JWKSURL:  p.URL + "/jwks",
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p := newTestProvider(t)
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa", "ES256": "ec"}[alg]
+		claims, err := p.verifier().Verify(context.Background(), p.sign(t, alg, kid, p.claims), "nonce")
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		expected := &UserInfo{
+			ID:            "subject",
+			Email:         "mail@example.com",
+			Name:          "John Smith",
+			EmailVerified: true,
+		}
+		if info := claims.UserInfo(); !reflect.DeepEqual(expected, info) {
+			t.Errorf("%s: expected %v, got %v", alg, expected, info)
+		}
+	}
+}
+
+func TestVerifyIDTokenInvalid(t *testing.T) {
+	p := newTestProvider(t)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := &testProvider{rsaKey: other}
+	modified := func(key string, value interface{}) map[string]interface{} {
+		claims := p.validClaims()
+		claims[key] = value
+		return claims
+	}
+	tokens := map[string]string{
+		"wrong issuer":   p.sign(t, "RS256", "rsa", modified("iss", "https://evil.example.com")),
+		"wrong audience": p.sign(t, "RS256", "rsa", modified("aud", "other")),
+		"many audiences": p.sign(t, "RS256", "rsa", modified("aud", []string{"client", "other"})),
+		"expired":        p.sign(t, "RS256", "rsa", modified("exp", time.Now().Add(-time.Hour).Unix())),
+		"wrong nonce":    p.sign(t, "RS256", "rsa", modified("nonce", "replayed")),
+		"forged":         forged.sign(t, "RS256", "rsa", p.claims),
+		"unknown key":    p.sign(t, "RS256", "missing", p.claims),
+		"key mismatch":   p.sign(t, "RS256", "ec", p.claims),
+		"alg none":       "eyJhbGciOiJub25lIiwia2lkIjoicnNhIn0.e30.",
+		"malformed":      "not a token",
+	}
+	for name, token := range tokens {
+		if _, err := p.verifier().Verify(context.Background(), token, "nonce"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestOpenIDProviderDiscovery(t *testing.T) {
+	p := newTestProvider(t)
+	r, err := CreateRegistry("http://localhost", []ProviderConfig{{
+		Name:     "local",
+		ClientID: "client",
+		Issuer:   p.URL,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, _ := r.Get("local")
+	if provider.Conf.Endpoint.TokenURL != p.URL+"/token" || provider.Verifier == nil {
+		t.Fatalf("provider is not discovered: %v", provider.Conf.Endpoint)
+	}
+	flow, err := NewFlow("local", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login, err := url.Parse(provider.GetAuthURL(flow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := login.Query()
+	if query.Get("state") != flow.State || query.Get("nonce") != flow.Nonce ||
+		query.Get("code_challenge_method") != "S256" {
+		t.Errorf("unexpected login URL %s", login)
+	}
+	p.challenge = query.Get("code_challenge")
+	p.claims["nonce"] = flow.Nonce
+	info, err := provider.GetUserInfo(context.Background(), "code", flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "subject" || !info.EmailVerified {
+		t.Errorf("unexpected user info %v", info)
+	}
+	wrongNonce := *flow
+	wrongNonce.Nonce = "other"
+	if _, err := provider.GetUserInfo(context.Background(), "code", &wrongNonce); err == nil {
+		t.Error("expected error for wrong nonce")
+	}
+	wrongVerifier := *flow
+	wrongVerifier.Verifier = "other"
+	if _, err := provider.GetUserInfo(context.Background(), "code", &wrongVerifier); err == nil {
+		t.Error("expected error for wrong code verifier")
+	}
+}
+
+func TestOpenIDUserInfoFallback(t *testing.T) {
+	p := newTestProvider(t)
+	delete(p.claims, "email")
+	delete(p.claims, "email_verified")
+	r, err := CreateRegistry("http://localhost", []ProviderConfig{{
+		Name:     "local",
+		ClientID: "client",
+		Issuer:   p.URL,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, _ := r.Get("local")
+	flow, err := NewFlow("local", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.challenge = S256Challenge(flow.Verifier)
+	p.claims["nonce"] = flow.Nonce
+	info, err := provider.GetUserInfo(context.Background(), "code", flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "subject" || info.Email != "info@example.com" || !info.EmailVerified {
+		t.Errorf("unexpected user info %v", info)
+	}
+}
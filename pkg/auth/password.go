@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters of new hashes. Stored hashes keep their own
+// parameters, so these can be raised later.
+var (
+	ArgonTime    uint32 = 3
+	ArgonMemory  uint32 = 64 * 1024
+	ArgonThreads uint8  = 2
+	ArgonKeyLen  uint32 = 32
+	ArgonSaltLen        = 16
+)
+
+// Lockout policy for local accounts.
+var (
+	MaxFailedLogins = 5
+	LockoutDuration = 15 * time.Minute
+)
+
+var (
+	MinPasswordLength = 10
+	MaxPasswordLength = 128
+
+	ErrWeakPassword = errors.New("weak password")
+	ErrInvalidHash  = errors.New("invalid password hash")
+)
+
+// commonPasswords are rejected regardless of their length.
+var commonPasswords = map[string]bool{
+	"1234567890": true, "12345678910": true, "1q2w3e4r5t": true,
+	"password1": true, "password12": true, "password123": true,
+	"qwertyuiop": true, "qwerty1234": true, "qwerty12345": true,
+	"iloveyou12": true, "letmein123": true, "welcome123": true,
+	"administrator": true, "passw0rd123": true, "0987654321": true,
+	"1qaz2wsx3edc": true, "zaq12wsxcde3": true, "abcdefghij": true,
+}
+
+// HashPassword returns an argon2id hash in the PHC string format.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, ArgonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error: could not rand.Read: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, ArgonTime, ArgonMemory, ArgonThreads, ArgonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, ArgonMemory, ArgonTime, ArgonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword reports whether password matches a hash
+// made by HashPassword.
+func CheckPassword(hash string, password string) (bool, error) {
+	seq := strings.Split(hash, "$")
+	if len(seq) != 6 || seq[1] != "argon2id" {
+		return false, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(seq[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidHash
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(seq[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(seq[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(seq[5])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+// CheckPasswordStrength rejects short, common and repetitive passwords
+// and passwords containing any of userInputs, like username or email.
+func CheckPasswordStrength(password string, userInputs ...string) error {
+	length := len([]rune(password))
+	if length < MinPasswordLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrWeakPassword, MinPasswordLength)
+	}
+	if length > MaxPasswordLength {
+		return fmt.Errorf("%w: use at most %d characters", ErrWeakPassword, MaxPasswordLength)
+	}
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return fmt.Errorf("%w: this password is too common", ErrWeakPassword)
+	}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if i := strings.Index(input, "@"); i > 0 {
+			input = input[:i]
+		}
+		if len(input) >= 3 && strings.Contains(lower, input) {
+			return fmt.Errorf("%w: do not use your name, username or email", ErrWeakPassword)
+		}
+	}
+	unique := make(map[rune]bool)
+	classes := make(map[string]bool)
+	for _, r := range password {
+		unique[r] = true
+		switch {
+		case unicode.IsLower(r):
+			classes["lower"] = true
+		case unicode.IsUpper(r):
+			classes["upper"] = true
+		case unicode.IsDigit(r):
+			classes["digit"] = true
+		default:
+			classes["other"] = true
+		}
+	}
+	if len(unique) < 5 {
+		return fmt.Errorf("%w: too many repeated characters", ErrWeakPassword)
+	}
+	// long passphrases are fine without mixing character classes
+	if length < 16 && len(classes) < 3 {
+		return fmt.Errorf("%w: mix lower and upper case letters, digits and symbols, or use 16+ characters", ErrWeakPassword)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$") {
+		t.Errorf("unexpected hash format %s", hash)
+	}
+	if other, _ := HashPassword("correct horse battery staple"); other == hash {
+		t.Error("hashes of the same password are equal, salt is not used")
+	}
+	if ok, err := CheckPassword(hash, "correct horse battery staple"); !ok || err != nil {
+		t.Errorf("password does not match its hash: %v", err)
+	}
+	if ok, _ := CheckPassword(hash, "correct horse battery stapler"); ok {
+		t.Error("wrong password matches")
+	}
+	for _, invalid := range []string{"", "plain", "$argon2i$v=19$m=1,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=x$c2FsdA$a2V5"} {
+		if _, err := CheckPassword(invalid, "password"); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("%q: expected ErrInvalidHash, got %v", invalid, err)
+		}
+	}
+}
+
+func TestCheckPasswordStrength(t *testing.T) {
+	weak := map[string]string{
+		"short":      "Ab1!",
+		"common":     "Password123",
+		"username":   "johnsmith-2021!",
+		"email":      "Xjsmith@example",
+		"repetitive": "aaaaaaaaaaaaaaaaaaaaAAAA",
+		"one class":  "abcdefghijkl",
+	}
+	for name, password := range weak {
+		if err := CheckPasswordStrength(password, "johnsmith", "jsmith@example.com"); !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("%s: expected ErrWeakPassword for %q, got %v", name, password, err)
+		}
+	}
+	strong := []string{"Tr0ub4dor&3x", "correct horse battery staple"}
+	for _, password := range strong {
+		if err := CheckPasswordStrength(password, "johnsmith", "jsmith@example.com"); err != nil {
+			t.Errorf("%q: expected no error, got %v", password, err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// ProviderConfig describes an OAuth provider in the configuration file.
+// Empty fields of a provider named like one of the Presets are filled
+// from the preset.
+type ProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	InfoURL      string
+	Scopes       []string
+	// Fields maps UserInfo fields ("id", "email", "name",
+	// "email_verified") to keys of the userinfo response. The id is
+	// taken from "sub" for OpenID providers and from "id" otherwise.
+	Fields map[string]string
+	// TrustEmail marks providers which only return verified emails.
+	TrustEmail bool
+	// Issuer enables OpenID Connect: the identity is taken from the
+	// verified ID token. Endpoints left empty are discovered from
+	// <Issuer>/.well-known/openid-configuration.
+	Issuer  string
+	JWKSURL string
+}
+
+var Presets = map[string]ProviderConfig{
+	"google": {
+		AuthURL:  endpoints.Google.AuthURL,
+		TokenURL: endpoints.Google.TokenURL,
+		InfoURL:  GoogleInfoURL,
+		Scopes:   []string{"openid", "email", "profile"},
+		Fields:   map[string]string{"id": "sub", "email": "email", "name": "name"},
+		Issuer:   "https://accounts.google.com",
+		JWKSURL:  "https://www.googleapis.com/oauth2/v3/certs",
+	},
+	"facebook": {
+		AuthURL:  endpoints.Facebook.AuthURL,
+		TokenURL: endpoints.Facebook.TokenURL,
+		InfoURL:  FacebookInfoURL,
+		Scopes:   []string{"public_profile", "email"},
+		Fields:   map[string]string{"id": "id", "email": "email", "name": "name"},
+		// Facebook does not return unconfirmed emails
+		TrustEmail: true,
+	},
+}
+
+var DefaultFields = map[string]string{
+	"id":             "id",
+	"email":          "email",
+	"name":           "name",
+	"email_verified": "email_verified",
+}
+
+func (p ProviderConfig) withPreset() ProviderConfig {
+	preset := Presets[p.Name]
+	if p.AuthURL == "" {
+		p.AuthURL = preset.AuthURL
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = preset.TokenURL
+	}
+	if p.InfoURL == "" {
+		p.InfoURL = preset.InfoURL
+	}
+	if p.Scopes == nil {
+		p.Scopes = preset.Scopes
+	}
+	if p.Issuer == "" {
+		p.Issuer = preset.Issuer
+	}
+	if p.JWKSURL == "" {
+		p.JWKSURL = preset.JWKSURL
+	}
+	fields := make(map[string]string)
+	for k, v := range DefaultFields {
+		fields[k] = v
+	}
+	if p.Issuer != "" {
+		// OpenID userinfo identifies the user by the subject
+		fields["id"] = "sub"
+	}
+	for _, m := range []map[string]string{preset.Fields, p.Fields} {
+		for k, v := range m {
+			fields[k] = v
+		}
+	}
+	p.Fields = fields
+	p.TrustEmail = p.TrustEmail || preset.TrustEmail
+	return p
+}
+
+// withDiscovery fills missing endpoints of an OpenID provider.
+func (p ProviderConfig) withDiscovery(ctx context.Context) (ProviderConfig, error) {
+	if p.Issuer == "" || (p.AuthURL != "" && p.TokenURL != "" && p.JWKSURL != "") {
+		return p, nil
+	}
+	doc, err := Discover(ctx, p.Issuer)
+	if err != nil {
+		return p, err
+	}
+	if p.AuthURL == "" {
+		p.AuthURL = doc.AuthorizationEndpoint
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = doc.TokenEndpoint
+	}
+	if p.InfoURL == "" {
+		p.InfoURL = doc.UserinfoEndpoint
+	}
+	if p.JWKSURL == "" {
+		p.JWKSURL = doc.JWKSURI
+	}
+	return p, nil
+}
+
+func (p ProviderConfig) validate() error {
+	if p.Name == "" || strings.ContainsAny(p.Name, "/?#") {
+		return fmt.Errorf("error: invalid provider name %q", p.Name)
+	}
+	if p.AuthURL == "" || p.TokenURL == "" {
+		return fmt.Errorf("error: provider %s needs AuthURL and TokenURL", p.Name)
+	}
+	if p.Issuer == "" && p.InfoURL == "" {
+		return fmt.Errorf("error: provider %s needs InfoURL or Issuer", p.Name)
+	}
+	if p.Issuer != "" && p.JWKSURL == "" {
+		return fmt.Errorf("error: provider %s needs JWKSURL", p.Name)
+	}
+	return nil
+}
+
+// Registry holds configured providers by name.
+type Registry struct {
+	providers map[string]*OAuth
+	names     []string
+}
+
+// CreateRegistry builds providers from configs. Callback URLs are
+// baseURL + "/auth/<name>/callback". OpenID providers with missing
+// endpoints are discovered here.
+func CreateRegistry(baseURL string, configs []ProviderConfig) (*Registry, error) {
+	r := &Registry{
+		providers: make(map[string]*OAuth),
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	for _, conf := range configs {
+		conf, err := conf.withPreset().withDiscovery(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if err := conf.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := r.providers[conf.Name]; ok {
+			return nil, fmt.Errorf("error: provider %s is configured twice", conf.Name)
+		}
+		provider := &OAuth{
+			Name: conf.Name,
+			Conf: &oauth2.Config{
+				ClientID:     conf.ClientID,
+				ClientSecret: conf.ClientSecret,
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  conf.AuthURL,
+					TokenURL: conf.TokenURL,
+				},
+				RedirectURL: baseURL + "/auth/" + conf.Name + "/callback",
+				Scopes:      conf.Scopes,
+			},
+			InfoURL:    conf.InfoURL,
+			Fields:     conf.Fields,
+			TrustEmail: conf.TrustEmail,
+		}
+		if conf.Issuer != "" {
+			provider.Verifier = &Verifier{
+				Issuer:   conf.Issuer,
+				ClientID: conf.ClientID,
+				JWKSURL:  conf.JWKSURL,
+				Leeway:   time.Minute,
+			}
+		}
+		r.providers[conf.Name] = provider
+		r.names = append(r.names, conf.Name)
+	}
+	sort.Strings(r.names)
+	return r, nil
+}
+
+func (r *Registry) Get(name string) (*OAuth, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names returns sorted names of the configured providers.
+func (r *Registry) Names() []string {
+	return r.names
+}
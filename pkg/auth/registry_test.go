@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCreateRegistryPresets(t *testing.T) {
+	r, err := CreateRegistry("http://localhost:8080/", []ProviderConfig{
+		{Name: "google", ClientID: "id", ClientSecret: "secret"},
+		{Name: "facebook", ClientID: "id", ClientSecret: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"facebook", "google"}) {
+		t.Errorf("unexpected provider names %v", names)
+	}
+	google, ok := r.Get("google")
+	if !ok {
+		t.Fatal("google provider is not registered")
+	}
+	if google.Conf.RedirectURL != "http://localhost:8080/auth/google/callback" {
+		t.Errorf("unexpected redirect URL %s", google.Conf.RedirectURL)
+	}
+	if google.InfoURL != GoogleInfoURL || google.Fields["id"] != "sub" {
+		t.Errorf("google preset is not applied: %v, %v", google.InfoURL, google.Fields)
+	}
+}
+
+func TestCreateRegistryInvalid(t *testing.T) {
+	configs := [][]ProviderConfig{
+		{{Name: "custom"}},
+		{{Name: "google"}, {Name: "google"}},
+		{{Name: "a/b", AuthURL: "x", TokenURL: "x", InfoURL: "x"}},
+	}
+	for _, conf := range configs {
+		if _, err := CreateRegistry("", conf); err == nil {
+			t.Errorf("expected error for %v", conf)
+		}
+	}
+}
+
+func TestGetUserInfoFieldMapping(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "token", "token_type": "Bearer"}`)
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"uid": 12345678901, "mail": "mail@example.com", "login": "John Smith"}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	r, err := CreateRegistry("http://localhost", []ProviderConfig{{
+		Name:     "custom",
+		AuthURL:  ts.URL + "/auth",
+		TokenURL: ts.URL + "/token",
+		InfoURL:  ts.URL + "/user",
+		Fields:   map[string]string{"id": "uid", "email": "mail", "name": "login"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, _ := r.Get("custom")
+	info, err := provider.GetUserInfo(context.Background(), "code", &Flow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &UserInfo{ID: "12345678901", Email: "mail@example.com", Name: "John Smith"}
+	if !reflect.DeepEqual(expected, info) {
+		t.Errorf("expected %v, got %v", expected, info)
+	}
+}
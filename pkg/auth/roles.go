@@ -0,0 +1,98 @@
+package auth
+
+import "time"
+
+type Permission string
+
+const (
+	PermCreatePost       Permission = "post:create"
+	PermEditOwnPost      Permission = "post:edit:own"
+	PermEditAnyPost      Permission = "post:edit:any"
+	PermDeleteOwnPost    Permission = "post:delete:own"
+	PermDeleteAnyPost    Permission = "post:delete:any"
+	PermComment          Permission = "comment:create"
+	PermEditOwnComment   Permission = "comment:edit:own"
+	PermEditAnyComment   Permission = "comment:edit:any"
+	PermDeleteOwnComment Permission = "comment:delete:own"
+	PermDeleteAnyComment Permission = "comment:delete:any"
+	PermModerate         Permission = "comment:moderate"
+	PermManageCategories Permission = "category:manage"
+	PermManageUsers      Permission = "users:manage"
+	PermManageTrash      Permission = "trash:manage"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleEditor    = "editor"
+	RoleAuthor    = "author"
+	RoleCommenter = "commenter"
+)
+
+// RoleNames lists roles from the most to the least privileged.
+var RoleNames = []string{RoleAdmin, RoleEditor, RoleAuthor, RoleCommenter}
+
+var rolePermissions = map[string][]Permission{
+	RoleCommenter: {PermComment, PermEditOwnComment, PermDeleteOwnComment},
+	RoleAuthor: {
+		PermComment, PermEditOwnComment, PermDeleteOwnComment,
+		PermCreatePost, PermEditOwnPost, PermDeleteOwnPost,
+	},
+	RoleEditor: {
+		PermComment, PermEditOwnComment, PermDeleteOwnComment,
+		PermCreatePost, PermEditOwnPost, PermDeleteOwnPost,
+		PermEditAnyPost, PermDeleteAnyPost,
+		PermModerate, PermManageCategories,
+	},
+	RoleAdmin: {
+		PermComment, PermEditOwnComment, PermDeleteOwnComment,
+		PermCreatePost, PermEditOwnPost, PermDeleteOwnPost,
+		PermEditAnyPost, PermDeleteAnyPost,
+		PermEditAnyComment, PermDeleteAnyComment,
+		PermModerate, PermManageCategories, PermManageUsers, PermManageTrash,
+	},
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants all of perms.
+func HasPermission(role string, perms ...Permission) bool {
+	for _, perm := range perms {
+		granted := false
+		for _, p := range rolePermissions[role] {
+			if p == perm {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
+
+// CanModify reports whether role may change an object owned by ownerID:
+// with the "any" permission always, with the "own" one only its owner.
+func CanModify(role string, userID int, ownerID int, own Permission, any Permission) bool {
+	if HasPermission(role, any) {
+		return true
+	}
+	return userID == ownerID && HasPermission(role, own)
+}
+
+// CanModifyWithin is CanModify where the owner may only change the
+// object until window after it was created. A window of 0 does not
+// limit the owner.
+func CanModifyWithin(role string, userID int, ownerID int, own Permission, any Permission,
+	created time.Time, now time.Time, window time.Duration) bool {
+	if HasPermission(role, any) {
+		return true
+	}
+	if window > 0 && now.Sub(created) > window {
+		return false
+	}
+	return CanModify(role, userID, ownerID, own, any)
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHasPermission(t *testing.T) {
+	if !HasPermission(RoleAdmin, PermManageUsers, PermDeleteAnyPost) {
+		t.Error("admin is missing permissions")
+	}
+	if HasPermission(RoleEditor, PermManageUsers) {
+		t.Error("editor can manage users")
+	}
+	if HasPermission(RoleEditor, PermManageTrash) || !HasPermission(RoleAdmin, PermManageTrash) {
+		t.Error("only admins can manage the trash")
+	}
+	if HasPermission(RoleAuthor, PermModerate) || !HasPermission(RoleEditor, PermModerate) {
+		t.Error("only editors and admins can moderate comments")
+	}
+	if HasPermission(RoleAuthor, PermManageCategories) || !HasPermission(RoleEditor, PermManageCategories) {
+		t.Error("only editors and admins can manage categories")
+	}
+	if HasPermission(RoleCommenter, PermCreatePost) {
+		t.Error("commenter can create posts")
+	}
+	if HasPermission("unknown", PermComment) {
+		t.Error("unknown role has permissions")
+	}
+	for _, role := range RoleNames {
+		if !ValidRole(role) || !HasPermission(role, PermComment) {
+			t.Errorf("role %s cannot comment", role)
+		}
+	}
+}
+
+func TestCanModify(t *testing.T) {
+	tests := []struct {
+		role    string
+		userID  int
+		ownerID int
+		want    bool
+	}{
+		{RoleAuthor, 1, 1, true},
+		{RoleAuthor, 1, 2, false},
+		{RoleEditor, 1, 2, true},
+		{RoleCommenter, 1, 1, false},
+	}
+	for _, test := range tests {
+		got := CanModify(test.role, test.userID, test.ownerID, PermEditOwnPost, PermEditAnyPost)
+		if got != test.want {
+			t.Errorf("%s %d on post of %d: expected %v, got %v",
+				test.role, test.userID, test.ownerID, test.want, got)
+		}
+	}
+}
+
+func TestCanModifyWithin(t *testing.T) {
+	now := time.Now()
+	window := 15 * time.Minute
+	tests := []struct {
+		role    string
+		userID  int
+		created time.Time
+		window  time.Duration
+		want    bool
+	}{
+		{RoleCommenter, 1, now.Add(-time.Minute), window, true},
+		{RoleCommenter, 1, now.Add(-time.Hour), window, false},
+		{RoleCommenter, 1, now.Add(-time.Hour), 0, true},
+		{RoleCommenter, 2, now, window, false},
+		{RoleEditor, 2, now, window, false},
+		{RoleAdmin, 2, now.Add(-time.Hour), window, true},
+	}
+	for _, test := range tests {
+		got := CanModifyWithin(test.role, test.userID, 1, PermEditOwnComment, PermEditAnyComment,
+			test.created, now, test.window)
+		if got != test.want {
+			t.Errorf("%s %d on comment from %v ago: expected %v, got %v",
+				test.role, test.userID, now.Sub(test.created), test.want, got)
+		}
+	}
+}
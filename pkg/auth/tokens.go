@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Scopes of API tokens. A write token can also read.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// TokenPrefix marks personal API tokens, so that leaked ones are easy
+// to find by secret scanners.
+const TokenPrefix = "nix_"
+
+var tokenBytes = 32
+
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite
+}
+
+// ScopeAllows reports whether a token with scope may be used
+// for requests which need required.
+func ScopeAllows(scope string, required string) bool {
+	switch required {
+	case ScopeRead:
+		return scope == ScopeRead || scope == ScopeWrite
+	case ScopeWrite:
+		return scope == ScopeWrite
+	}
+	return false
+}
+
+// GenerateToken returns a new API token and the hash to store for it.
+func GenerateToken() (token string, hash string, err error) {
+	data := make([]byte, tokenBytes)
+	if _, err := rand.Read(data); err != nil {
+		return "", "", fmt.Errorf("error: could not rand.Read: %w", err)
+	}
+	token = TokenPrefix + base64.RawURLEncoding.EncodeToString(data)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 of token. Tokens are random, so
+// a fast unsalted hash is enough and allows looking them up by hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// LooksLikeToken checks the format of a token before any lookup.
+func LooksLikeToken(token string) bool {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, TokenPrefix))
+	return err == nil && len(data) == tokenBytes
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, hash, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, TokenPrefix) || !LooksLikeToken(token) {
+		t.Errorf("unexpected token format %s", token)
+	}
+	if hash != HashToken(token) || len(hash) != 64 {
+		t.Errorf("unexpected hash %s", hash)
+	}
+	other, _, _ := GenerateToken()
+	if other == token {
+		t.Error("tokens are not random")
+	}
+	for _, invalid := range []string{"", "nix_", "nix_short", strings.TrimPrefix(token, TokenPrefix), "ghp_" + token[4:]} {
+		if LooksLikeToken(invalid) {
+			t.Errorf("%q is accepted as a token", invalid)
+		}
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	tests := []struct {
+		scope    string
+		required string
+		want     bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeWrite, ScopeRead, true},
+		{ScopeWrite, ScopeWrite, true},
+		{ScopeRead, ScopeWrite, false},
+		{"", ScopeRead, false},
+		{ScopeWrite, "admin", false},
+	}
+	for _, test := range tests {
+		if got := ScopeAllows(test.scope, test.required); got != test.want {
+			t.Errorf("%q for %q: expected %v, got %v", test.scope, test.required, test.want, got)
+		}
+	}
+}
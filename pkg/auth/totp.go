@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters of RFC 6238 as used by common authenticator apps.
+var (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	// TOTPSkew is how many periods before and after now are accepted.
+	TOTPSkew = 1
+
+	RecoveryCodeCount = 10
+
+	ErrInvalidCode = errors.New("invalid code")
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random base32 secret of 160 bits.
+func GenerateTOTPSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("error: could not rand.Read: %w", err)
+	}
+	return secretEncoding.EncodeToString(key), nil
+}
+
+// TOTPURI returns the otpauth URI authenticator apps read from QR codes.
+func TOTPURI(issuer string, account string, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPStep returns the time step of t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// HOTP computes the code of counter as in RFC 4226.
+func HOTP(secret string, counter int64) (string, error) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("error: invalid secret: %w", err)
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// ValidateTOTP checks code against the steps around now. Steps up to
+// lastStep were used already and are rejected, so a code works only
+// once. It returns the matched step, to be stored as the new lastStep.
+func ValidateTOTP(secret string, code string, now time.Time, lastStep int64) (int64, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != TOTPDigits {
+		return 0, ErrInvalidCode
+	}
+	current := TOTPStep(now)
+	for step := current - int64(TOTPSkew); step <= current+int64(TOTPSkew); step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := HOTP(secret, step)
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrInvalidCode
+}
+
+// GenerateRecoveryCodes returns n random codes like "abcde-fghij" and
+// their hashes to store.
+func GenerateRecoveryCodes(n int) (codes []string, hashes []string, err error) {
+	encoding := base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+	for i := 0; i < n; i++ {
+		data := make([]byte, 7)
+		if _, err := rand.Read(data); err != nil {
+			return nil, nil, fmt.Errorf("error: could not rand.Read: %w", err)
+		}
+		code := encoding.EncodeToString(data)[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a recovery code ignoring case, spaces and dashes.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashToken(code)
+}
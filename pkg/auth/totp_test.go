@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/base32"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 test vectors for SHA-1 with 8 digits.
+func TestHOTPVectors(t *testing.T) {
+	defer func(digits int) { TOTPDigits = digits }(TOTPDigits)
+	TOTPDigits = 8
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, expected := range vectors {
+		code, err := HOTP(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("%d: expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	code, _ := HOTP(secret, TOTPStep(now))
+	step, err := ValidateTOTP(secret, code, now, 0)
+	if err != nil || step != TOTPStep(now) {
+		t.Fatalf("valid code rejected: %v", err)
+	}
+	if _, err := ValidateTOTP(secret, code, now, step); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("reused code accepted")
+	}
+	if _, err := ValidateTOTP(secret, code, now.Add(TOTPPeriod), 0); err != nil {
+		t.Errorf("code of the previous period rejected: %v", err)
+	}
+	if _, err := ValidateTOTP(secret, code, now.Add(3*TOTPPeriod), 0); err == nil {
+		t.Errorf("old code accepted")
+	}
+	if _, err := ValidateTOTP(secret, "12345", now, 0); err == nil {
+		t.Errorf("short code accepted")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("nix", "a@example.com", "SECRET")
+	if !strings.HasPrefix(uri, "otpauth://totp/nix:a@example.com?") || !strings.Contains(uri, "secret=SECRET") {
+		t.Errorf("unexpected URI %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", RecoveryCodeCount, len(codes))
+	}
+	if len(codes[0]) != 11 || codes[0][5] != '-' {
+		t.Errorf("unexpected code format %s", codes[0])
+	}
+	if HashRecoveryCode(strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))) != hashes[0] {
+		t.Errorf("code is not normalized before hashing")
+	}
+	if codes[0] == codes[1] {
+		t.Errorf("codes are not random")
+	}
+}
@@ -0,0 +1,65 @@
+// Package blob stores the content of uploaded files by key, apart from
+// their metadata in the database.
+package blob
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	KindFS = "fs"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store keeps blobs by key. Blobs are written once and never changed,
+// so a key always names the same content.
+type Store interface {
+	// Put stores the content read from r under key.
+	Put(key string, r io.Reader) error
+	// Open returns the content stored under key, or ErrNotFound.
+	Open(key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing
+	// blob is not an error.
+	Delete(key string) error
+}
+
+// Open creates a store of the given kind. location is a directory for
+// the filesystem store.
+func Open(kind string, location string) (Store, error) {
+	switch kind {
+	case KindFS:
+		return NewFS(location)
+	}
+	return nil, fmt.Errorf("error: unknown blob store kind %q", kind)
+}
+
+// NewKey returns a random key for a new blob.
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error: could not generate blob key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validKey reports whether key only has lowercase letters, digits and
+// hyphens, so that stores can use it in paths and names.
+func validKey(key string) bool {
+	if len(key) < 3 || len(key) > 128 {
+		return false
+	}
+	for _, r := range key {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
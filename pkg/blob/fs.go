@@ -0,0 +1,88 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FS stores blobs as files in a directory, in subdirectories named by
+// the first two characters of their keys.
+type FS struct {
+	Dir string
+}
+
+// NewFS creates the directory dir if needed and returns a store in it.
+func NewFS(dir string) (*FS, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("error: blob store directory is not set")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error: could not create blob store directory: %w", err)
+	}
+	return &FS{Dir: dir}, nil
+}
+
+func (fs *FS) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(fs.Dir, key[:2], key), nil
+}
+
+// Put writes the content to a temporary file first, so that a blob is
+// either stored completely or not at all.
+func (fs *FS) Put(key string, r io.Reader) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("error: could not create blob directory: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return fmt.Errorf("error: could not create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error: could not write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error: could not write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error: could not store blob: %w", err)
+	}
+	return nil
+}
+
+func (fs *FS) Open(key string) (io.ReadSeekCloser, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: could not open blob: %w", err)
+	}
+	return file, nil
+}
+
+func (fs *FS) Delete(key string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error: could not delete blob: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	store, err := Open(KindFS, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(key, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	file, err := store.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("blob is %q, expected %q", data, "hello")
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestFSInvalidKey(t *testing.T) {
+	store, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "ab", "../etc/passwd", "a/b/c", "ABCDEF"} {
+		if err := store.Put(key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, expected ErrInvalidKey", key, err)
+		}
+		if _, err := store.Open(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q) = %v, expected ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestOpenUnknownKind(t *testing.T) {
+	if _, err := Open("s3", "bucket"); err == nil {
+		t.Error("expected error for unknown kind")
+	}
+}
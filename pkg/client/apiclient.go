@@ -21,6 +21,9 @@ func (c *APIClient) Get(url string) ([]byte, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error: unexpected status %s", resp.Status)
+	}
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -45,7 +48,10 @@ func unmarshalComments(data []byte) ([]models.Comment, error) {
 }
 
 func (c *APIClient) GetPosts(userID int) ([]models.Post, error) {
-	req := fmt.Sprintf("posts?userId=%d", userID)
+	req := "posts"
+	if userID != 0 {
+		req = fmt.Sprintf("posts?userId=%d", userID)
+	}
 	data, err := c.Get(req)
 	if err != nil {
 		return nil, fmt.Errorf("error getting url: %w", err)
@@ -0,0 +1,122 @@
+// Package diff computes line-level differences between two texts.
+package diff
+
+import "strings"
+
+// Op is the kind of change of a line.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a line of the diff; Text has no trailing newline.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+func (l Line) Equal() bool  { return l.Op == Equal }
+func (l Line) Insert() bool { return l.Op == Insert }
+func (l Line) Delete() bool { return l.Op == Delete }
+
+// MaxCells limits the size of the table of the longest common
+// subsequence. Larger inputs are diffed as a deletion of a followed by
+// an insertion of b.
+var MaxCells = 4 << 20
+
+// Lines returns the lines which turn a into b, using the longest common
+// subsequence of their lines.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+	// common prefix and suffix are not part of the table
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix &&
+		x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	lines := make([]Line, 0, len(x)+len(y))
+	for _, s := range x[:prefix] {
+		lines = append(lines, Line{Equal, s})
+	}
+	lines = append(lines, lcs(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, s := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Equal, s})
+	}
+	return lines
+}
+
+// Changed reports whether lines contain an insertion or deletion.
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func lcs(x, y []string) []Line {
+	lines := make([]Line, 0, len(x)+len(y))
+	if len(x)*len(y) > MaxCells {
+		for _, s := range x {
+			lines = append(lines, Line{Delete, s})
+		}
+		for _, s := range y {
+			lines = append(lines, Line{Insert, s})
+		}
+		return lines
+	}
+	// n[i][j] is the length of the common subsequence of x[i:] and y[j:]
+	n := make([][]int, len(x)+1)
+	for i := range n {
+		n[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				n[i][j] = n[i+1][j+1] + 1
+			} else if n[i+1][j] >= n[i][j+1] {
+				n[i][j] = n[i+1][j]
+			} else {
+				n[i][j] = n[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Equal, x[i]})
+			i++
+			j++
+		case n[i+1][j] >= n[i][j+1]:
+			lines = append(lines, Line{Delete, x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Insert, y[j]})
+	}
+	return lines
+}
@@ -0,0 +1,53 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// format writes lines the way unified diffs do.
+func format(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString([]string{" ", "+", "-"}[l.Op] + l.Text + "\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"a\nb\n", "a\nb", " a\n b\n"},
+		{"", "a\nb", "+a\n+b\n"},
+		{"a\nb", "", "-a\n-b\n"},
+		{"a\nb\nc", "a\nx\nc", " a\n-b\n+x\n c\n"},
+		{"a\nb\nc\nd", "b\nc\ne", "-a\n b\n c\n-d\n+e\n"},
+		{"a\r\nb", "a\nb", " a\n b\n"},
+	}
+	for _, test := range tests {
+		if got := format(Lines(test.a, test.b)); got != test.want {
+			t.Errorf("Lines(%q, %q) = %q, expected %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestLinesLarge(t *testing.T) {
+	defer func(n int) { MaxCells = n }(MaxCells)
+	MaxCells = 1
+	got := format(Lines("same\na\nb\nsame", "same\nb\nc\nsame"))
+	if want := " same\n-a\n-b\n+b\n+c\n same\n"; got != want {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	if Changed(Lines("a\nb", "a\nb")) {
+		t.Errorf("equal texts are changed")
+	}
+	if !Changed(Lines("a", "b")) {
+		t.Errorf("different texts are not changed")
+	}
+}
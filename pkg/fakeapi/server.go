@@ -0,0 +1,236 @@
+// Package fakeapi is an offline stand-in for jsonplaceholder.typicode.com.
+// It serves deterministic users, posts and comments and can inject latency
+// and failures to exercise clients.
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type User struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type Post struct {
+	UserID int    `json:"userId"`
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+type Comment struct {
+	PostID int    `json:"postId"`
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Body   string `json:"body"`
+}
+
+// Options control the generated data and the injected faults. Rates are
+// probabilities in [0, 1] checked per request in the order: server error,
+// rate limit, malformed body.
+type Options struct {
+	Users           int
+	PostsPerUser    int
+	CommentsPerPost int
+	Seed            int64
+
+	Latency       time.Duration
+	ErrorRate     float64
+	RateLimitRate float64
+	MalformedRate float64
+}
+
+// DefaultOptions match the shape of jsonplaceholder: 10 users with 10 posts
+// each and 5 comments per post.
+var DefaultOptions = Options{
+	Users:           10,
+	PostsPerUser:    10,
+	CommentsPerPost: 5,
+	Seed:            1,
+}
+
+var words = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing
+	elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim
+	ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea
+	commodo consequat`)
+
+type Server struct {
+	Options
+	Users    []User
+	Posts    []Post
+	Comments []Comment
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewServer(opts Options) *Server {
+	s := &Server{
+		Options: opts,
+		rand:    rand.New(rand.NewSource(opts.Seed)),
+	}
+	// data uses its own generator, so it does not depend on fault settings
+	r := rand.New(rand.NewSource(opts.Seed))
+	for u := 1; u <= opts.Users; u++ {
+		username := fmt.Sprintf("user%d", u)
+		s.Users = append(s.Users, User{
+			ID:       u,
+			Name:     title(sentence(r, 2)),
+			Username: username,
+			Email:    username + "@example.com",
+		})
+		for p := 1; p <= opts.PostsPerUser; p++ {
+			post := Post{
+				UserID: u,
+				ID:     len(s.Posts) + 1,
+				Title:  sentence(r, 4),
+				Body:   sentence(r, 20),
+			}
+			s.Posts = append(s.Posts, post)
+			for c := 1; c <= opts.CommentsPerPost; c++ {
+				id := len(s.Comments) + 1
+				s.Comments = append(s.Comments, Comment{
+					PostID: post.ID,
+					ID:     id,
+					Name:   sentence(r, 3),
+					Email:  fmt.Sprintf("commenter%d@example.com", id),
+					Body:   sentence(r, 12),
+				})
+			}
+		}
+	}
+	return s
+}
+
+func sentence(r *rand.Rand, n int) string {
+	seq := make([]string, n)
+	for i := range seq {
+		seq[i] = words[r.Intn(len(words))]
+	}
+	return strings.Join(seq, " ")
+}
+
+// title upper-cases the first letter of every word of the ASCII text s.
+func title(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'a' <= c && c <= 'z' && (i == 0 || b[i-1] == ' ') {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
+
+func (s *Server) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64() < rate
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Latency > 0 {
+		select {
+		case <-time.After(s.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.chance(s.ErrorRate) {
+		http.Error(w, "injected server error", http.StatusInternalServerError)
+		return
+	}
+	if s.chance(s.RateLimitRate) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "injected rate limit", http.StatusTooManyRequests)
+		return
+	}
+	data, status := s.route(r)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if s.chance(s.MalformedRate) {
+		fmt.Fprint(w, `[{"id": 1, "title": `)
+		return
+	}
+	json.NewEncoder(w).Encode(data)
+}
+
+// route resolves /users, /posts, /comments, /<resource>/<id> and
+// /posts/<id>/comments, applying id, userId and postId query filters.
+func (s *Server) route(r *http.Request) (interface{}, int) {
+	seq := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	if len(seq) == 3 && seq[0] == "posts" && seq[2] == "comments" {
+		query.Set("postId", seq[1])
+		seq = []string{"comments"}
+	}
+	if len(seq) == 2 {
+		query.Set("id", seq[1])
+	}
+	if len(seq) > 2 {
+		return struct{}{}, http.StatusNotFound
+	}
+	var result []interface{}
+	switch seq[0] {
+	case "users":
+		for _, user := range s.Users {
+			if match(query, "id", user.ID) {
+				result = append(result, user)
+			}
+		}
+	case "posts":
+		for _, post := range s.Posts {
+			if match(query, "id", post.ID) && match(query, "userId", post.UserID) {
+				result = append(result, post)
+			}
+		}
+	case "comments":
+		for _, comment := range s.Comments {
+			if match(query, "id", comment.ID) && match(query, "postId", comment.PostID) {
+				result = append(result, comment)
+			}
+		}
+	default:
+		return struct{}{}, http.StatusNotFound
+	}
+	if len(seq) == 2 {
+		if len(result) == 0 {
+			return struct{}{}, http.StatusNotFound
+		}
+		return result[0], http.StatusOK
+	}
+	if result == nil {
+		result = make([]interface{}, 0)
+	}
+	return result, http.StatusOK
+}
+
+func match(query map[string][]string, key string, value int) bool {
+	values, ok := query[key]
+	if !ok {
+		return true
+	}
+	for _, v := range values {
+		if v == strconv.Itoa(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func get(t *testing.T, s *Server, url string, dest interface{}) int {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if dest != nil && rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(dest); err != nil {
+			t.Fatalf("could not decode %s: %v", url, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestDeterministic(t *testing.T) {
+	a := NewServer(DefaultOptions)
+	b := NewServer(DefaultOptions)
+	if !reflect.DeepEqual(a.Posts, b.Posts) || !reflect.DeepEqual(a.Comments, b.Comments) {
+		t.Error("servers with the same seed generated different data")
+	}
+}
+
+func TestFilters(t *testing.T) {
+	s := NewServer(DefaultOptions)
+	var posts []Post
+	get(t, s, "/posts?userId=3", &posts)
+	if len(posts) != DefaultOptions.PostsPerUser {
+		t.Fatalf("expected %d posts, got %d", DefaultOptions.PostsPerUser, len(posts))
+	}
+	var comments []Comment
+	get(t, s, "/comments?postId=21", &comments)
+	var nested []Comment
+	get(t, s, "/posts/21/comments", &nested)
+	if len(comments) != DefaultOptions.CommentsPerPost || !reflect.DeepEqual(comments, nested) {
+		t.Errorf("expected %d equal comments, got %v and %v", DefaultOptions.CommentsPerPost, comments, nested)
+	}
+	var post Post
+	if status := get(t, s, "/posts/21", &post); status != http.StatusOK || post.ID != 21 {
+		t.Errorf("expected post 21, got %v with status %d", post, status)
+	}
+	if status := get(t, s, "/posts/100000", nil); status != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	opts := DefaultOptions
+	opts.ErrorRate = 1
+	if status := get(t, NewServer(opts), "/posts", nil); status != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, status)
+	}
+	opts = DefaultOptions
+	opts.RateLimitRate = 1
+	if status := get(t, NewServer(opts), "/posts", nil); status != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, status)
+	}
+}
@@ -0,0 +1,83 @@
+// Package markdown renders post and comment bodies written in Markdown
+// to sanitized HTML.
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(gmhtml.WithHardWraps()),
+	)
+	// policy allows the HTML of user generated content: formatting,
+	// links, images, lists, tables and code, but no scripts, styles or
+	// event handlers. Links get rel="nofollow noopener".
+	policy = newPolicy()
+	strip  = bluemonday.StrictPolicy()
+)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(false)
+	p.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).OnElements("code")
+	return p
+}
+
+// HTML renders src to HTML. Raw HTML in src is dropped, and the output
+// is sanitized in addition, so that unsafe links or attributes produced
+// by Markdown itself are removed too.
+func HTML(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// Render renders src for templates. If src cannot be rendered, it is
+// shown as escaped text.
+func Render(src string) template.HTML {
+	out, err := HTML(src)
+	if err != nil {
+		return template.HTML("<p>" + template.HTMLEscapeString(src) + "</p>")
+	}
+	return template.HTML(out)
+}
+
+// Text returns the text of src without any markup.
+func Text(src string) string {
+	out, err := HTML(src)
+	if err != nil {
+		out = src
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(strip.Sanitize(out))), " ")
+}
+
+// Excerpt returns at most n runes of the text of src, cut at a word
+// boundary and ending with an ellipsis if it was shortened.
+func Excerpt(src string, n int) string {
+	text := []rune(Text(src))
+	if len(text) <= n {
+		return string(text)
+	}
+	cut := n
+	for cut > 0 && !unicode.IsSpace(text[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = n
+	}
+	return strings.TrimRightFunc(string(text[:cut]), unicode.IsPunct) + "…"
+}
@@ -0,0 +1,56 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		src      string
+		contains []string
+		excludes []string
+	}{
+		{"**bold** and `code`", []string{"<strong>bold</strong>", "<code>code</code>"}, nil},
+		{"line one\nline two", []string{"line one<br>"}, nil},
+		{"[link](https://example.com)", []string{`href="https://example.com"`, `rel="nofollow"`}, nil},
+		{"```go\nfmt.Println()\n```", []string{`<code class="language-go">`}, nil},
+		{"<script>alert(1)</script>hi", nil, []string{"<script", "alert(1)"}},
+		{`<img src="x" onerror="alert(1)">`, nil, []string{"onerror"}},
+		{"[x](javascript:alert(1))", nil, []string{"javascript:"}},
+	}
+	for _, test := range tests {
+		out, err := HTML(test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(out, s) {
+				t.Errorf("%q: %q does not contain %q", test.src, out, s)
+			}
+		}
+		for _, s := range test.excludes {
+			if strings.Contains(out, s) {
+				t.Errorf("%q: %q contains %q", test.src, out, s)
+			}
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		src  string
+		n    int
+		want string
+	}{
+		{"# Title\n\nSome *text* &amp; more.", 100, "Title Some text & more."},
+		{"one two three four", 10, "one two…"},
+		{"one, two three", 6, "one…"},
+		{"abcdefghij", 4, "abcd…"},
+	}
+	for _, test := range tests {
+		if got := Excerpt(test.src, test.n); got != test.want {
+			t.Errorf("Excerpt(%q, %d) = %q, want %q", test.src, test.n, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Package media checks the types of uploaded files and makes thumbnails
+// of images.
+package media
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// SniffLength is how many bytes of a file Sniff looks at.
+const SniffLength = 512
+
+var ErrType = errors.New("file type is not allowed")
+
+// AllowedTypes are the media types of files which may be uploaded. HTML,
+// SVG and scripts are not among them, as browsers would run them on the
+// site.
+var AllowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"application/zip": true,
+	"text/plain":      true,
+}
+
+// Sniff returns the content type of a file from its first SniffLength
+// bytes, ignoring its name, or ErrType if the type is not allowed.
+func Sniff(head []byte) (string, error) {
+	contentType := http.DetectContentType(head)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !AllowedTypes[mediaType] {
+		return "", ErrType
+	}
+	return contentType, nil
+}
+
+// IsImage reports whether browsers show files of contentType as images.
+func IsImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+// Inline reports whether files of contentType are shown in the browser
+// rather than downloaded.
+func Inline(contentType string) bool {
+	return IsImage(contentType) || contentType == "application/pdf"
+}
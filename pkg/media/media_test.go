@@ -0,0 +1,100 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	pngData := encodePNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+	tests := []struct {
+		head []byte
+		want string
+		err  error
+	}{
+		{pngData, "image/png", nil},
+		{[]byte("%PDF-1.4\n"), "application/pdf", nil},
+		{[]byte("just some notes"), "text/plain; charset=utf-8", nil},
+		{[]byte("<!DOCTYPE html><script>alert(1)</script>"), "", ErrType},
+		// SVG is not recognized, so it is only ever served as text
+		{[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), "text/plain; charset=utf-8", nil},
+		{[]byte("MZ\x90\x00\x03\x00\x00\x00"), "", ErrType},
+	}
+	for _, test := range tests {
+		got, err := Sniff(test.head)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("Sniff(%q) = %q, %v, expected %q, %v", test.head[:8], got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	thumb, err := Thumbnail(bytes.NewReader(encodePNG(t, img)), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Width != 200 || thumb.Height != 100 {
+		t.Errorf("original size is %dx%d, expected 200x100", thumb.Width, thumb.Height)
+	}
+	if thumb.ContentType != "image/jpeg" {
+		t.Errorf("thumbnail of an opaque image is %s, expected image/jpeg", thumb.ContentType)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(thumb.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || config.Width != 50 || config.Height != 25 {
+		t.Errorf("thumbnail is %s %dx%d, expected jpeg 50x25", format, config.Width, config.Height)
+	}
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 10, 30))
+	thumb, err = Thumbnail(bytes.NewReader(encodePNG(t, transparent)), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, format, err = image.DecodeConfig(bytes.NewReader(thumb.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.ContentType != "image/png" || format != "png" || config.Width != 10 || config.Height != 30 {
+		t.Errorf("thumbnail is %s %dx%d, expected png 10x30", format, config.Width, config.Height)
+	}
+
+	if _, err := Thumbnail(bytes.NewReader([]byte("not an image")), 50); err == nil {
+		t.Error("expected error for data which is no image")
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct{ w, h, size, ww, wh int }{
+		{1000, 500, 100, 100, 50},
+		{500, 1000, 100, 50, 100},
+		{80, 60, 100, 80, 60},
+		{10000, 1, 100, 100, 1},
+	}
+	for _, test := range tests {
+		if w, h := fit(test.w, test.h, test.size); w != test.ww || h != test.wh {
+			t.Errorf("fit(%d, %d, %d) = %d, %d, expected %d, %d",
+				test.w, test.h, test.size, w, h, test.ww, test.wh)
+		}
+	}
+}
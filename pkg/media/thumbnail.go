@@ -0,0 +1,117 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+
+	// decoders of the image formats thumbnails are made of
+	_ "image/gif"
+)
+
+// MaxPixels limits the size of images thumbnails are made of, so that
+// small files of huge images do not exhaust memory.
+const MaxPixels = 40_000_000
+
+var ErrTooLarge = errors.New("image is too large")
+
+// samples is how many source pixels are averaged in each direction for
+// a pixel of a thumbnail.
+const samples = 4
+
+// Thumb is a thumbnail and the size of the image it is made of.
+type Thumb struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Thumbnail scales the JPEG, PNG or GIF image read from r down to fit
+// into size x size pixels. Opaque thumbnails are JPEG, others PNG.
+// Smaller images are not enlarged.
+func Thumbnail(r io.Reader, size int) (*Thumb, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	w, h := fit(config.Width, config.Height, size)
+	dst, opaque := scale(src, w, h)
+	thumb := &Thumb{Width: config.Width, Height: config.Height}
+	var buf bytes.Buffer
+	if opaque {
+		thumb.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		thumb.ContentType = "image/png"
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: could not encode thumbnail: %w", err)
+	}
+	thumb.Data = buf.Bytes()
+	return thumb, nil
+}
+
+// fit returns the size of a w x h image scaled down to fit into
+// size x size, keeping its aspect ratio.
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// scale averages a grid of samples of src for every pixel of a w x h
+// image, and reports whether the result is opaque.
+func scale(src image.Image, w, h int) (*image.RGBA, bool) {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	opaque := true
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, bl, a, n uint32
+			for sy := 0; sy < samples; sy++ {
+				py := b.Min.Y + (y*samples+sy)*b.Dy()/(h*samples)
+				for sx := 0; sx < samples; sx++ {
+					px := b.Min.X + (x*samples+sx)*b.Dx()/(w*samples)
+					cr, cg, cb, ca := src.At(px, py).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			c := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)}
+			if c.A != 0xffff {
+				opaque = false
+			}
+			dst.SetRGBA64(x, y, c)
+		}
+	}
+	return dst, opaque
+}
@@ -1,11 +1,100 @@
 package models
 
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
 type User struct {
-	ID    int
-	Email string
-	Name  string
+	ID            int
+	Email         string
+	Name          string
+	EmailVerified bool
+	// Role is one of the auth package roles, empty for the default role.
+	Role string
+}
+
+// Identity links a user to an account at an external login provider.
+// Subject is the account ID at the provider, unique per provider.
+type Identity struct {
+	ID       int
+	User     *User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID   int
+	Provider string `gorm:"uniqueIndex:idx_identity_provider_subject"`
+	Subject  string `gorm:"uniqueIndex:idx_identity_provider_subject"`
+	Email    string
+}
+
+// Credential is the password of a local account. Hash is never
+// sent to the client.
+type Credential struct {
+	User           *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID         int    `gorm:"primaryKey;autoIncrement:false"`
+	Username       string `gorm:"uniqueIndex"`
+	Hash           string `json:"-" xml:"-"`
+	FailedAttempts int
+	LockedUntil    time.Time
+	UpdatedAt      time.Time
+}
+
+// APIToken is a personal access token for the REST API. Only the
+// SHA-256 Hash of the token is stored.
+type APIToken struct {
+	ID         int
+	User       *User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID     int   `gorm:"index"`
+	Name       string
+	Scope      string
+	Hash       string `gorm:"uniqueIndex" json:"-" xml:"-"`
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// TOTP is the time-based one-time password second factor of a user.
+// LastStep is the time step of the last accepted code, which makes
+// codes single-use.
+type TOTP struct {
+	User     *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID   int    `gorm:"primaryKey;autoIncrement:false"`
+	Secret   string `json:"-" xml:"-"`
+	LastStep int64
+	// FailedAttempts and LockedUntil limit wrong codes across sign ins.
+	FailedAttempts int
+	LockedUntil    time.Time
+	CreatedAt      time.Time
+}
+
+// RecoveryCode signs in once without the second factor. Only its
+// SHA-256 Hash is stored.
+type RecoveryCode struct {
+	ID     int
+	User   *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID int    `gorm:"index"`
+	Hash   string `json:"-" xml:"-"`
+	UsedAt *time.Time
+}
+
+// Session is a server-side session. ID is the SHA-256 of the session ID
+// in the cookie and UserID is set once a user signs in.
+type Session struct {
+	ID        string `gorm:"primaryKey"`
+	User      *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-" xml:"-"`
+	UserID    *int   `gorm:"index"`
+	Data      []byte `json:"-" xml:"-"`
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
 }
 
+// Deprecated: GoogleUser stored logins of every provider in one ID space,
+// use Identity instead.
 type GoogleUser struct {
 	User   *User
 	UserID int
@@ -17,13 +106,297 @@ type Post struct {
 	ID     int
 	Title  string
 	Body   string
+	// Slug is the unique name of the post in its URL, made from the
+	// title unless it is set. Posts stored before slugs were added get
+	// one on migration.
+	Slug string `gorm:"uniqueIndex;default:null"`
+	// Status is one of the Post* statuses, only published posts are
+	// public.
+	Status string `gorm:"index;default:published"`
+	// PublishAt is when a scheduled post is published, or when a
+	// published post was.
+	PublishAt *time.Time `gorm:"index" json:",omitempty" xml:",omitempty"`
+	// DeletedAt is set while the post is in the trash.
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-" xml:"-"`
+	CategoryID *int           `gorm:"index" json:",omitempty" xml:",omitempty"`
+	Category   *Category      `gorm:"constraint:OnDelete:SET NULL;" json:",omitempty" xml:",omitempty"`
+	Tags       []Tag          `gorm:"many2many:post_tags;" json:",omitempty" xml:",omitempty"`
+}
+
+// Path is the URL path of post.
+func (p *Post) Path() string {
+	return "/posts/" + url.PathEscape(p.Slug)
+}
+
+// PostSlug is a former slug of a post, which redirects to the post.
+type PostSlug struct {
+	Slug   string `gorm:"primaryKey"`
+	Post   *Post  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	PostID int    `gorm:"index"`
+}
+
+// TagNames joins the names of the tags of post with commas, as they are
+// entered on the post form.
+func (p *Post) TagNames() string {
+	names := make([]string, 0, len(p.Tags))
+	for _, tag := range p.Tags {
+		names = append(names, tag.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Tag labels posts. Names are slugs, see the slug package.
+type Tag struct {
+	ID   int    `json:"-" xml:"-"`
+	Name string `gorm:"uniqueIndex"`
+}
+
+// TagCount is a tag with the number of its published posts.
+type TagCount struct {
+	Tag
+	Posts int64
+}
+
+// Category groups posts. Categories form a tree through ParentID, and
+// posts of a category are also listed in its ancestors.
+type Category struct {
+	ID       int
+	Name     string
+	Slug     string `gorm:"uniqueIndex"`
+	ParentID *int   `gorm:"index" json:",omitempty" xml:",omitempty"`
+}
+
+// CategoryNode is a category at Depth in the tree, 0 for top level
+// categories.
+type CategoryNode struct {
+	Category
+	Depth int
+}
+
+// CategoryTree orders categories depth first, children by name.
+// Categories whose parent is missing are top level.
+func CategoryTree(categories []Category) []CategoryNode {
+	ids := make(map[int]bool, len(categories))
+	for _, category := range categories {
+		ids[category.ID] = true
+	}
+	children := make(map[int][]Category)
+	for _, category := range categories {
+		parent := 0
+		if category.ParentID != nil && ids[*category.ParentID] && *category.ParentID != category.ID {
+			parent = *category.ParentID
+		}
+		children[parent] = append(children[parent], category)
+	}
+	nodes := make([]CategoryNode, 0, len(categories))
+	visited := make(map[int]bool, len(categories))
+	var walk func(parent int, depth int)
+	walk = func(parent int, depth int) {
+		list := children[parent]
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		for _, category := range list {
+			if visited[category.ID] {
+				continue
+			}
+			visited[category.ID] = true
+			nodes = append(nodes, CategoryNode{Category: category, Depth: depth})
+			walk(category.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+	return nodes
+}
+
+// CategoryPath returns the category with id and its ancestors, the top
+// level category first.
+func CategoryPath(categories []Category, id int) []Category {
+	byID := make(map[int]Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	path := make([]Category, 0)
+	for {
+		category, ok := byID[id]
+		if !ok || len(path) == len(categories) {
+			break
+		}
+		path = append([]Category{category}, path...)
+		if category.ParentID == nil {
+			break
+		}
+		id = *category.ParentID
+	}
+	return path
+}
+
+// Statuses of posts.
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+	PostArchived  = "archived"
+)
+
+// PostStatuses lists the statuses of posts.
+var PostStatuses = []string{PostDraft, PostScheduled, PostPublished, PostArchived}
+
+func ValidPostStatus(status string) bool {
+	for _, s := range PostStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Published reports whether post is public. Posts without a status, as
+// read from import sources, are published.
+func (p *Post) Published() bool {
+	return p.Status == PostPublished || p.Status == ""
+}
+
+// PostRevision is the title and body of a post after an edit.
+type PostRevision struct {
+	ID        int
+	Post      *Post `json:"-" xml:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	PostID    int   `gorm:"index"`
+	User      *User `json:"-" xml:"-" gorm:"constraint:OnDelete:SET NULL;"`
+	UserID    *int
+	Title     string
+	Body      string
+	CreatedAt time.Time
+}
+
+// Attachment is a file uploaded to a post. Its content is kept in a
+// blob store under Key, the thumbnail of an image under ThumbKey.
+// Attachments of permanently deleted posts lose their PostID until
+// their blobs are deleted too.
+type Attachment struct {
+	ID          int
+	Post        *Post `json:"-" xml:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	PostID      *int  `gorm:"index"`
+	User        *User `json:"-" xml:"-" gorm:"constraint:OnDelete:SET NULL;"`
+	UserID      *int
+	Name        string
+	ContentType string
+	Size        int64
+	Key         string
+	ThumbKey    string
+	// Width and Height are set for images.
+	Width     int
+	Height    int
+	CreatedAt time.Time
+}
+
+// Path is the URL path of the file, which ends with its name.
+func (a *Attachment) Path() string {
+	return fmt.Sprintf("/attachments/%d/%s", a.ID, url.PathEscape(a.Name))
+}
+
+// ThumbPath is the URL path of the thumbnail of an image.
+func (a *Attachment) ThumbPath() string {
+	return fmt.Sprintf("/thumbnails/%d", a.ID)
 }
 
 type Comment struct {
 	Post   *Post `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	PostID int
 	ID     int
+	// ParentID is the comment this one replies to, nil for top level
+	// comments. Replies are deleted with their parent.
+	ParentID *int `gorm:"index" json:",omitempty" xml:",omitempty"`
+	// UserID is the signed in author, nil for imported comments.
+	UserID *int `gorm:"index" json:",omitempty" xml:",omitempty"`
 	Name   string
 	Email  string
 	Body   string
+	// Status is one of the Comment* statuses, only approved comments
+	// are public.
+	Status    string `gorm:"index;default:approved"`
+	CreatedAt time.Time
+	// EditedAt is set when the body is changed after posting.
+	EditedAt *time.Time `json:",omitempty" xml:",omitempty"`
+	// IP, BodyHash, SpamScore and FilterNotes are set by the content
+	// filters, only moderators see them.
+	IP          string  `json:"-" xml:"-"`
+	BodyHash    string  `gorm:"index" json:"-" xml:"-"`
+	SpamScore   float64 `json:"-" xml:"-"`
+	FilterNotes string  `json:"-" xml:"-"`
+	// Trained is the class, spam or ham, the spam classifier learned
+	// from this comment.
+	Trained string `json:"-" xml:"-"`
+	// DeletedAt is set while the comment is in the trash. Comments
+	// deleted with their post or parent share its DeletedAt.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-" xml:"-"`
+}
+
+// Classes of comments learned by the spam classifier.
+const (
+	ClassSpam = "spam"
+	ClassHam  = "ham"
+)
+
+// SpamToken counts in how many spam and ham comments a word occurred.
+type SpamToken struct {
+	Token string `gorm:"primaryKey"`
+	Spam  int64
+	Ham   int64
+}
+
+// Statuses of comments.
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentRejected = "rejected"
+	CommentSpam     = "spam"
+)
+
+// CommentStatuses lists the statuses of comments.
+var CommentStatuses = []string{CommentPending, CommentApproved, CommentRejected, CommentSpam}
+
+func ValidCommentStatus(status string) bool {
+	for _, s := range CommentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CommentNode is a comment with its replies. Depth is 0 for top level
+// comments.
+type CommentNode struct {
+	Comment
+	Depth   int            `json:"-" xml:"-"`
+	Replies []*CommentNode `json:",omitempty" xml:"Reply,omitempty"`
+	parent  *CommentNode
+}
+
+// CommentTree arranges comments, ordered so that parents come before
+// their replies, into threads. Threads are at most maxDepth levels deep,
+// deeper replies are added to the replies of their ancestor on the last
+// level before it; a maxDepth of 0 or less does not limit the depth.
+// Comments whose parent is missing become top level comments.
+func CommentTree(comments []Comment, maxDepth int) []*CommentNode {
+	roots := make([]*CommentNode, 0)
+	nodes := make(map[int]*CommentNode, len(comments))
+	for _, comment := range comments {
+		node := &CommentNode{Comment: comment}
+		nodes[comment.ID] = node
+		var parent *CommentNode
+		if comment.ParentID != nil {
+			parent = nodes[*comment.ParentID]
+		}
+		for parent != nil && maxDepth > 0 && parent.Depth+1 >= maxDepth {
+			parent = parent.parent
+		}
+		if parent == nil {
+			roots = append(roots, node)
+			continue
+		}
+		node.parent = parent
+		node.Depth = parent.Depth + 1
+		parent.Replies = append(parent.Replies, node)
+	}
+	return roots
 }
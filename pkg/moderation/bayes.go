@@ -0,0 +1,112 @@
+package moderation
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/vestlog/nix/pkg/models"
+)
+
+// TokenStore holds what the classifier learned from moderator decisions.
+type TokenStore interface {
+	GetSpamTokens(tokens []string) ([]models.SpamToken, error)
+	CountTrainedComments() (spam int64, ham int64, err error)
+}
+
+var (
+	minTokenLength = 3
+	maxTokenLength = 24
+	// interestingTokens is the number of tokens, those with probabilities
+	// furthest from neutral, which decide the score of a comment.
+	interestingTokens = 15
+)
+
+// Tokenize returns the distinct words of text the classifier learns.
+func Tokenize(text string) []string {
+	seen := make(map[string]bool)
+	tokens := make([]string, 0)
+	for _, word := range words(text) {
+		length := len([]rune(word))
+		if length < minTokenLength || length > maxTokenLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// Bayes is a naive Bayes classifier. It holds comments with a spam
+// probability of at least HoldScore and marks them as spam from
+// SpamScore on, once it learned from MinTraining spam and MinTraining
+// ham comments.
+type Bayes struct {
+	Store       TokenStore
+	MinTraining int64
+	HoldScore   float64
+	SpamScore   float64
+}
+
+func (b *Bayes) Name() string { return "bayes" }
+
+// Probability returns the probability that text is spam, and whether
+// the classifier learned enough to tell.
+func (b *Bayes) Probability(text string) (float64, bool, error) {
+	spam, ham, err := b.Store.CountTrainedComments()
+	if err != nil {
+		return 0, false, err
+	}
+	if spam < b.MinTraining || ham < b.MinTraining || spam == 0 || ham == 0 {
+		return 0, false, nil
+	}
+	known, err := b.Store.GetSpamTokens(Tokenize(text))
+	if err != nil {
+		return 0, false, err
+	}
+	probabilities := make([]float64, 0, len(known))
+	for _, token := range known {
+		n := float64(token.Spam + token.Ham)
+		if n == 0 {
+			continue
+		}
+		inSpam := float64(token.Spam) / float64(spam)
+		inHam := float64(token.Ham) / float64(ham)
+		p := inSpam / (inSpam + inHam)
+		// rarely seen tokens are pulled towards neutral
+		p = (0.5 + n*p) / (1 + n)
+		probabilities = append(probabilities, math.Min(math.Max(p, 0.01), 0.99))
+	}
+	if len(probabilities) == 0 {
+		return 0.5, true, nil
+	}
+	sort.Slice(probabilities, func(i, j int) bool {
+		return math.Abs(probabilities[i]-0.5) > math.Abs(probabilities[j]-0.5)
+	})
+	if len(probabilities) > interestingTokens {
+		probabilities = probabilities[:interestingTokens]
+	}
+	eta := 0.0
+	for _, p := range probabilities {
+		eta += math.Log(1-p) - math.Log(p)
+	}
+	return 1 / (1 + math.Exp(eta)), true, nil
+}
+
+func (b *Bayes) Check(in *Input) (Result, error) {
+	p, trained, err := b.Probability(in.Comment.Body)
+	if err != nil || !trained {
+		return Result{}, err
+	}
+	result := Result{Score: p}
+	switch {
+	case p >= b.SpamScore:
+		result.Action = Spam
+	case p >= b.HoldScore:
+		result.Action = Hold
+	}
+	if result.Action != Allow {
+		result.Reason = "spam probability " + strconv.FormatFloat(p, 'f', 2, 64)
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/vestlog/nix/pkg/models"
+)
+
+type memoryTokens struct {
+	tokens    map[string]*models.SpamToken
+	spam, ham int64
+}
+
+func (m *memoryTokens) learn(class string, text string) {
+	if class == models.ClassSpam {
+		m.spam++
+	} else {
+		m.ham++
+	}
+	for _, token := range Tokenize(text) {
+		if m.tokens[token] == nil {
+			m.tokens[token] = &models.SpamToken{Token: token}
+		}
+		if class == models.ClassSpam {
+			m.tokens[token].Spam++
+		} else {
+			m.tokens[token].Ham++
+		}
+	}
+}
+
+func (m *memoryTokens) GetSpamTokens(tokens []string) ([]models.SpamToken, error) {
+	data := make([]models.SpamToken, 0)
+	for _, token := range tokens {
+		if known, ok := m.tokens[token]; ok {
+			data = append(data, *known)
+		}
+	}
+	return data, nil
+}
+
+func (m *memoryTokens) CountTrainedComments() (int64, int64, error) {
+	return m.spam, m.ham, nil
+}
+
+func TestBayes(t *testing.T) {
+	store := &memoryTokens{tokens: make(map[string]*models.SpamToken)}
+	bayes := &Bayes{Store: store, MinTraining: 2, HoldScore: 0.7, SpamScore: 0.95}
+	if _, trained, _ := bayes.Probability("anything"); trained {
+		t.Error("untrained classifier gives a probability")
+	}
+	for i := 0; i < 3; i++ {
+		store.learn(models.ClassSpam, "cheap pills online casino bonus offer")
+		store.learn(models.ClassHam, "thanks for the great article about golang channels")
+	}
+	spam, _, _ := bayes.Probability("cheap casino bonus")
+	ham, _, _ := bayes.Probability("great article about channels")
+	if spam < 0.95 || ham > 0.05 {
+		t.Errorf("spam probability %f, ham probability %f", spam, ham)
+	}
+	if result, _ := bayes.Check(input("cheap pills bonus")); result.Action != Spam {
+		t.Errorf("spam is not detected: %+v", result)
+	}
+	if got := Tokenize("Go is fun, FUN and fun!"); len(got) != 2 || got[0] != "fun" || got[1] != "and" {
+		t.Errorf("unexpected tokens %v", got)
+	}
+}
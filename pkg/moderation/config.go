@@ -0,0 +1,103 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// FilterConfig configures the content filters run on new comments.
+// Zero values get the defaults noted on the fields.
+type FilterConfig struct {
+	// Blocklist words and BlockPatterns regular expressions mark
+	// comments as spam.
+	Blocklist     []string
+	BlockPatterns []string
+	// MaxLinks holds comments with more links (2), and marks comments
+	// with more than twice as many as spam.
+	MaxLinks int
+	// DuplicateWindow rejects repeated comment bodies (24h).
+	DuplicateWindow string
+	// PerUser and PerIP limit the comments within RateWindow (5 and 10
+	// per 10m); negative limits are not checked.
+	RateWindow string
+	PerUser    int64
+	PerIP      int64
+	// The classifier holds comments from BayesHold and marks them as
+	// spam from BayesSpam (0.7 and 0.95) once moderators decided on
+	// BayesMinTraining spam and ham comments (10).
+	BayesMinTraining int64
+	BayesHold        float64
+	BayesSpam        float64
+}
+
+// FilterStore is what the content filters read from the database.
+type FilterStore interface {
+	CommentCounter
+	TokenStore
+}
+
+// Pipeline returns the content filters.
+func (fc FilterConfig) Pipeline(store FilterStore) (*Pipeline, error) {
+	blocklist := &Blocklist{Words: fc.Blocklist}
+	for _, pattern := range fc.BlockPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid block pattern %q: %w", pattern, err)
+		}
+		blocklist.Patterns = append(blocklist.Patterns, re)
+	}
+	duplicateWindow, err := parseDuration(fc.DuplicateWindow, 24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("error: invalid DuplicateWindow: %w", err)
+	}
+	rateWindow, err := parseDuration(fc.RateWindow, 10*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("error: invalid RateWindow: %w", err)
+	}
+	links := &LinkLimit{Max: fc.MaxLinks}
+	if links.Max == 0 {
+		links.Max = 2
+	}
+	rate := &RateLimit{
+		Counter: store,
+		Window:  rateWindow,
+		PerUser: fc.PerUser,
+		PerIP:   fc.PerIP,
+	}
+	if rate.PerUser == 0 {
+		rate.PerUser = 5
+	}
+	if rate.PerIP == 0 {
+		rate.PerIP = 10
+	}
+	bayes := &Bayes{
+		Store:       store,
+		MinTraining: fc.BayesMinTraining,
+		HoldScore:   fc.BayesHold,
+		SpamScore:   fc.BayesSpam,
+	}
+	if bayes.MinTraining == 0 {
+		bayes.MinTraining = 10
+	}
+	if bayes.HoldScore == 0 {
+		bayes.HoldScore = 0.7
+	}
+	if bayes.SpamScore == 0 {
+		bayes.SpamScore = 0.95
+	}
+	return &Pipeline{Filters: []Filter{
+		blocklist,
+		links,
+		&Duplicate{Counter: store, Window: duplicateWindow},
+		rate,
+		bayes,
+	}}, nil
+}
+
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,286 @@
+package moderation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/vestlog/nix/pkg/models"
+)
+
+// Action is what a filter wants done with a comment. Higher actions
+// win when several filters disagree.
+type Action int
+
+const (
+	// Allow leaves the status to the Policy.
+	Allow Action = iota
+	// Hold makes the comment pending.
+	Hold
+	// Spam stores the comment as spam.
+	Spam
+	// Reject does not store the comment at all.
+	Reject
+)
+
+// ErrRateLimited is the error of Reject results of RateLimit.
+var ErrRateLimited = errors.New("too many comments, try again later")
+
+// Input is a comment to check. Comment has its UserID, IP and BodyHash
+// set. Edit is set for changed bodies of stored comments, which are not
+// counted against duplicates and rate limits.
+type Input struct {
+	Comment *models.Comment
+	Now     time.Time
+	Edit    bool
+}
+
+// Result is the verdict of one filter. Score is the spam probability
+// from 0 to 1, Reason is shown to moderators, and to the author if the
+// comment is rejected.
+type Result struct {
+	Action Action
+	Score  float64
+	Reason string
+}
+
+// Filter checks new comments.
+type Filter interface {
+	Name() string
+	Check(in *Input) (Result, error)
+}
+
+// Decision combines the results of all filters: the highest action and
+// score, and the reasons of filters which did not allow the comment.
+// Rejection is the reason of the first filter which rejected it.
+type Decision struct {
+	Action    Action
+	Score     float64
+	Reasons   []string
+	Rejection string
+}
+
+// Notes returns the reasons for moderators.
+func (d Decision) Notes() string {
+	return strings.Join(d.Reasons, "; ")
+}
+
+// Pipeline runs all its filters on every comment.
+type Pipeline struct {
+	Filters []Filter
+}
+
+func (p *Pipeline) Run(in *Input) (Decision, error) {
+	var decision Decision
+	if p == nil {
+		return decision, nil
+	}
+	for _, filter := range p.Filters {
+		result, err := filter.Check(in)
+		if err != nil {
+			return decision, fmt.Errorf("error: filter %s: %w", filter.Name(), err)
+		}
+		if result.Score > decision.Score {
+			decision.Score = result.Score
+		}
+		if result.Action > decision.Action {
+			decision.Action = result.Action
+		}
+		if result.Action == Reject && decision.Rejection == "" {
+			decision.Rejection = result.Reason
+		}
+		if result.Action != Allow && result.Reason != "" {
+			decision.Reasons = append(decision.Reasons, filter.Name()+": "+result.Reason)
+		}
+	}
+	return decision, nil
+}
+
+// Edit sets a new body of comment and runs the filters on it again.
+// Comments of untrusted authors are held or marked as spam like new
+// ones. On errors comment is not changed.
+func (p *Pipeline) Edit(comment *models.Comment, body string, trusted bool, now time.Time) error {
+	edited := *comment
+	edited.Body = body
+	edited.BodyHash = BodyHash(body)
+	edited.EditedAt = &now
+	decision, err := p.Run(&Input{Comment: &edited, Now: now, Edit: true})
+	if err != nil {
+		return err
+	}
+	if !trusted {
+		edited.Status = decision.Status(edited.Status)
+	}
+	edited.SpamScore = decision.Score
+	edited.FilterNotes = decision.Notes()
+	*comment = edited
+	return nil
+}
+
+// Status returns the status of a comment which the policy would give
+// status, after the decision of the filters. Rejected comments should
+// not be stored, they are spam if they are.
+func (d Decision) Status(status string) string {
+	switch d.Action {
+	case Spam, Reject:
+		return models.CommentSpam
+	case Hold:
+		if status == models.CommentApproved {
+			return models.CommentPending
+		}
+	}
+	return status
+}
+
+// TrainingClass returns the class the classifier learns from a comment
+// a moderator gave status, or "" if it learns nothing from it.
+func TrainingClass(status string) string {
+	switch status {
+	case models.CommentSpam:
+		return models.ClassSpam
+	case models.CommentApproved:
+		return models.ClassHam
+	}
+	return ""
+}
+
+// BodyHash identifies comment bodies which only differ in case and
+// white space.
+func BodyHash(body string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(body)), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Blocklist marks comments containing one of Words, matched as whole
+// words ignoring case, or matching one of Patterns as spam.
+type Blocklist struct {
+	Words    []string
+	Patterns []*regexp.Regexp
+}
+
+func (b *Blocklist) Name() string { return "blocklist" }
+
+func (b *Blocklist) Check(in *Input) (Result, error) {
+	text := in.Comment.Body + " " + in.Comment.Name + " " + in.Comment.Email
+	for _, word := range words(text) {
+		for _, blocked := range b.Words {
+			if word == strings.ToLower(blocked) {
+				return Result{Action: Spam, Score: 1, Reason: fmt.Sprintf("contains %q", blocked)}, nil
+			}
+		}
+	}
+	for _, pattern := range b.Patterns {
+		if pattern.MatchString(in.Comment.Body) {
+			return Result{Action: Spam, Score: 1, Reason: fmt.Sprintf("matches %s", pattern)}, nil
+		}
+	}
+	return Result{}, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+// LinkLimit holds comments with more than Max links, and marks comments
+// with more than twice as many as spam.
+type LinkLimit struct {
+	Max int
+}
+
+func (l *LinkLimit) Name() string { return "links" }
+
+func (l *LinkLimit) Check(in *Input) (Result, error) {
+	links := len(linkPattern.FindAllStringIndex(in.Comment.Body, -1))
+	reason := strconv.Itoa(links) + " links"
+	switch {
+	case links > 2*l.Max:
+		return Result{Action: Spam, Score: 0.9, Reason: reason}, nil
+	case links > l.Max:
+		return Result{Action: Hold, Score: 0.5, Reason: reason}, nil
+	}
+	return Result{}, nil
+}
+
+// CommentCounter counts stored comments created since a time.
+type CommentCounter interface {
+	CountCommentsBodyHash(hash string, userid string, ip string, since time.Time) (int64, error)
+	CountCommentsUserID(userid string, since time.Time) (int64, error)
+	CountCommentsIP(ip string, since time.Time) (int64, error)
+}
+
+// Duplicate rejects comments whose body was already posted within Window
+// by the same user or from the same address, so that short replies of
+// different users do not collide.
+type Duplicate struct {
+	Counter CommentCounter
+	Window  time.Duration
+}
+
+func (d *Duplicate) Name() string { return "duplicate" }
+
+func (d *Duplicate) Check(in *Input) (Result, error) {
+	if in.Edit {
+		return Result{}, nil
+	}
+	var userid string
+	if in.Comment.UserID != nil {
+		userid = strconv.Itoa(*in.Comment.UserID)
+	}
+	count, err := d.Counter.CountCommentsBodyHash(in.Comment.BodyHash, userid, in.Comment.IP, in.Now.Add(-d.Window))
+	if err != nil {
+		return Result{}, err
+	}
+	if count > 0 {
+		return Result{Action: Reject, Score: 0.8, Reason: "the same comment was posted recently"}, nil
+	}
+	return Result{}, nil
+}
+
+// RateLimit rejects comments of users who posted PerUser comments, or
+// of addresses which posted PerIP comments, within Window. A limit of 0
+// is not checked.
+type RateLimit struct {
+	Counter CommentCounter
+	Window  time.Duration
+	PerUser int64
+	PerIP   int64
+}
+
+func (r *RateLimit) Name() string { return "rate" }
+
+func (r *RateLimit) Check(in *Input) (Result, error) {
+	if in.Edit {
+		return Result{}, nil
+	}
+	since := in.Now.Add(-r.Window)
+	if r.PerUser > 0 && in.Comment.UserID != nil {
+		count, err := r.Counter.CountCommentsUserID(strconv.Itoa(*in.Comment.UserID), since)
+		if err != nil {
+			return Result{}, err
+		}
+		if count >= r.PerUser {
+			return Result{Action: Reject, Reason: ErrRateLimited.Error()}, nil
+		}
+	}
+	if r.PerIP > 0 && in.Comment.IP != "" {
+		count, err := r.Counter.CountCommentsIP(in.Comment.IP, since)
+		if err != nil {
+			return Result{}, err
+		}
+		if count >= r.PerIP {
+			return Result{Action: Reject, Reason: ErrRateLimited.Error()}, nil
+		}
+	}
+	return Result{}, nil
+}
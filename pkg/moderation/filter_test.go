@@ -0,0 +1,113 @@
+package moderation
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/vestlog/nix/pkg/models"
+)
+
+type fakeCounter struct {
+	hash, user, ip int64
+}
+
+func (f *fakeCounter) CountCommentsBodyHash(hash string, userid string, ip string, since time.Time) (int64, error) {
+	return f.hash, nil
+}
+
+func (f *fakeCounter) CountCommentsUserID(userid string, since time.Time) (int64, error) {
+	return f.user, nil
+}
+
+func (f *fakeCounter) CountCommentsIP(ip string, since time.Time) (int64, error) {
+	return f.ip, nil
+}
+
+func input(body string) *Input {
+	userid := 1
+	return &Input{
+		Comment: &models.Comment{UserID: &userid, IP: "10.0.0.1", Body: body, BodyHash: BodyHash(body)},
+		Now:     time.Now(),
+	}
+}
+
+func TestFilters(t *testing.T) {
+	blocklist := &Blocklist{
+		Words:    []string{"Casino"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)buy\s+now`)},
+	}
+	links := &LinkLimit{Max: 1}
+	tests := []struct {
+		filter Filter
+		body   string
+		want   Action
+	}{
+		{blocklist, "Best CASINO here", Spam},
+		{blocklist, "casinos are not blocked", Allow},
+		{blocklist, "Buy   now!", Spam},
+		{links, "see https://a.example", Allow},
+		{links, "https://a.example www.b.example", Hold},
+		{links, "http://a http://b http://c", Spam},
+		{&Duplicate{Counter: &fakeCounter{hash: 1}, Window: time.Hour}, "again", Reject},
+		{&Duplicate{Counter: &fakeCounter{}, Window: time.Hour}, "new", Allow},
+		{&RateLimit{Counter: &fakeCounter{user: 3}, Window: time.Minute, PerUser: 3}, "x", Reject},
+		{&RateLimit{Counter: &fakeCounter{ip: 9}, Window: time.Minute, PerUser: 3, PerIP: 10}, "x", Allow},
+		{&RateLimit{Counter: &fakeCounter{ip: 10}, Window: time.Minute, PerIP: 10}, "x", Reject},
+	}
+	for _, test := range tests {
+		result, err := test.filter.Check(input(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Action != test.want {
+			t.Errorf("%s(%q) = %v, want %v", test.filter.Name(), test.body, result.Action, test.want)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline := &Pipeline{Filters: []Filter{
+		&LinkLimit{Max: 1},
+		&Blocklist{Words: []string{"spam"}},
+	}}
+	decision, err := pipeline.Run(input("no links"))
+	if err != nil || decision.Action != Allow || decision.Status(models.CommentApproved) != models.CommentApproved {
+		t.Errorf("clean comment is not allowed: %+v %v", decision, err)
+	}
+	decision, _ = pipeline.Run(input("spam at http://a.example http://b.example"))
+	if decision.Action != Spam || decision.Score != 1 || len(decision.Reasons) != 2 {
+		t.Errorf("unexpected decision %+v", decision)
+	}
+	decision, _ = pipeline.Run(input("http://a.example http://b.example"))
+	if decision.Status(models.CommentApproved) != models.CommentPending {
+		t.Errorf("held comment is approved")
+	}
+	if BodyHash("Hello  World") != BodyHash("hello world\n") {
+		t.Error("body hash depends on case or white space")
+	}
+}
+
+func TestPipelineEdit(t *testing.T) {
+	pipeline := &Pipeline{Filters: []Filter{
+		&Blocklist{Words: []string{"spam"}},
+		&Duplicate{Counter: &fakeCounter{hash: 1}, Window: time.Hour},
+	}}
+	comment := input("original").Comment
+	comment.Status = models.CommentApproved
+	if err := pipeline.Edit(comment, "still fine", false, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if comment.Body != "still fine" || comment.EditedAt == nil || comment.Status != models.CommentApproved {
+		t.Errorf("unexpected edited comment %+v", comment)
+	}
+	pipeline.Edit(comment, "now spam", false, time.Now())
+	if comment.Status != models.CommentSpam || comment.BodyHash != BodyHash("now spam") {
+		t.Errorf("spam edit is not caught: %+v", comment)
+	}
+	comment.Status = models.CommentApproved
+	pipeline.Edit(comment, "trusted spam", true, time.Now())
+	if comment.Status != models.CommentApproved {
+		t.Errorf("edit of trusted author is not approved")
+	}
+}
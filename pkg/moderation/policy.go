@@ -0,0 +1,46 @@
+// Package moderation decides whether new comments are published or
+// held for moderators.
+package moderation
+
+import (
+	"github.com/vestlog/nix/pkg/auth"
+	"github.com/vestlog/nix/pkg/models"
+)
+
+// Policy decides the status of new comments. Comments of TrustedRoles
+// are always approved; otherwise HoldAll holds every comment, and
+// HoldFirst holds comments of users without an approved comment.
+type Policy struct {
+	TrustedRoles []string
+	HoldFirst    bool
+	HoldAll      bool
+}
+
+// DefaultPolicy trusts editors and admins and holds first comments.
+var DefaultPolicy = Policy{
+	TrustedRoles: []string{auth.RoleAdmin, auth.RoleEditor},
+	HoldFirst:    true,
+}
+
+func (p Policy) Trusted(role string) bool {
+	for _, r := range p.TrustedRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the status of a new comment by a user with role who
+// has approved earlier comments.
+func (p Policy) Status(role string, approved int64) string {
+	switch {
+	case p.Trusted(role):
+		return models.CommentApproved
+	case p.HoldAll:
+		return models.CommentPending
+	case p.HoldFirst && approved == 0:
+		return models.CommentPending
+	}
+	return models.CommentApproved
+}
@@ -0,0 +1,29 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/vestlog/nix/pkg/models"
+)
+
+func TestPolicyStatus(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		role     string
+		approved int64
+		want     string
+	}{
+		{DefaultPolicy, "editor", 0, models.CommentApproved},
+		{DefaultPolicy, "commenter", 0, models.CommentPending},
+		{DefaultPolicy, "commenter", 1, models.CommentApproved},
+		{Policy{HoldAll: true}, "commenter", 5, models.CommentPending},
+		{Policy{TrustedRoles: []string{"author"}, HoldAll: true}, "author", 0, models.CommentApproved},
+		{Policy{}, "commenter", 0, models.CommentApproved},
+	}
+	for _, test := range tests {
+		if got := test.policy.Status(test.role, test.approved); got != test.want {
+			t.Errorf("%+v.Status(%s, %d) = %s, want %s",
+				test.policy, test.role, test.approved, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package sessions
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/securecookie"
+)
+
+var (
+	// CSRFKey is the session value holding the synchronizer token.
+	CSRFKey = "csrf"
+	// CSRFField is the form field and CSRFHeader the header the token
+	// is sent back in.
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+
+	ErrCSRF = errors.New("invalid CSRF token")
+)
+
+// CSRFToken returns the CSRF token of the session, creating it first
+// if the session has none.
+func (s *SessionStore) CSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if token, err := s.GetString(r, CSRFKey); err == nil && token != "" {
+		return token, nil
+	}
+	key := securecookie.GenerateRandomKey(32)
+	if key == nil {
+		return "", fmt.Errorf("error: could not generate CSRF token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(key)
+	if err := s.SaveString(w, r, CSRFKey, token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CheckCSRF compares the token sent with the request, in CSRFHeader or
+// CSRFField, with the token of the session.
+func (s *SessionStore) CheckCSRF(r *http.Request) error {
+	expected, err := s.GetString(r, CSRFKey)
+	if err != nil || expected == "" {
+		return ErrCSRF
+	}
+	token := r.Header.Get(CSRFHeader)
+	if token == "" {
+		token = r.FormValue(CSRFField)
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
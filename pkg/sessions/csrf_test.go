@@ -0,0 +1,48 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	store := CreateDBStore("session", memoryBackend{}, "user", []byte("0123456789abcdef0123456789abcdef"))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	token, err := store.CSRFToken(rec, req)
+	if err != nil || token == "" {
+		t.Fatalf("could not create token: %v", err)
+	}
+	if again, _ := store.CSRFToken(rec, req); again != token {
+		t.Errorf("token changed within a session")
+	}
+	cookie := rec.Result().Cookies()[0]
+
+	post := func(value string) *http.Request {
+		form := url.Values{CSRFField: {value}}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		return req
+	}
+	if err := store.CheckCSRF(post(token)); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+	if err := store.CheckCSRF(post("forged")); err != ErrCSRF {
+		t.Errorf("forged token: expected ErrCSRF, got %v", err)
+	}
+	req = post("")
+	req.Header.Set(CSRFHeader, token)
+	if err := store.CheckCSRF(req); err != nil {
+		t.Errorf("token in header rejected: %v", err)
+	}
+	// without a session there is no token to match
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(CSRFHeader, token)
+	if err := store.CheckCSRF(req); err != ErrCSRF {
+		t.Errorf("request without session: expected ErrCSRF, got %v", err)
+	}
+}
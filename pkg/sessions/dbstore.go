@@ -0,0 +1,250 @@
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/vestlog/nix/pkg/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// DefaultMaxAge is the lifetime of new sessions in seconds.
+	DefaultMaxAge = 86400 * 30
+	// CleanupInterval is how often expired sessions are deleted.
+	CleanupInterval = time.Hour
+	// TouchInterval limits how often the last activity of a session
+	// is written for IdleTimeout.
+	TouchInterval = time.Minute
+)
+
+// Backend persists the sessions of a DBStore. storage.GormDatabase
+// implements it.
+type Backend interface {
+	SaveSession(session *models.Session) error
+	GetSession(id string) (*models.Session, error)
+	TouchSession(id string, now time.Time) error
+	DeleteSession(id string) error
+	DeleteExpiredSessions(now time.Time, idleSince time.Time) (int64, error)
+}
+
+// DBStore is a sessions.Store which keeps session values in the database
+// and only a signed random session ID in the cookie, so sessions can be
+// listed and revoked.
+//
+// A session ends Options.MaxAge after it was created, however often it is
+// used, or after IdleTimeout without requests, if IdleTimeout is set.
+type DBStore struct {
+	Backend Backend
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+	// UserKey is the session value holding the int ID of the signed in
+	// user. It is copied to Session.UserID to find sessions of a user.
+	UserKey     string
+	IdleTimeout time.Duration
+}
+
+// NewDBStore returns a store backed by the database. keyPairs sign the
+// session ID cookie as in sessions.NewCookieStore.
+func NewDBStore(backend Backend, userKey string, keyPairs ...[]byte) *DBStore {
+	store := &DBStore{
+		Backend: backend,
+		Codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   DefaultMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		UserKey: userKey,
+	}
+	store.MaxAge(DefaultMaxAge)
+	return store
+}
+
+func CreateDBStore(name string, backend Backend, userKey string, keyPairs ...[]byte) *SessionStore {
+	return &SessionStore{
+		Store: NewDBStore(backend, userKey, keyPairs...),
+		Name:  name,
+	}
+}
+
+// HashID returns the key a session is stored under. Only hashes of
+// session IDs are written to the database, so reading it does not
+// reveal valid cookies.
+func HashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *DBStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the
+// registry. Unknown and expired sessions are replaced by new ones.
+func (s *DBStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.Codecs...); err != nil {
+		session.ID = ""
+		return session, err
+	}
+	err = s.load(session)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		session.ID = ""
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+func (s *DBStore) load(session *sessions.Session) error {
+	id := HashID(session.ID)
+	stored, err := s.Backend.GetSession(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if s.expired(stored, now) {
+		if err := s.Backend.DeleteSession(id); err != nil {
+			return fmt.Errorf("error: could not delete session: %w", err)
+		}
+		return gorm.ErrRecordNotFound
+	}
+	if s.IdleTimeout > 0 && now.Sub(stored.UpdatedAt) > TouchInterval {
+		if err := s.Backend.TouchSession(id, now); err != nil {
+			return fmt.Errorf("error: could not touch session: %w", err)
+		}
+	}
+	values := make(map[interface{}]interface{})
+	if err := gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&values); err != nil {
+		return fmt.Errorf("error: could not decode session: %w", err)
+	}
+	session.Values = values
+	return nil
+}
+
+func (s *DBStore) expired(stored *models.Session, now time.Time) bool {
+	if !now.Before(stored.ExpiresAt) {
+		return true
+	}
+	return s.IdleTimeout > 0 && now.Sub(stored.UpdatedAt) > s.IdleTimeout
+}
+
+// Renew gives session a new ID and removes the old one from the
+// database. Renewing on sign in prevents session fixation.
+func (s *DBStore) Renew(session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.Backend.DeleteSession(HashID(session.ID)); err != nil {
+			return fmt.Errorf("error: could not delete session: %w", err)
+		}
+	}
+	session.ID = ""
+	return nil
+}
+
+// Save writes the session to the database and its ID to the cookie.
+// The expiry of a session is set when it is created and not extended
+// by later saves. A MaxAge <= 0 deletes the session.
+func (s *DBStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := s.Backend.DeleteSession(HashID(session.ID)); err != nil {
+				return fmt.Errorf("error: could not delete session: %w", err)
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(
+			base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return fmt.Errorf("error: could not encode session: %w", err)
+	}
+	stored := &models.Session{
+		ID:        HashID(session.ID),
+		Data:      data.Bytes(),
+		UserAgent: r.UserAgent(),
+		IP:        remoteIP(r),
+		ExpiresAt: time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	if userID, ok := session.Values[s.UserKey].(int); ok {
+		stored.UserID = &userID
+	}
+	if err := s.Backend.SaveSession(stored); err != nil {
+		return fmt.Errorf("error: could not save session: %w", err)
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// MaxAge sets the lifetime of new sessions and their cookies.
+func (s *DBStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// Cleanup deletes expired and idle sessions every interval until ctx
+// is done.
+func (s *DBStore) Cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var idleSince time.Time
+			if s.IdleTimeout > 0 {
+				idleSince = now.Add(-s.IdleTimeout)
+			}
+			if _, err := s.Backend.DeleteExpiredSessions(now, idleSince); err != nil {
+				log.Printf("error: could not delete expired sessions: %v", err)
+			}
+		}
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
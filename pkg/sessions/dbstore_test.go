@@ -0,0 +1,234 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/vestlog/nix/pkg/models"
+	"gorm.io/gorm"
+)
+
+type memoryBackend map[string]models.Session
+
+func (b memoryBackend) SaveSession(session *models.Session) error {
+	now := time.Now()
+	stored, ok := b[session.ID]
+	if !ok {
+		stored = *session
+		stored.CreatedAt = now
+	}
+	stored.UserID = session.UserID
+	stored.Data = session.Data
+	stored.UpdatedAt = now
+	b[session.ID] = stored
+	return nil
+}
+
+func (b memoryBackend) TouchSession(id string, now time.Time) error {
+	session := b[id]
+	session.UpdatedAt = now
+	b[id] = session
+	return nil
+}
+
+func (b memoryBackend) GetSession(id string) (*models.Session, error) {
+	session, ok := b[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+func (b memoryBackend) DeleteSession(id string) error {
+	delete(b, id)
+	return nil
+}
+
+func (b memoryBackend) DeleteExpiredSessions(now time.Time, idleSince time.Time) (int64, error) {
+	var n int64
+	for id, session := range b {
+		if !session.ExpiresAt.After(now) || session.UpdatedAt.Before(idleSince) {
+			delete(b, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// roundTrip saves value in a new session and returns the cookie.
+func roundTrip(t *testing.T, store *SessionStore, value int) *http.Cookie {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := store.SaveData(rec, req, "user", value); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected 1 cookie, got %v", cookies)
+	}
+	return cookies[0]
+}
+
+func TestDBStore(t *testing.T) {
+	backend := memoryBackend{}
+	store := CreateDBStore("session", backend, "user", []byte("0123456789abcdef0123456789abcdef"))
+	cookie := roundTrip(t, store, 7)
+	if !cookie.HttpOnly {
+		t.Error("session cookie is not HttpOnly")
+	}
+	if len(backend) != 1 {
+		t.Fatalf("expected 1 stored session, got %d", len(backend))
+	}
+	for id, session := range backend {
+		if session.UserID == nil || *session.UserID != 7 {
+			t.Errorf("user ID is not stored: %v", session.UserID)
+		}
+		if id == cookie.Value {
+			t.Error("session is stored under the cookie value")
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	value, err := store.GetData(req, "user")
+	if err != nil || value != 7 {
+		t.Errorf("expected 7, got %v: %v", value, err)
+	}
+
+	// a revoked session is replaced by an empty one
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	backend.DeleteSession(HashID(store.ID(req)))
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if value, _ := store.GetData(req, "user"); value != nil {
+		t.Errorf("revoked session returned %v", value)
+	}
+}
+
+func TestDBStoreExpired(t *testing.T) {
+	backend := memoryBackend{}
+	store := CreateDBStore("session", backend, "user", []byte("0123456789abcdef0123456789abcdef"))
+	cookie := roundTrip(t, store, 1)
+	for id, session := range backend {
+		session.ExpiresAt = time.Now().Add(-time.Minute)
+		backend[id] = session
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if value, _ := store.GetData(req, "user"); value != nil {
+		t.Errorf("expired session returned %v", value)
+	}
+	if len(backend) != 0 {
+		t.Error("expired session is not deleted")
+	}
+}
+
+func TestDBStoreDelete(t *testing.T) {
+	backend := memoryBackend{}
+	store := CreateDBStore("session", backend, "user", []byte("0123456789abcdef0123456789abcdef"))
+	cookie := roundTrip(t, store, 1)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	if err := store.DeleteSession(rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend) != 0 {
+		t.Errorf("session is not deleted")
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("session cookie is not removed: %v", cookies)
+	}
+}
+
+func TestDBStoreForgedCookie(t *testing.T) {
+	store := CreateDBStore("session", memoryBackend{}, "user", []byte("0123456789abcdef0123456789abcdef"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(sessions.NewCookie("session", "forged", &sessions.Options{}))
+	if _, err := store.GetData(req, "user"); err == nil {
+		t.Error("forged cookie is accepted")
+	}
+}
+
+func TestDBStoreIdleTimeout(t *testing.T) {
+	backend := memoryBackend{}
+	store := CreateDBStore("session", backend, "user", []byte("0123456789abcdef0123456789abcdef"))
+	store.Store.(*DBStore).IdleTimeout = time.Hour
+	cookie := roundTrip(t, store, 1)
+	idle := func(d time.Duration) {
+		for id, session := range backend {
+			session.UpdatedAt = time.Now().Add(-d)
+			backend[id] = session
+		}
+	}
+	get := func() interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		value, _ := store.GetData(req, "user")
+		return value
+	}
+
+	idle(30 * time.Minute)
+	if value := get(); value != 1 {
+		t.Fatalf("active session returned %v", value)
+	}
+	for _, session := range backend {
+		if time.Since(session.UpdatedAt) > time.Minute {
+			t.Errorf("last activity is not updated: %v", session.UpdatedAt)
+		}
+	}
+	idle(2 * time.Hour)
+	if value := get(); value != nil {
+		t.Errorf("idle session returned %v", value)
+	}
+	if len(backend) != 0 {
+		t.Errorf("idle session is not deleted")
+	}
+}
+
+func TestDBStoreRenew(t *testing.T) {
+	backend := memoryBackend{}
+	store := CreateDBStore("session", backend, "user", []byte("0123456789abcdef0123456789abcdef"))
+	cookie := roundTrip(t, store, 1)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	old := store.ID(req)
+	rec := httptest.NewRecorder()
+	if err := store.Renew(rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend[HashID(old)]; ok {
+		t.Error("old session is kept")
+	}
+	req = next(rec)
+	if store.ID(req) == old {
+		t.Error("session ID is not changed")
+	}
+	if value, _ := store.GetData(req, "user"); value != 1 {
+		t.Errorf("values are lost on renew, got %v", value)
+	}
+}
+
+func TestDBStoreKeyRotation(t *testing.T) {
+	backend := memoryBackend{}
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+	cookie := roundTrip(t, CreateDBStore("session", backend, "user", oldKey), 1)
+
+	rotated := CreateDBStore("session", backend, "user", newKey, nil, oldKey, nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if value, err := rotated.GetData(req, "user"); value != 1 {
+		t.Errorf("cookie signed by the old key rejected: %v", err)
+	}
+	removed := CreateDBStore("session", backend, "user", newKey)
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if _, err := removed.GetData(req, "user"); err == nil {
+		t.Error("cookie signed by a removed key accepted")
+	}
+}
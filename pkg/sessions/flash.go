@@ -0,0 +1,89 @@
+package sessions
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Kinds of flash messages.
+const (
+	FlashInfo    = "info"
+	FlashSuccess = "success"
+	FlashError   = "error"
+)
+
+// FormKey is the session value holding form values saved for the
+// next request.
+var FormKey = "form"
+
+// Flash is a message shown once on the next page.
+type Flash struct {
+	Kind    string
+	Message string
+}
+
+func init() {
+	gob.Register(Flash{})
+	gob.Register(url.Values{})
+}
+
+// AddFlash queues a message until it is read by Flashes.
+func (s *SessionStore) AddFlash(w http.ResponseWriter, r *http.Request, kind string, message string) error {
+	session, err := s.Store.Get(r, s.Name)
+	if err != nil {
+		return fmt.Errorf("error: could not get session from store: %w", err)
+	}
+	session.AddFlash(Flash{Kind: kind, Message: message})
+	if err := session.Save(r, w); err != nil {
+		return fmt.Errorf("error: could not save session to store: %w", err)
+	}
+	return nil
+}
+
+// Flashes returns the queued messages and removes them from the session.
+func (s *SessionStore) Flashes(w http.ResponseWriter, r *http.Request) ([]Flash, error) {
+	session, err := s.Store.Get(r, s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error: could not get session from store: %w", err)
+	}
+	values := session.Flashes()
+	if len(values) == 0 {
+		return nil, nil
+	}
+	flashes := make([]Flash, 0, len(values))
+	for _, value := range values {
+		if flash, ok := value.(Flash); ok {
+			flashes = append(flashes, flash)
+		}
+	}
+	if err := session.Save(r, w); err != nil {
+		return nil, fmt.Errorf("error: could not save session to store: %w", err)
+	}
+	return flashes, nil
+}
+
+// SaveForm keeps submitted form values, so that the form can be filled
+// in again after a redirect.
+func (s *SessionStore) SaveForm(w http.ResponseWriter, r *http.Request, form url.Values) error {
+	return s.SaveData(w, r, FormKey, form)
+}
+
+// TakeForm returns the values saved by SaveForm and removes them.
+// It returns nil if there are none.
+func (s *SessionStore) TakeForm(w http.ResponseWriter, r *http.Request) (url.Values, error) {
+	session, err := s.Store.Get(r, s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error: could not get session from store: %w", err)
+	}
+	form, ok := session.Values[FormKey].(url.Values)
+	if !ok {
+		return nil, nil
+	}
+	delete(session.Values, FormKey)
+	if err := session.Save(r, w); err != nil {
+		return nil, fmt.Errorf("error: could not save session to store: %w", err)
+	}
+	return form, nil
+}
@@ -0,0 +1,60 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// next returns a request carrying the cookies set by rec.
+func next(rec *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestFlashes(t *testing.T) {
+	store := CreateDBStore("session", memoryBackend{}, "user", []byte("0123456789abcdef0123456789abcdef"))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	store.AddFlash(rec, req, FlashError, "title cannot be empty")
+	store.AddFlash(rec, req, FlashInfo, "draft kept")
+
+	req = next(rec)
+	flashes, err := store.Flashes(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Flash{
+		{Kind: FlashError, Message: "title cannot be empty"},
+		{Kind: FlashInfo, Message: "draft kept"},
+	}
+	if !reflect.DeepEqual(flashes, expected) {
+		t.Errorf("expected %v, got %v", expected, flashes)
+	}
+	// messages are shown once
+	if flashes, _ := store.Flashes(httptest.NewRecorder(), next(rec)); len(flashes) != 0 {
+		t.Errorf("flashes are not consumed: %v", flashes)
+	}
+}
+
+func TestSaveForm(t *testing.T) {
+	store := CreateDBStore("session", memoryBackend{}, "user", []byte("0123456789abcdef0123456789abcdef"))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	form := url.Values{"title": {"my title"}, "body": {""}}
+	if err := store.SaveForm(rec, req, form); err != nil {
+		t.Fatal(err)
+	}
+	result, err := store.TakeForm(httptest.NewRecorder(), next(rec))
+	if err != nil || !reflect.DeepEqual(form, result) {
+		t.Errorf("expected %v, got %v: %v", form, result, err)
+	}
+	if result, _ := store.TakeForm(httptest.NewRecorder(), next(rec)); result != nil {
+		t.Errorf("form is not removed: %v", result)
+	}
+}
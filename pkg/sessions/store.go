@@ -80,6 +80,37 @@ func (s *SessionStore) GetString(r *http.Request, name string) (string, error) {
 	return value, nil
 }
 
+// Renew gives the session a new ID, if the store supports it, and drops
+// its CSRF token. Values are kept. Call it when the user signs in.
+func (s *SessionStore) Renew(w http.ResponseWriter, r *http.Request) error {
+	session, err := s.Store.Get(r, s.Name)
+	if err != nil && session == nil {
+		return fmt.Errorf("error: could not get session from store: %w", err)
+	}
+	if renewer, ok := s.Store.(interface {
+		Renew(*sessions.Session) error
+	}); ok {
+		if err := renewer.Renew(session); err != nil {
+			return err
+		}
+	}
+	delete(session.Values, CSRFKey)
+	if err := session.Save(r, w); err != nil {
+		return fmt.Errorf("error: could not save session to store: %w", err)
+	}
+	return nil
+}
+
+// ID returns the ID of the current session, which is empty for sessions
+// not saved yet.
+func (s *SessionStore) ID(r *http.Request) string {
+	session, err := s.Store.Get(r, s.Name)
+	if err != nil {
+		return ""
+	}
+	return session.ID
+}
+
 func CreateCookieStore(name string, keyPairs ...[]byte) *SessionStore {
 	gob.Register(&models.User{})
 	return &SessionStore{
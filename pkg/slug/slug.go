@@ -0,0 +1,63 @@
+// Package slug turns names and titles into URL path segments.
+package slug
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the maximum number of runes of a slug.
+const MaxLength = 80
+
+// Make lowercases s and joins its runs of letters and digits with
+// hyphens, so "Hello, World!" becomes "hello-world". Letters of any
+// script are kept. The result is empty if s has no letters or digits.
+// Tags and categories are named with it.
+func Make(s string) string {
+	return build(s, nil)
+}
+
+// Latin is Make but spells letters of translit in ASCII, so
+// "Привіт, Світ!" becomes "pryvit-svit". Posts are named with it.
+func Latin(s string) string {
+	return build(s, translit)
+}
+
+func build(s string, spell map[rune]string) string {
+	var b strings.Builder
+	n := 0
+	hyphen := false
+	write := func(r rune) bool {
+		if n == MaxLength {
+			return false
+		}
+		if hyphen {
+			b.WriteRune('-')
+			n++
+			hyphen = false
+			if n == MaxLength {
+				return false
+			}
+		}
+		b.WriteRune(r)
+		n++
+		return true
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			hyphen = b.Len() > 0
+			continue
+		}
+		r = unicode.ToLower(r)
+		ascii, ok := spell[r]
+		if !ok {
+			ascii = string(r)
+		}
+		for _, r := range ascii {
+			if !write(r) {
+				return strings.TrimSuffix(b.String(), "-")
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
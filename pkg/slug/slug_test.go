@@ -0,0 +1,51 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Go  1.16 ", "go-1-16"},
+		{"already-a-slug", "already-a-slug"},
+		{"Привіт, Світ!", "привіт-світ"},
+		{"Crème Brûlée", "crème-brûlée"},
+		{"日本語 text", "日本語-text"},
+		{"!!!", ""},
+		{"", ""},
+		{strings.Repeat("a", 79) + " b", strings.Repeat("a", 79)},
+	}
+	for _, test := range tests {
+		if got := Make(test.in); got != test.want {
+			t.Errorf("Make(%q) = %q, expected %q", test.in, got, test.want)
+		}
+	}
+	if got := Make(strings.Repeat("ab ", 100)); len([]rune(got)) > MaxLength {
+		t.Errorf("slug %q is longer than %d", got, MaxLength)
+	}
+}
+
+func TestLatin(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"Привіт, Світ!", "pryvit-svit"},
+		{"Crème Brûlée", "creme-brulee"},
+		{"Straße", "strasse"},
+		{"日本語 text", "日本語-text"},
+		{"!!!", ""},
+	}
+	for _, test := range tests {
+		if got := Latin(test.in); got != test.want {
+			t.Errorf("Latin(%q) = %q, expected %q", test.in, got, test.want)
+		}
+	}
+	if got := Latin(strings.Repeat("щ", 100)); len([]rune(got)) > MaxLength {
+		t.Errorf("slug %q is longer than %d", got, MaxLength)
+	}
+}
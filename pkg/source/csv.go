@@ -0,0 +1,96 @@
+package source
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vestlog/nix/pkg/models"
+)
+
+var (
+	PostsFile    = "posts.csv"
+	CommentsFile = "comments.csv"
+)
+
+// LoadCSV reads posts.csv (userId, id, title, body) and
+// comments.csv (postId, id, name, email, body) from a directory.
+// Columns are matched by header name, so their order does not matter.
+func LoadCSV(dir string) (*MemorySource, error) {
+	src := &MemorySource{}
+	posts, err := readCSV(filepath.Join(dir, PostsFile))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range posts {
+		post := models.Post{
+			Title: row["title"],
+			Body:  row["body"],
+		}
+		if post.UserID, err = atoi(row, "userid"); err != nil {
+			return nil, err
+		}
+		if post.ID, err = atoi(row, "id"); err != nil {
+			return nil, err
+		}
+		src.Posts = append(src.Posts, post)
+	}
+	comments, err := readCSV(filepath.Join(dir, CommentsFile))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range comments {
+		comment := models.Comment{
+			Name:  row["name"],
+			Email: row["email"],
+			Body:  row["body"],
+		}
+		if comment.PostID, err = atoi(row, "postid"); err != nil {
+			return nil, err
+		}
+		if comment.ID, err = atoi(row, "id"); err != nil {
+			return nil, err
+		}
+		src.Comments = append(src.Comments, comment)
+	}
+	return src, nil
+}
+
+func readCSV(filename string) ([]map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error: could not open csv file: %w", err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error: could not read %s: %w", filename, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("error: %s has no header", filename)
+	}
+	header := records[0]
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, value := range record {
+			row[header[i]] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func atoi(row map[string]string, column string) (int, error) {
+	n, err := strconv.Atoi(row[column])
+	if err != nil {
+		return 0, fmt.Errorf("error: column %s has to be an integer: %w", column, err)
+	}
+	return n, nil
+}
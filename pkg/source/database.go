@@ -0,0 +1,36 @@
+package source
+
+import (
+	"strconv"
+
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/storage"
+)
+
+// DatabaseSource reads from another storage backend, which allows
+// copying data between databases.
+type DatabaseSource struct {
+	DB storage.Database
+}
+
+// GetPosts returns the posts of every status, so that drafts, scheduled
+// and archived posts are copied too.
+func (s *DatabaseSource) GetPosts(userID int) ([]models.Post, error) {
+	posts, err := s.DB.GetPostsAnyStatus()
+	if err != nil {
+		return nil, err
+	}
+	return filterPosts(posts, userID), nil
+}
+
+func (s *DatabaseSource) GetComments(postID int) ([]models.Comment, error) {
+	return s.DB.GetCommentsPostID(strconv.Itoa(postID))
+}
+
+func OpenDatabase(dsn string) (*DatabaseSource, error) {
+	db, err := storage.CreateGormDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &DatabaseSource{db}, nil
+}
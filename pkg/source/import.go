@@ -0,0 +1,60 @@
+package source
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/storage"
+)
+
+type postComments struct {
+	post     models.Post
+	comments []models.Comment
+	err      error
+}
+
+// Import copies posts of the given user and their comments from src to db.
+// Comments are fetched concurrently, but written one at a time.
+func Import(src Source, db storage.Database, userID int) error {
+	posts, err := src.GetPosts(userID)
+	if err != nil {
+		return fmt.Errorf("error getting posts: %w", err)
+	}
+	for i := range posts {
+		if err := db.SavePost(&posts[i]); err != nil {
+			return fmt.Errorf("could not save post: %w", err)
+		}
+	}
+	results := make(chan postComments)
+	wg := &sync.WaitGroup{}
+	for _, post := range posts {
+		wg.Add(1)
+		go func(post models.Post) {
+			defer wg.Done()
+			comments, err := src.GetComments(post.ID)
+			results <- postComments{post, comments, err}
+		}(post)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var firstErr error
+	for result := range results {
+		if firstErr != nil {
+			continue
+		}
+		if result.err != nil {
+			firstErr = fmt.Errorf("error getting comments for post %d: %w", result.post.ID, result.err)
+			continue
+		}
+		for i := range result.comments {
+			if err := db.SaveComment(&result.comments[i]); err != nil {
+				firstErr = fmt.Errorf("could not save comment: %w", err)
+				break
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,122 @@
+package source
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vestlog/nix/pkg/fakeapi"
+	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/storage"
+)
+
+func createDatabase(t *testing.T) *storage.GormDatabase {
+	dsn := filepath.Join(t.TempDir(), "storage.db") + "?_foreign_keys=ON"
+	db, err := storage.CreateGormDatabase(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func startFakeAPI(t *testing.T, opts fakeapi.Options) Source {
+	ts := httptest.NewServer(fakeapi.NewServer(opts))
+	t.Cleanup(ts.Close)
+	src, err := Open(KindAPI, ts.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestImportFromAPI(t *testing.T) {
+	opts := fakeapi.DefaultOptions
+	opts.Latency = time.Millisecond
+	src := startFakeAPI(t, opts)
+	db := createDatabase(t)
+	if err := Import(src, db, 7); err != nil {
+		t.Fatal(err)
+	}
+	posts, err := db.GetPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != opts.PostsPerUser {
+		t.Fatalf("expected %d posts, got %d", opts.PostsPerUser, len(posts))
+	}
+	for _, post := range posts {
+		if post.UserID != 7 {
+			t.Errorf("post %d belongs to user %d, expected 7", post.ID, post.UserID)
+		}
+	}
+	comments, err := db.GetComments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := opts.PostsPerUser * opts.CommentsPerPost; len(comments) != expected {
+		t.Errorf("expected %d comments, got %d", expected, len(comments))
+	}
+}
+
+func TestImportFromAPIFaults(t *testing.T) {
+	faults := map[string]fakeapi.Options{
+		"server error": {ErrorRate: 1},
+		"rate limit":   {RateLimitRate: 1},
+		"malformed":    {MalformedRate: 1},
+	}
+	for name, fault := range faults {
+		opts := fakeapi.DefaultOptions
+		opts.ErrorRate = fault.ErrorRate
+		opts.RateLimitRate = fault.RateLimitRate
+		opts.MalformedRate = fault.MalformedRate
+		src := startFakeAPI(t, opts)
+		db := createDatabase(t)
+		if err := Import(src, db, 1); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+		if posts, _ := db.GetPosts(); len(posts) != 0 {
+			t.Errorf("%s: expected no posts saved, got %d", name, len(posts))
+		}
+	}
+}
+
+func TestImportDatabaseToDatabase(t *testing.T) {
+	opts := fakeapi.DefaultOptions
+	opts.Users = 3
+	from := createDatabase(t)
+	if err := Import(startFakeAPI(t, opts), from, 0); err != nil {
+		t.Fatal(err)
+	}
+	draft, err := from.GetPost("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := from.DB.Model(draft).Update("status", models.PostDraft).Error; err != nil {
+		t.Fatal(err)
+	}
+	to := createDatabase(t)
+	if err := Import(&DatabaseSource{from}, to, 0); err != nil {
+		t.Fatal(err)
+	}
+	posts, _ := to.GetPosts()
+	if expected := opts.Users*opts.PostsPerUser - 1; len(posts) != expected {
+		t.Errorf("expected %d published posts, got %d", expected, len(posts))
+	}
+	drafts, _ := to.GetPostsStatus(models.PostDraft, 0)
+	if len(drafts) != 1 || drafts[0].ID != draft.ID {
+		t.Errorf("expected draft post %d, got %v", draft.ID, drafts)
+	}
+	comments, _ := to.GetComments()
+	if expected := len(posts) * opts.CommentsPerPost; len(comments) != expected {
+		t.Errorf("expected %d comments, got %d", expected, len(comments))
+	}
+	draftComments, _ := to.GetCommentsPostID(strconv.Itoa(draft.ID))
+	if len(draftComments) != opts.CommentsPerPost {
+		t.Errorf("expected %d comments of the draft post, got %d", opts.CommentsPerPost, len(draftComments))
+	}
+}
@@ -0,0 +1,21 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LoadJSON reads a dump file of the form {"posts": [...], "comments": [...]}.
+func LoadJSON(filename string) (*MemorySource, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error: could not open dump: %w", err)
+	}
+	defer file.Close()
+	src := &MemorySource{}
+	if err := json.NewDecoder(file).Decode(src); err != nil {
+		return nil, fmt.Errorf("error: could not decode dump: %w", err)
+	}
+	return src, nil
+}
@@ -0,0 +1,83 @@
+package source
+
+import (
+	"fmt"
+
+	cl "github.com/vestlog/nix/pkg/client"
+	"github.com/vestlog/nix/pkg/models"
+)
+
+const (
+	KindAPI  = "api"
+	KindJSON = "json"
+	KindCSV  = "csv"
+	KindDB   = "db"
+)
+
+// Source yields posts and comments for the importer.
+// userID 0 means posts of all users.
+type Source interface {
+	GetPosts(userID int) ([]models.Post, error)
+	GetComments(postID int) ([]models.Comment, error)
+}
+
+// Open creates a source of the given kind. location is an API base URL,
+// a JSON dump file, a CSV directory or a database DSN respectively.
+func Open(kind string, location string) (Source, error) {
+	var src Source
+	var err error
+	switch kind {
+	case KindAPI:
+		src, err = cl.CreateAPIClient("", location)
+	case KindJSON:
+		src, err = LoadJSON(location)
+	case KindCSV:
+		src, err = LoadCSV(location)
+	case KindDB:
+		src, err = OpenDatabase(location)
+	default:
+		return nil, fmt.Errorf("error: unknown source kind %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// MemorySource serves posts and comments held in memory. It is what
+// the JSON and CSV loaders produce.
+type MemorySource struct {
+	Posts    []models.Post    `json:"posts"`
+	Comments []models.Comment `json:"comments"`
+}
+
+func (s *MemorySource) GetPosts(userID int) ([]models.Post, error) {
+	return filterPosts(s.Posts, userID), nil
+}
+
+func (s *MemorySource) GetComments(postID int) ([]models.Comment, error) {
+	return filterComments(s.Comments, postID), nil
+}
+
+func filterPosts(posts []models.Post, userID int) []models.Post {
+	if userID == 0 {
+		return posts
+	}
+	result := make([]models.Post, 0)
+	for _, post := range posts {
+		if post.UserID == userID {
+			result = append(result, post)
+		}
+	}
+	return result
+}
+
+func filterComments(comments []models.Comment, postID int) []models.Comment {
+	result := make([]models.Comment, 0)
+	for _, comment := range comments {
+		if comment.PostID == postID {
+			result = append(result, comment)
+		}
+	}
+	return result
+}
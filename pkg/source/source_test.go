@@ -0,0 +1,83 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vestlog/nix/pkg/models"
+)
+
+func write(t *testing.T, filename, data string) {
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "dump.json")
+	write(t, filename, `{
+		"posts": [
+			{"userId": 1, "id": 1, "title": "first", "body": "first body"},
+			{"userId": 2, "id": 2, "title": "second", "body": "second body"}
+		],
+		"comments": [
+			{"postId": 1, "id": 1, "name": "name", "email": "mail@example.com", "body": "comment"}
+		]
+	}`)
+	src, err := LoadJSON(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts, err := src.GetPosts(2)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []models.Post{{UserID: 2, ID: 2, Title: "second", Body: "second body"}}
+	if !reflect.DeepEqual(expected, posts) {
+		t.Errorf("expected %v, got %v", expected, posts)
+	}
+	if posts, _ := src.GetPosts(0); len(posts) != 2 {
+		t.Errorf("expected 2 posts for all users, got %d", len(posts))
+	}
+	comments, err := src.GetComments(1)
+	if err != nil || len(comments) != 1 {
+		t.Errorf("expected 1 comment, got %v, %v", comments, err)
+	}
+}
+
+func TestLoadCSV(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, PostsFile),
+		"id,userId,title,body\n3,7,\"title, with comma\",body\n")
+	write(t, filepath.Join(dir, CommentsFile),
+		"postId,id,name,email,body\n3,10,name,mail@example.com,\"multi\nline\"\n")
+	src, err := LoadCSV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPosts := []models.Post{{UserID: 7, ID: 3, Title: "title, with comma", Body: "body"}}
+	if !reflect.DeepEqual(expectedPosts, src.Posts) {
+		t.Errorf("expected %v, got %v", expectedPosts, src.Posts)
+	}
+	expectedComments := []models.Comment{{PostID: 3, ID: 10, Name: "name", Email: "mail@example.com", Body: "multi\nline"}}
+	if !reflect.DeepEqual(expectedComments, src.Comments) {
+		t.Errorf("expected %v, got %v", expectedComments, src.Comments)
+	}
+}
+
+func TestLoadCSVBadInteger(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, PostsFile), "id,userId,title,body\nx,7,title,body\n")
+	write(t, filepath.Join(dir, CommentsFile), "postId,id,name,email,body\n")
+	if _, err := LoadCSV(dir); err == nil {
+		t.Error("error expected for non-integer id")
+	}
+}
+
+func TestOpenUnknownKind(t *testing.T) {
+	if src, err := Open("ftp", "somewhere"); err == nil || src != nil {
+		t.Errorf("expected error, got %v, %v", src, err)
+	}
+}
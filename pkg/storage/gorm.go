@@ -1,11 +1,19 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 
 	"github.com/vestlog/nix/pkg/models"
+	"github.com/vestlog/nix/pkg/slug"
 )
 
 type GormDatabase struct {
@@ -27,6 +35,321 @@ func (db *GormDatabase) GetUser(id string) (*models.User, error) {
 	return dest, nil
 }
 
+func (db *GormDatabase) GetUserEmail(email string) (*models.User, error) {
+	dest := &models.User{}
+	if err := db.DB.Where("email = ?", email).First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (db *GormDatabase) GetUsers() ([]models.User, error) {
+	data := make([]models.User, 0)
+	if err := db.DB.Order("id").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) SetUserRole(userid string, role string) error {
+	result := db.DB.Model(&models.User{}).Where("id = ?", userid).
+		Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (db *GormDatabase) SaveIdentity(identity *models.Identity) error {
+	return db.DB.Create(identity).Error
+}
+
+func (db *GormDatabase) GetIdentity(provider string, subject string) (*models.Identity, error) {
+	dest := &models.Identity{}
+	if err := db.DB.Preload("User").
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (db *GormDatabase) GetIdentitiesUserID(userid string) ([]models.Identity, error) {
+	data := make([]models.Identity, 0)
+	if err := db.DB.Where("user_id = ?", userid).Order("provider").
+		Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) DeleteIdentity(userid string, provider string) error {
+	return db.DB.Where("user_id = ? AND provider = ?", userid, provider).
+		Delete(&models.Identity{}).Error
+}
+
+func (db *GormDatabase) SaveCredential(credential *models.Credential) error {
+	return db.DB.Create(credential).Error
+}
+
+// CreateAccount saves a new user together with its credential, so that
+// no user is left without one if the username is taken meanwhile.
+func (db *GormDatabase) CreateAccount(user *models.User, credential *models.Credential) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		credential.UserID = user.ID
+		return tx.Create(credential).Error
+	})
+}
+
+func (db *GormDatabase) GetCredential(username string) (*models.Credential, error) {
+	dest := &models.Credential{}
+	if err := db.DB.Preload("User").Where("username = ?", username).
+		First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (db *GormDatabase) GetCredentialUserID(userid string) (*models.Credential, error) {
+	dest := &models.Credential{}
+	if err := db.DB.Preload("User").Where("user_id = ?", userid).
+		First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (db *GormDatabase) UpdateCredential(credential *models.Credential) error {
+	return db.DB.Omit("User").Save(credential).Error
+}
+
+// CountLoginAttempt counts a password attempt of the user before the
+// password is checked, and locks the credential for lockout on the max'th
+// attempt in a row. It reports false without counting while the
+// credential is locked.
+func (db *GormDatabase) CountLoginAttempt(userid string, max int, lockout time.Duration) (bool, error) {
+	return countAttempt(db.DB.Model(&models.Credential{}), userid, max, lockout)
+}
+
+// ResetLoginAttempts clears the attempts and lock of the user's
+// credential after a correct password.
+func (db *GormDatabase) ResetLoginAttempts(userid string) error {
+	return resetAttempts(db.DB.Model(&models.Credential{}), userid)
+}
+
+// countAttempt counts an attempt on the row of the user in a table with
+// failed_attempts and locked_until columns in one statement, so that
+// concurrent attempts cannot get past the limit. The columns are NULL in
+// rows from before they were added.
+func countAttempt(tx *gorm.DB, userid string, max int, lockout time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	result := tx.Where("user_id = ? AND (locked_until IS NULL OR locked_until <= ?)", userid, now).
+		UpdateColumns(map[string]interface{}{
+			"failed_attempts": gorm.Expr(
+				"CASE WHEN COALESCE(failed_attempts, 0) + 1 >= ? THEN 0 ELSE COALESCE(failed_attempts, 0) + 1 END", max),
+			"locked_until": gorm.Expr(
+				"CASE WHEN COALESCE(failed_attempts, 0) + 1 >= ? THEN ? ELSE locked_until END", max, now.Add(lockout)),
+		})
+	return result.RowsAffected != 0, result.Error
+}
+
+func resetAttempts(tx *gorm.DB, userid string) error {
+	return tx.Where("user_id = ?", userid).
+		UpdateColumns(map[string]interface{}{
+			"failed_attempts": 0,
+			"locked_until":    time.Time{},
+		}).Error
+}
+
+func (db *GormDatabase) SaveAPIToken(token *models.APIToken) error {
+	return db.DB.Create(token).Error
+}
+
+func (db *GormDatabase) GetAPIToken(hash string) (*models.APIToken, error) {
+	dest := &models.APIToken{}
+	if err := db.DB.Preload("User").Where("hash = ?", hash).
+		First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (db *GormDatabase) GetAPITokensUserID(userid string) ([]models.APIToken, error) {
+	data := make([]models.APIToken, 0)
+	if err := db.DB.Where("user_id = ?", userid).Order("id").
+		Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) TouchAPIToken(id int, usedAt time.Time) error {
+	return db.DB.Model(&models.APIToken{}).Where("id = ?", id).
+		UpdateColumn("last_used_at", usedAt).Error
+}
+
+// DeleteAPIToken revokes a token. The user ID makes sure only
+// the owner revokes it.
+func (db *GormDatabase) DeleteAPIToken(userid string, id string) error {
+	result := db.DB.Where("user_id = ? AND id = ?", userid, id).
+		Delete(&models.APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (db *GormDatabase) SaveTOTP(totp *models.TOTP) error {
+	return db.DB.Omit("User").Save(totp).Error
+}
+
+func (db *GormDatabase) GetTOTP(userid string) (*models.TOTP, error) {
+	dest := &models.TOTP{}
+	if err := db.DB.Where("user_id = ?", userid).First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// UseTOTPStep stores the time step of a used code, unless the same or a
+// later step was used already.
+func (db *GormDatabase) UseTOTPStep(userid string, step int64) error {
+	result := db.DB.Model(&models.TOTP{}).
+		Where("user_id = ? AND last_step < ?", userid, step).
+		UpdateColumn("last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountTOTPAttempt counts a code entered for the second factor of the
+// user before it is checked, like CountLoginAttempt.
+func (db *GormDatabase) CountTOTPAttempt(userid string, max int, lockout time.Duration) (bool, error) {
+	return countAttempt(db.DB.Model(&models.TOTP{}), userid, max, lockout)
+}
+
+func (db *GormDatabase) ResetTOTPAttempts(userid string) error {
+	return resetAttempts(db.DB.Model(&models.TOTP{}), userid)
+}
+
+// DeleteTOTP disables the second factor and removes its recovery codes.
+func (db *GormDatabase) DeleteTOTP(userid string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userid).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userid).Delete(&models.TOTP{}).Error
+	})
+}
+
+// ReplaceRecoveryCodes removes all recovery codes of the user and saves codes.
+func (db *GormDatabase) ReplaceRecoveryCodes(userid string, codes []models.RecoveryCode) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userid).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Omit("User").Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks an unused code of the user as used.
+func (db *GormDatabase) UseRecoveryCode(userid string, hash string) error {
+	result := db.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", userid, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountRecoveryCodes returns the number of unused codes of the user.
+func (db *GormDatabase) CountRecoveryCodes(userid string) (int64, error) {
+	var count int64
+	err := db.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userid).Count(&count).Error
+	return count, err
+}
+
+// SaveSession inserts a session or updates it. Creation and expiry
+// time are kept on updates.
+func (db *GormDatabase) SaveSession(session *models.Session) error {
+	return db.DB.Omit("User").Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"user_id", "data", "user_agent", "ip", "updated_at",
+		}),
+	}).Create(session).Error
+}
+
+func (db *GormDatabase) TouchSession(id string, now time.Time) error {
+	return db.DB.Model(&models.Session{}).Where("id = ?", id).
+		UpdateColumn("updated_at", now).Error
+}
+
+func (db *GormDatabase) GetSession(id string) (*models.Session, error) {
+	dest := &models.Session{}
+	if err := db.DB.Where("id = ?", id).First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// GetSessionsUserID returns the unexpired sessions of a user, the most
+// recently used first.
+func (db *GormDatabase) GetSessionsUserID(userid string) ([]models.Session, error) {
+	data := make([]models.Session, 0)
+	if err := db.DB.Where("user_id = ? AND expires_at > ?", userid, time.Now()).
+		Order("updated_at DESC").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) DeleteSession(id string) error {
+	return db.DB.Where("id = ?", id).Delete(&models.Session{}).Error
+}
+
+// DeleteSessionUserID revokes a session of the user.
+func (db *GormDatabase) DeleteSessionUserID(userid string, id string) error {
+	result := db.DB.Where("user_id = ? AND id = ?", userid, id).
+		Delete(&models.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes sessions expired at now or unused since
+// idleSince. A zero idleSince only deletes expired sessions.
+func (db *GormDatabase) DeleteExpiredSessions(now time.Time, idleSince time.Time) (int64, error) {
+	result := db.DB.Where("expires_at <= ? OR updated_at < ?", now, idleSince).
+		Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
+
 func (db *GormDatabase) SaveGoogleUser(user *models.GoogleUser) error {
 	if err := db.DB.Create(user).Error; err != nil {
 		return err
@@ -43,10 +366,101 @@ func (db *GormDatabase) GetGoogleUser(id string) (*models.GoogleUser, error) {
 	return dest, nil
 }
 
+// SavePost creates post with a unique slug.
 func (db *GormDatabase) SavePost(post *models.Post) error {
-	if err := db.DB.Create(post).Error; err != nil {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setSlug(tx, post); err != nil {
+			return err
+		}
+		return tx.Create(post).Error
+	})
+}
+
+// DefaultSlug is the slug of posts whose title has no letters or digits.
+const DefaultSlug = "post"
+
+// setSlug makes the slug of post, or its title if the slug is empty,
+// into a slug which no other post has or had. Taken slugs get the
+// first free suffix from -2 on.
+func setSlug(tx *gorm.DB, post *models.Post) error {
+	source := post.Slug
+	if source == "" {
+		source = post.Title
+	}
+	base := slug.Latin(source)
+	if base == "" {
+		base = DefaultSlug
+	}
+	candidate := base
+	for i := 2; ; i++ {
+		var posts, former int64
+		if err := tx.Unscoped().Model(&models.Post{}).
+			Where("slug = ? AND id <> ?", candidate, post.ID).Count(&posts).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PostSlug{}).
+			Where("slug = ? AND post_id <> ?", candidate, post.ID).Count(&former).Error; err != nil {
+			return err
+		}
+		if posts == 0 && former == 0 {
+			post.Slug = candidate
+			return nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// moveSlug keeps the old slug of post for redirects and releases its
+// new slug, in case the post had it before.
+func moveSlug(tx *gorm.DB, post *models.Post, old string) error {
+	if err := tx.Where("slug = ?", post.Slug).Delete(&models.PostSlug{}).Error; err != nil {
 		return err
 	}
+	if old == "" {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "slug"}},
+		DoUpdates: clause.AssignmentColumns([]string{"post_id"}),
+	}).Create(&models.PostSlug{Slug: old, PostID: post.ID}).Error
+}
+
+// GetPostSlug returns the post with the current or a former slug, with
+// any status. Callers redirect if the slug of the post differs.
+func (db *GormDatabase) GetPostSlug(slug string) (*models.Post, error) {
+	dest := &models.Post{}
+	err := db.DB.Preload("Tags").Preload("Category").Where("slug = ?", slug).
+		First(dest).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		if err != nil {
+			return nil, err
+		}
+		return dest, nil
+	}
+	former := &models.PostSlug{}
+	if err := db.DB.Where("slug = ?", slug).First(former).Error; err != nil {
+		return nil, err
+	}
+	return db.GetPost(strconv.Itoa(former.PostID))
+}
+
+// backfillSlugs gives slugs to posts stored before slugs were added.
+func (db *GormDatabase) backfillSlugs() error {
+	posts := make([]models.Post, 0)
+	if err := db.DB.Unscoped().Where("slug IS NULL OR slug = ''").Order("id").
+		Find(&posts).Error; err != nil {
+		return err
+	}
+	for i := range posts {
+		post := &posts[i]
+		post.Slug = ""
+		if err := setSlug(db.DB, post); err != nil {
+			return err
+		}
+		if err := db.DB.Unscoped().Model(post).UpdateColumn("slug", post.Slug).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -57,38 +471,280 @@ func (db *GormDatabase) SaveComment(comment *models.Comment) error {
 	return nil
 }
 
+// UpdateComment saves a changed comment. If the classifier learned from
+// the stored body and the body changed, it forgets the tokens of the
+// stored body, forget, and the comment is no longer trained.
+func (db *GormDatabase) UpdateComment(comment *models.Comment, forget []string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		stored := &models.Comment{}
+		if err := tx.Select("body_hash", "trained").Where("id = ?", comment.ID).
+			First(stored).Error; err != nil {
+			return err
+		}
+		comment.Trained = stored.Trained
+		if stored.Trained != "" && stored.BodyHash != comment.BodyHash {
+			if err := addSpamTokens(tx, stored.Trained, forget, -1); err != nil {
+				return err
+			}
+			comment.Trained = ""
+		}
+		return tx.Omit("Post").Save(comment).Error
+	})
+}
+
+// thread selects the ids of the comments matched by where and all their
+// replies.
+const thread = `WITH RECURSIVE thread(id) AS (
+		SELECT id FROM comments WHERE %s
+		UNION ALL
+		SELECT comments.id FROM comments JOIN thread ON comments.parent_id = thread.id
+	) `
+
+// DeleteComment moves a comment with its replies to the trash.
+func (db *GormDatabase) DeleteComment(id string) error {
+	result := db.DB.Exec(fmt.Sprintf(thread, "id = ? AND deleted_at IS NULL")+
+		`UPDATE comments SET deleted_at = ? WHERE id IN thread AND deleted_at IS NULL`,
+		id, time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (db *GormDatabase) getDeletedComment(id string) (*models.Comment, error) {
+	dest := &models.Comment{}
+	if err := db.DB.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).
+		First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// GetDeletedComments returns the comments in the trash with their
+// posts, the latest deleted first. Replies deleted with their parent
+// and comments deleted with their post are left out.
+func (db *GormDatabase) GetDeletedComments() ([]models.Comment, error) {
+	data := make([]models.Comment, 0)
+	if err := db.DB.Unscoped().Preload("Post").Select("comments.*").
+		Joins("JOIN posts ON posts.id = comments.post_id AND posts.deleted_at IS NULL").
+		Joins("LEFT JOIN comments AS parents ON parents.id = comments.parent_id").
+		Where("comments.deleted_at IS NOT NULL").
+		Where("parents.id IS NULL OR parents.deleted_at IS NULL").
+		Order("comments.deleted_at DESC").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RestoreComment takes a comment out of the trash together with the
+// replies deleted with it.
+func (db *GormDatabase) RestoreComment(id string) error {
+	comment, err := db.getDeletedComment(id)
+	if err != nil {
+		return err
+	}
+	return db.DB.Exec(fmt.Sprintf(thread, "id = ?")+
+		`UPDATE comments SET deleted_at = NULL WHERE id IN thread AND deleted_at = ?`,
+		comment.ID, comment.DeletedAt).Error
+}
+
+// PurgeComment permanently deletes a comment in the trash and all its
+// replies.
+func (db *GormDatabase) PurgeComment(id string) error {
+	comment, err := db.getDeletedComment(id)
+	if err != nil {
+		return err
+	}
+	return db.DB.Exec(fmt.Sprintf(thread, "id = ?")+
+		`DELETE FROM comments WHERE id IN thread`, comment.ID).Error
+}
+
+// GetPost returns a post with any status, callers check whether the
+// user may see it.
 func (db *GormDatabase) GetPost(key string) (*models.Post, error) {
 	dest := &models.Post{}
-	if err := db.DB.Where("ID = ?", key).First(dest).Error; err != nil {
+	if err := db.DB.Preload("Tags").Preload("Category").Where("ID = ?", key).
+		First(dest).Error; err != nil {
 		return nil, err
 	}
 	return dest, nil
 }
 
+// GetComment returns an approved comment.
 func (db *GormDatabase) GetComment(key string) (*models.Comment, error) {
 	dest := &models.Comment{}
-	if err := db.DB.Where("ID = ?", key).First(dest).Error; err != nil {
+	if err := db.DB.Where("ID = ? AND status = ?", key, models.CommentApproved).
+		First(dest).Error; err != nil {
 		return nil, err
 	}
 	return dest, nil
 }
 
+// GetPosts returns all published posts.
 func (db *GormDatabase) GetPosts() ([]models.Post, error) {
 	data := make([]models.Post, 0)
-	if err := db.DB.Find(&data).Error; err != nil {
+	if err := db.DB.Preload("Tags").Preload("Category").
+		Where("status = ?", models.PostPublished).Find(&data).Error; err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
+// GetPostsAnyStatus returns all posts, whatever their status.
+func (db *GormDatabase) GetPostsAnyStatus() ([]models.Post, error) {
+	data := make([]models.Post, 0)
+	if err := db.DB.Preload("Tags").Preload("Category").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetPostsTag returns the published posts with the tag name.
+func (db *GormDatabase) GetPostsTag(name string) ([]models.Post, error) {
+	data := make([]models.Post, 0)
+	if err := db.DB.Preload("Tags").Preload("Category").
+		Joins("JOIN post_tags ON post_tags.post_id = posts.id").
+		Joins("JOIN tags ON tags.id = post_tags.tag_id").
+		Where("tags.name = ? AND posts.status = ?", name, models.PostPublished).
+		Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetPostsCategory returns the published posts of a category and its
+// descendants.
+func (db *GormDatabase) GetPostsCategory(id int) ([]models.Post, error) {
+	ids := make([]int, 0)
+	if err := db.DB.Raw(`WITH RECURSIVE tree(id) AS (
+		SELECT id FROM categories WHERE id = ?
+		UNION
+		SELECT categories.id FROM categories JOIN tree ON categories.parent_id = tree.id
+	) SELECT id FROM tree`, id).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	data := make([]models.Post, 0)
+	if err := db.DB.Preload("Tags").Preload("Category").
+		Where("category_id IN ? AND status = ?", ids, models.PostPublished).
+		Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SetPostTags replaces the tags of post with the tags named names,
+// creating missing tags.
+func (db *GormDatabase) SetPostTags(post *models.Post, names []string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		tags := make([]models.Tag, 0, len(names))
+		for _, name := range names {
+			tag := models.Tag{Name: name}
+			if err := tx.Where(&tag).FirstOrCreate(&tag).Error; err != nil {
+				return err
+			}
+			tags = append(tags, tag)
+		}
+		if err := tx.Model(post).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+		post.Tags = tags
+		return nil
+	})
+}
+
+// GetTags returns the tags of published posts with their number of
+// posts, by name.
+func (db *GormDatabase) GetTags() ([]models.TagCount, error) {
+	data := make([]models.TagCount, 0)
+	if err := db.DB.Model(&models.Tag{}).
+		Select("tags.id, tags.name, COUNT(posts.id) AS posts").
+		Joins("JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("JOIN posts ON posts.id = post_tags.post_id").
+		Where("posts.status = ? AND posts.deleted_at IS NULL", models.PostPublished).
+		Group("tags.id").Order("tags.name").Scan(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) GetCategories() ([]models.Category, error) {
+	data := make([]models.Category, 0)
+	if err := db.DB.Order("name").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) GetCategory(slug string) (*models.Category, error) {
+	dest := &models.Category{}
+	if err := db.DB.Where("slug = ?", slug).First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (db *GormDatabase) SaveCategory(category *models.Category) error {
+	return db.DB.Create(category).Error
+}
+
+// DeleteCategory deletes a category. Its children move to its parent
+// and its posts lose their category.
+func (db *GormDatabase) DeleteCategory(id int) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		category := &models.Category{}
+		if err := tx.First(category, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).
+			Update("parent_id", category.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Post{}).Where("category_id = ?", id).
+			Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(category).Error
+	})
+}
+
+// GetPostsStatus returns the posts with status of the user, or of all
+// users if userID is 0, the latest first.
+func (db *GormDatabase) GetPostsStatus(status string, userID int) ([]models.Post, error) {
+	data := make([]models.Post, 0)
+	query := db.DB.Where("status = ?", status)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Order("id DESC").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// PublishDuePosts publishes scheduled posts whose PublishAt is not after
+// now and returns how many were published.
+func (db *GormDatabase) PublishDuePosts(now time.Time) (int64, error) {
+	result := db.DB.Model(&models.Post{}).
+		Where("status = ? AND publish_at <= ?", models.PostScheduled, now.UTC()).
+		Update("status", models.PostPublished)
+	return result.RowsAffected, result.Error
+}
+
+// GetComments returns the approved comments of published posts.
 func (db *GormDatabase) GetComments() ([]models.Comment, error) {
 	data := make([]models.Comment, 0)
-	if err := db.DB.Find(&data).Error; err != nil {
+	if err := db.DB.Joins("JOIN posts ON posts.id = comments.post_id AND posts.deleted_at IS NULL").
+		Where("comments.status = ? AND posts.status = ?", models.CommentApproved, models.PostPublished).
+		Find(&data).Error; err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
+// GetCommentsPostID returns the comments of a post with any status.
 func (db *GormDatabase) GetCommentsPostID(postid string) ([]models.Comment, error) {
 	data := make([]models.Comment, 0)
 	if err := db.DB.Where("post_id = ?", postid).Find(&data).Error; err != nil {
@@ -97,21 +753,419 @@ func (db *GormDatabase) GetCommentsPostID(postid string) ([]models.Comment, erro
 	return data, nil
 }
 
-func (db *GormDatabase) UpdatePost(post *models.Post) error {
-	return db.DB.Save(post).Error
+// GetCommentTree returns the threads of approved comments of a post, see
+// models.CommentTree. All comments are read with one query. Replies to
+// comments which are not approved become top level comments.
+func (db *GormDatabase) GetCommentTree(postid string, maxDepth int) ([]*models.CommentNode, error) {
+	data := make([]models.Comment, 0)
+	if err := db.DB.Where("post_id = ? AND status = ?", postid, models.CommentApproved).
+		Order("id").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return models.CommentTree(data, maxDepth), nil
+}
+
+// GetCommentsStatus returns comments with status and their posts, the
+// oldest first.
+func (db *GormDatabase) GetCommentsStatus(status string) ([]models.Comment, error) {
+	data := make([]models.Comment, 0)
+	if err := db.DB.Preload("Post").Where("status = ?", status).
+		Order("id").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SetCommentsStatus changes the status of comments and returns the
+// number of changed ones.
+func (db *GormDatabase) SetCommentsStatus(ids []int, status string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := db.DB.Model(&models.Comment{}).Where("id IN ?", ids).
+		Update("status", status)
+	return result.RowsAffected, result.Error
+}
+
+func (db *GormDatabase) CountApprovedCommentsUserID(userid string) (int64, error) {
+	var count int64
+	err := db.DB.Model(&models.Comment{}).
+		Where("user_id = ? AND status = ?", userid, models.CommentApproved).
+		Count(&count).Error
+	return count, err
+}
+
+// GetCommentsIDs returns comments with any status by their IDs.
+func (db *GormDatabase) GetCommentsIDs(ids []int) ([]models.Comment, error) {
+	data := make([]models.Comment, 0)
+	if len(ids) == 0 {
+		return data, nil
+	}
+	if err := db.DB.Where("id IN ?", ids).Order("id").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) countComments(since time.Time, query string, args ...interface{}) (int64, error) {
+	var count int64
+	err := db.DB.Model(&models.Comment{}).Where(query, args...).
+		Where("created_at >= ?", since).Count(&count).Error
+	return count, err
+}
+
+// CountCommentsBodyHash counts comments with the same body by the user
+// or from the address created since the given time. Empty userid and ip
+// match no comments.
+func (db *GormDatabase) CountCommentsBodyHash(hash string, userid string, ip string, since time.Time) (int64, error) {
+	var author []string
+	args := []interface{}{hash}
+	if userid != "" {
+		author = append(author, "user_id = ?")
+		args = append(args, userid)
+	}
+	if ip != "" {
+		author = append(author, "ip = ?")
+		args = append(args, ip)
+	}
+	if len(author) == 0 {
+		return 0, nil
+	}
+	return db.countComments(since, "body_hash = ? AND ("+strings.Join(author, " OR ")+")", args...)
+}
+
+func (db *GormDatabase) CountCommentsUserID(userid string, since time.Time) (int64, error) {
+	return db.countComments(since, "user_id = ?", userid)
+}
+
+func (db *GormDatabase) CountCommentsIP(ip string, since time.Time) (int64, error) {
+	return db.countComments(since, "ip = ?", ip)
+}
+
+// GetSpamTokens returns the counts of tokens known to the classifier.
+func (db *GormDatabase) GetSpamTokens(tokens []string) ([]models.SpamToken, error) {
+	data := make([]models.SpamToken, 0)
+	if len(tokens) == 0 {
+		return data, nil
+	}
+	if err := db.DB.Where("token IN ?", tokens).Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CountTrainedComments returns the number of comments the classifier
+// learned as spam and as ham.
+func (db *GormDatabase) CountTrainedComments() (spam int64, ham int64, err error) {
+	rows := make([]struct {
+		Trained string
+		Count   int64
+	}, 0)
+	if err := db.DB.Model(&models.Comment{}).Select("trained, count(*) AS count").
+		Where("trained IN ?", []string{models.ClassSpam, models.ClassHam}).
+		Group("trained").Scan(&rows).Error; err != nil {
+		return 0, 0, err
+	}
+	for _, row := range rows {
+		if row.Trained == models.ClassSpam {
+			spam = row.Count
+		} else {
+			ham = row.Count
+		}
+	}
+	return spam, ham, nil
+}
+
+// TrainComment makes the classifier learn the tokens of comment as class,
+// forgetting what it learned from the comment before. An empty class
+// only forgets.
+func (db *GormDatabase) TrainComment(comment *models.Comment, class string, tokens []string) error {
+	if comment.Trained == class {
+		return nil
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := addSpamTokens(tx, comment.Trained, tokens, -1); err != nil {
+			return err
+		}
+		if err := addSpamTokens(tx, class, tokens, 1); err != nil {
+			return err
+		}
+		return tx.Model(&models.Comment{}).Where("id = ?", comment.ID).
+			UpdateColumn("trained", class).Error
+	})
+	if err != nil {
+		return err
+	}
+	comment.Trained = class
+	return nil
+}
+
+func addSpamTokens(tx *gorm.DB, class string, tokens []string, delta int64) error {
+	if len(tokens) == 0 || (class != models.ClassSpam && class != models.ClassHam) {
+		return nil
+	}
+	column := "ham"
+	if class == models.ClassSpam {
+		column = "spam"
+	}
+	rows := make([]models.SpamToken, len(tokens))
+	for i, token := range tokens {
+		rows[i].Token = token
+		if delta > 0 && class == models.ClassSpam {
+			rows[i].Spam = delta
+		} else if delta > 0 {
+			rows[i].Ham = delta
+		}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			column: gorm.Expr(column+" + ?", delta),
+		}),
+	}).Create(&rows).Error
+}
+
+// UpdatePost saves post and records its new content as a revision by
+// editorID. The first update of a post also records the content it
+// replaces, as a revision by the author of the post.
+func (db *GormDatabase) UpdatePost(post *models.Post, editorID int) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.PostRevision{}).Where("post_id = ?", post.ID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		old := &models.Post{}
+		if err := tx.First(old, post.ID).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := tx.Create(newRevision(old, old.UserID)).Error; err != nil {
+				return err
+			}
+		}
+		if err := setSlug(tx, post); err != nil {
+			return err
+		}
+		if post.Slug != old.Slug {
+			if err := moveSlug(tx, post, old.Slug); err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(post).Error; err != nil {
+			return err
+		}
+		return tx.Create(newRevision(post, editorID)).Error
+	})
+}
+
+func newRevision(post *models.Post, userID int) *models.PostRevision {
+	revision := &models.PostRevision{
+		PostID: post.ID,
+		Title:  post.Title,
+		Body:   post.Body,
+	}
+	// imported posts have users which are not stored
+	if userID != 0 {
+		revision.UserID = &userID
+	}
+	return revision
+}
+
+// GetPostRevisions returns the revisions of a post with their users,
+// the oldest first.
+func (db *GormDatabase) GetPostRevisions(postid string) ([]models.PostRevision, error) {
+	data := make([]models.PostRevision, 0)
+	if err := db.DB.Preload("User").Where("post_id = ?", postid).Order("id").
+		Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) GetPostRevision(postid string, id string) (*models.PostRevision, error) {
+	dest := &models.PostRevision{}
+	if err := db.DB.Preload("User").Where("post_id = ? AND id = ?", postid, id).
+		First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func (db *GormDatabase) SaveAttachment(attachment *models.Attachment) error {
+	return db.DB.Create(attachment).Error
+}
+
+func (db *GormDatabase) GetAttachment(id string) (*models.Attachment, error) {
+	dest := &models.Attachment{}
+	if err := db.DB.Where("id = ?", id).First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// GetAttachmentsPostID returns the attachments of a post in the order
+// they were uploaded.
+func (db *GormDatabase) GetAttachmentsPostID(postid string) ([]models.Attachment, error) {
+	data := make([]models.Attachment, 0)
+	if err := db.DB.Where("post_id = ?", postid).Order("id").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DetachAttachments removes the attachments with ids from a post, and
+// returns how many. Their blobs are deleted with GetDetachedAttachments.
+func (db *GormDatabase) DetachAttachments(postid string, ids []int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := db.DB.Model(&models.Attachment{}).Where("post_id = ? AND id IN ?", postid, ids).
+		Update("post_id", nil)
+	return result.RowsAffected, result.Error
+}
+
+// GetDetachedAttachments returns attachments which were removed from
+// their posts or whose posts are deleted permanently.
+func (db *GormDatabase) GetDetachedAttachments() ([]models.Attachment, error) {
+	data := make([]models.Attachment, 0)
+	if err := db.DB.Where("post_id IS NULL OR post_id NOT IN (SELECT id FROM posts)").
+		Order("id").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (db *GormDatabase) DeleteAttachment(id int) error {
+	result := db.DB.Delete(&models.Attachment{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
+// DeletePost moves a post with its comments to the trash.
 func (db *GormDatabase) DeletePost(postid string) error {
-	return db.DB.Delete(&models.Post{}, postid).Error
+	now := time.Now().UTC()
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Post{}).Where("id = ?", postid).Update("deleted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.Comment{}).Where("post_id = ?", postid).
+			Update("deleted_at", now).Error
+	})
+}
+
+func (db *GormDatabase) getDeletedPost(postid string) (*models.Post, error) {
+	dest := &models.Post{}
+	if err := db.DB.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", postid).
+		First(dest).Error; err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// GetDeletedPosts returns the posts in the trash, the latest deleted
+// first.
+func (db *GormDatabase) GetDeletedPosts() ([]models.Post, error) {
+	data := make([]models.Post, 0)
+	if err := db.DB.Unscoped().Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RestorePost takes a post out of the trash together with the comments
+// deleted with it.
+func (db *GormDatabase) RestorePost(postid string) error {
+	post, err := db.getDeletedPost(postid)
+	if err != nil {
+		return err
+	}
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Comment{}).
+			Where("post_id = ? AND deleted_at = ?", post.ID, post.DeletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(post).Update("deleted_at", nil).Error
+	})
+}
+
+// PurgePost permanently deletes a post in the trash, its comments and
+// revisions.
+func (db *GormDatabase) PurgePost(postid string) error {
+	post, err := db.getDeletedPost(postid)
+	if err != nil {
+		return err
+	}
+	return db.DB.Unscoped().Delete(post).Error
+}
+
+// PurgeDeleted permanently deletes posts and comments which were moved
+// to the trash before the given time, and returns how many.
+func (db *GormDatabase) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("deleted_at < ?", before.UTC()).Delete(&models.Post{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+		result = tx.Exec(fmt.Sprintf(thread, "deleted_at < ?")+
+			`DELETE FROM comments WHERE id IN thread`, before.UTC())
+		purged += result.RowsAffected
+		return result.Error
+	})
+	return purged, err
 }
 
 func (db *GormDatabase) CreateTables() error {
-	return db.DB.AutoMigrate(
+	if err := db.DB.AutoMigrate(
 		&models.Post{},
 		&models.Comment{},
 		&models.User{},
 		&models.GoogleUser{},
-	)
+		&models.Identity{},
+		&models.Credential{},
+		&models.APIToken{},
+		&models.Session{},
+		&models.TOTP{},
+		&models.RecoveryCode{},
+		&models.SpamToken{},
+		&models.PostRevision{},
+		&models.Tag{},
+		&models.Category{},
+		&models.PostSlug{},
+		&models.Attachment{},
+	); err != nil {
+		return err
+	}
+	if err := db.backfillIdentities(); err != nil {
+		return err
+	}
+	return db.backfillSlugs()
+}
+
+// backfillIdentities copies Google users stored before identities into
+// google identities of the same users, once. Facebook logins were stored
+// in google_users too, but the table does not record the provider, so
+// they become google identities as well and Facebook users have to link
+// their account again.
+func (db *GormDatabase) backfillIdentities() error {
+	return db.DB.Exec(`INSERT INTO identities (user_id, provider, subject, email)
+		SELECT g.user_id, 'google', g.id, u.email FROM google_users g
+		JOIN users u ON u.id = g.user_id
+		WHERE NOT EXISTS (SELECT 1 FROM identities i
+			WHERE i.provider = 'google' AND i.subject = g.id)`).Error
 }
 
 func CreateGormDatabase(dsn string) (*GormDatabase, error) {
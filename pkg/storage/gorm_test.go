@@ -1,14 +1,19 @@
 package storage
 
 import (
+	"errors"
 	"log"
 	"math/rand"
 	"os"
 	"reflect"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/vestlog/nix/pkg/models"
+	"gorm.io/gorm"
 )
 
 var (
@@ -53,6 +58,7 @@ func TestGetPost(t *testing.T) {
 		ID:     17,
 		Title:  "test get post",
 		Body:   "test get post",
+		Tags:   []models.Tag{},
 	}
 	db.SavePost(post)
 	result, err := db.GetPost("17")
@@ -127,7 +133,7 @@ func TestUpdatePost(t *testing.T) {
 		Title:  "TESTNEWTITLE",
 		Body:   "TESTNEWTEXT",
 	}
-	if err := db.UpdatePost(post); err != nil {
+	if err := db.UpdatePost(post, 0); err != nil {
 		t.Error(err)
 	}
 }
@@ -151,6 +157,12 @@ func TestDeletePost(t *testing.T) {
 	if post, err := db.GetPost(strpostid); post != nil || err == nil {
 		t.Errorf("error: post still exists")
 	}
+	if err := db.PurgePost(strpostid); err != nil {
+		t.Errorf("could not purge post: %s", err)
+	}
+	if err := db.RestorePost(strpostid); err == nil {
+		t.Errorf("purged post is restored")
+	}
 }
 
 func TestDeletePostWithComments(t *testing.T) {
@@ -201,6 +213,21 @@ func TestDeletePostWithComments(t *testing.T) {
 	if comment, err := db.GetComment("2"); comment != nil || err == nil {
 		t.Errorf("comment 2 still exists")
 	}
+	if err := db.RestorePost(strpostid); err != nil {
+		t.Errorf("could not restore post: %s", err)
+	}
+	if comments, err := db.GetCommentsPostID(strpostid); err != nil || len(comments) != 2 {
+		t.Errorf("got %d comments of restored post, expected 2: %v", len(comments), err)
+	}
+	if err := db.DeletePost(strpostid); err != nil {
+		t.Errorf("could not delete post: %s", err)
+	}
+	if n, err := db.PurgeDeleted(time.Now().Add(time.Second)); err != nil || n < 1 {
+		t.Errorf("purged %d posts and comments: %v", n, err)
+	}
+	if err := db.RestorePost(strpostid); err == nil {
+		t.Errorf("purged post is restored")
+	}
 }
 
 func TestGetGoogleUserNotExist(t *testing.T) {
@@ -239,3 +266,966 @@ func TestGetGoogleUser(t *testing.T) {
 		t.Errorf("saved and received objects are not equal")
 	}
 }
+
+func TestIdentities(t *testing.T) {
+	prepare()
+	user := &models.User{
+		Email:         "linked@example.com",
+		Name:          "Linked User",
+		EmailVerified: true,
+	}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	userid := strconv.Itoa(user.ID)
+	for _, provider := range []string{"google", "facebook"} {
+		if err := db.SaveIdentity(&models.Identity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  "1234",
+		}); err != nil {
+			t.Errorf("could not save %s identity: %v", provider, err)
+		}
+	}
+	identity, err := db.GetIdentity("facebook", "1234")
+	if err != nil {
+		t.Fatalf("could not get identity: %v", err)
+	}
+	if identity.User == nil || !reflect.DeepEqual(user, identity.User) {
+		t.Errorf("expected user %v, got %v", user, identity.User)
+	}
+	if _, err := db.GetIdentity("github", "1234"); err == nil {
+		t.Errorf("identity of another provider should not exist")
+	}
+	if err := db.SaveIdentity(&models.Identity{
+		UserID:   user.ID,
+		Provider: "google",
+		Subject:  "1234",
+	}); err == nil {
+		t.Errorf("duplicate provider subject saved, expected error")
+	}
+	if found, err := db.GetUserEmail("linked@example.com"); err != nil || found.ID != user.ID {
+		t.Errorf("could not find user by email: %v, %v", found, err)
+	}
+	if err := db.DeleteIdentity(userid, "google"); err != nil {
+		t.Errorf("could not delete identity: %v", err)
+	}
+	identities, err := db.GetIdentitiesUserID(userid)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(identities) != 1 || identities[0].Provider != "facebook" {
+		t.Errorf("expected only facebook identity, got %v", identities)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	prepare()
+	user := &models.User{
+		Email: "local@example.com",
+		Name:  "Local User",
+	}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	credential := &models.Credential{
+		UserID:   user.ID,
+		Username: "localuser",
+		Hash:     "hash",
+	}
+	if err := db.SaveCredential(credential); err != nil {
+		t.Fatalf("could not save credential: %v", err)
+	}
+	other := &models.User{Name: "Other User"}
+	db.SaveUser(other)
+	if err := db.SaveCredential(&models.Credential{
+		UserID:   other.ID,
+		Username: "localuser",
+	}); err == nil {
+		t.Errorf("duplicate username saved, expected error")
+	}
+	var users int64
+	db.DB.Model(&models.User{}).Count(&users)
+	taken := &models.User{Name: "Taken Username"}
+	if err := db.CreateAccount(taken, &models.Credential{Username: "localuser"}); err == nil {
+		t.Errorf("account with a taken username created, expected error")
+	}
+	var after int64
+	db.DB.Model(&models.User{}).Count(&after)
+	if after != users {
+		t.Errorf("failed account leaves %d users behind", after-users)
+	}
+	account := &models.User{Name: "New Account"}
+	if err := db.CreateAccount(account, &models.Credential{Username: "newaccount"}); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	if saved, err := db.GetCredential("newaccount"); err != nil || saved.UserID != account.ID {
+		t.Errorf("credential of account is %v, %v, expected user %d", saved, err, account.ID)
+	}
+	credential.FailedAttempts = 3
+	if err := db.UpdateCredential(credential); err != nil {
+		t.Errorf("could not update credential: %v", err)
+	}
+	result, err := db.GetCredential("localuser")
+	if err != nil {
+		t.Fatalf("could not get credential: %v", err)
+	}
+	if result.FailedAttempts != 3 || result.Hash != "hash" {
+		t.Errorf("credential is not updated: %v", result)
+	}
+	if !reflect.DeepEqual(user, result.User) {
+		t.Errorf("expected user %v, got %v", user, result.User)
+	}
+	if _, err := db.GetCredentialUserID(strconv.Itoa(user.ID)); err != nil {
+		t.Errorf("could not get credential by user ID: %v", err)
+	}
+}
+
+func TestCountLoginAttempt(t *testing.T) {
+	prepare()
+	user := &models.User{Name: "Locked User"}
+	if err := db.CreateAccount(user, &models.Credential{Username: "lockeduser"}); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	userid := strconv.Itoa(user.ID)
+	var wg sync.WaitGroup
+	var allowed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := db.CountLoginAttempt(userid, 3, time.Hour); err == nil && ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 3 {
+		t.Errorf("%d concurrent attempts allowed, expected 3", allowed)
+	}
+	if err := db.ResetLoginAttempts(userid); err != nil {
+		t.Fatalf("could not reset login attempts: %v", err)
+	}
+	if ok, err := db.CountLoginAttempt(userid, 3, time.Hour); err != nil || !ok {
+		t.Errorf("attempt after reset is %v, %v, expected it to be allowed", ok, err)
+	}
+	credential, _ := db.GetCredential("lockeduser")
+	if credential.FailedAttempts != 1 || !credential.LockedUntil.IsZero() {
+		t.Errorf("credential after reset has %d attempts, locked until %v",
+			credential.FailedAttempts, credential.LockedUntil)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	prepare()
+	user := &models.User{Name: "Role User"}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	if err := db.SetUserRole(strconv.Itoa(user.ID), "editor"); err != nil {
+		t.Fatalf("could not set role: %v", err)
+	}
+	result, err := db.GetUser(strconv.Itoa(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Role != "editor" {
+		t.Errorf("expected role editor, got %q", result.Role)
+	}
+	users, err := db.GetUsers()
+	if err != nil {
+		t.Fatalf("could not get users: %v", err)
+	}
+	found := false
+	for _, u := range users {
+		found = found || u.ID == user.ID
+	}
+	if !found {
+		t.Errorf("user %d is not listed", user.ID)
+	}
+	if err := db.SetUserRole("100000", "editor"); err == nil {
+		t.Errorf("role of not existing user set, expected error")
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	prepare()
+	user := &models.User{Name: "Token User"}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	userid := strconv.Itoa(user.ID)
+	token := &models.APIToken{
+		UserID: user.ID,
+		Name:   "ci",
+		Scope:  "read",
+		Hash:   "tokenhash",
+	}
+	if err := db.SaveAPIToken(token); err != nil {
+		t.Fatalf("could not save token: %v", err)
+	}
+	result, err := db.GetAPIToken("tokenhash")
+	if err != nil {
+		t.Fatalf("could not get token: %v", err)
+	}
+	if result.ID != token.ID || result.User == nil || result.User.ID != user.ID {
+		t.Errorf("unexpected token %v", result)
+	}
+	used := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := db.TouchAPIToken(token.ID, used); err != nil {
+		t.Errorf("could not touch token: %v", err)
+	}
+	tokens, err := db.GetAPITokensUserID(userid)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("expected 1 token, got %v: %v", tokens, err)
+	}
+	if !tokens[0].LastUsedAt.Equal(used) {
+		t.Errorf("expected last use %v, got %v", used, tokens[0].LastUsedAt)
+	}
+	if err := db.DeleteAPIToken("100000", strconv.Itoa(token.ID)); err == nil {
+		t.Errorf("token of another user deleted, expected error")
+	}
+	if err := db.DeleteAPIToken(userid, strconv.Itoa(token.ID)); err != nil {
+		t.Errorf("could not delete token: %v", err)
+	}
+	if _, err := db.GetAPIToken("tokenhash"); err == nil {
+		t.Errorf("deleted token found")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	prepare()
+	user := &models.User{Name: "Session User"}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	userid := strconv.Itoa(user.ID)
+	session := &models.Session{
+		ID:        "session1",
+		Data:      []byte("data"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := db.SaveSession(session); err != nil {
+		t.Fatalf("could not save session: %v", err)
+	}
+	created, err := db.GetSession("session1")
+	if err != nil {
+		t.Fatalf("could not get session: %v", err)
+	}
+	session.UserID = &user.ID
+	session.Data = []byte("signed in")
+	session.ExpiresAt = time.Now().Add(2 * time.Hour)
+	if err := db.SaveSession(session); err != nil {
+		t.Fatalf("could not update session: %v", err)
+	}
+	result, err := db.GetSession("session1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Data) != "signed in" || !result.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("session is not updated in place: %v", result)
+	}
+	if !result.ExpiresAt.Equal(created.ExpiresAt) {
+		t.Errorf("expiry changed on update from %v to %v", created.ExpiresAt, result.ExpiresAt)
+	}
+	seen := time.Now().Add(time.Minute)
+	if err := db.TouchSession("session1", seen); err != nil {
+		t.Errorf("could not touch session: %v", err)
+	}
+	if result, _ := db.GetSession("session1"); !result.UpdatedAt.Equal(seen) {
+		t.Errorf("expected last activity %v, got %v", seen, result.UpdatedAt)
+	}
+	db.SaveSession(&models.Session{
+		ID:        "expired",
+		UserID:    &user.ID,
+		ExpiresAt: time.Now().Add(-time.Hour),
+	})
+	sessions, err := db.GetSessionsUserID(userid)
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("expected 1 active session, got %v: %v", sessions, err)
+	}
+	if n, err := db.DeleteExpiredSessions(time.Now(), time.Time{}); err != nil || n != 1 {
+		t.Errorf("expected 1 expired session deleted, got %d: %v", n, err)
+	}
+	if err := db.DeleteSessionUserID("100000", "session1"); err == nil {
+		t.Errorf("session of another user deleted, expected error")
+	}
+	if err := db.DeleteSessionUserID(userid, "session1"); err != nil {
+		t.Errorf("could not revoke session: %v", err)
+	}
+	if _, err := db.GetSession("session1"); err == nil {
+		t.Errorf("revoked session found")
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	prepare()
+	user := &models.User{Name: "TOTP User"}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	userid := strconv.Itoa(user.ID)
+	if err := db.SaveTOTP(&models.TOTP{UserID: user.ID, Secret: "SECRET"}); err != nil {
+		t.Fatalf("could not save TOTP: %v", err)
+	}
+	totp, err := db.GetTOTP(userid)
+	if err != nil {
+		t.Fatalf("could not get TOTP: %v", err)
+	}
+	totp.LastStep = 42
+	if err := db.SaveTOTP(totp); err != nil {
+		t.Errorf("could not update TOTP: %v", err)
+	}
+	if totp, _ := db.GetTOTP(userid); totp.LastStep != 42 {
+		t.Errorf("last step is not updated")
+	}
+	if err := db.UseTOTPStep(userid, 42); err == nil {
+		t.Errorf("time step used twice")
+	}
+	if err := db.UseTOTPStep(userid, 43); err != nil {
+		t.Errorf("could not use time step: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if ok, err := db.CountTOTPAttempt(userid, 3, time.Hour); err != nil || !ok {
+			t.Fatalf("attempt %d is %v, %v, expected it to be allowed", i, ok, err)
+		}
+	}
+	if ok, _ := db.CountTOTPAttempt(userid, 3, time.Hour); ok {
+		t.Errorf("attempt after 3 wrong codes allowed")
+	}
+	if err := db.ResetTOTPAttempts(userid); err != nil {
+		t.Errorf("could not reset attempts: %v", err)
+	}
+	if ok, _ := db.CountTOTPAttempt(userid, 3, time.Hour); !ok {
+		t.Errorf("attempt after reset not allowed")
+	}
+	codes := []models.RecoveryCode{
+		{UserID: user.ID, Hash: "code1"},
+		{UserID: user.ID, Hash: "code2"},
+	}
+	if err := db.ReplaceRecoveryCodes(userid, codes); err != nil {
+		t.Fatalf("could not save recovery codes: %v", err)
+	}
+	if err := db.UseRecoveryCode(userid, "code1"); err != nil {
+		t.Errorf("could not use recovery code: %v", err)
+	}
+	if err := db.UseRecoveryCode(userid, "code1"); err == nil {
+		t.Errorf("recovery code used twice")
+	}
+	if count, _ := db.CountRecoveryCodes(userid); count != 1 {
+		t.Errorf("expected 1 unused code, got %d", count)
+	}
+	if err := db.DeleteTOTP(userid); err != nil {
+		t.Errorf("could not delete TOTP: %v", err)
+	}
+	if _, err := db.GetTOTP(userid); err == nil {
+		t.Errorf("deleted TOTP found")
+	}
+	if count, _ := db.CountRecoveryCodes(userid); count != 0 {
+		t.Errorf("recovery codes are not deleted")
+	}
+}
+
+func TestGetCommentTree(t *testing.T) {
+	prepare()
+	post := &models.Post{Title: "Threads", Body: "Threads"}
+	if err := db.SavePost(post); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	postid := strconv.Itoa(post.ID)
+	// a <- b <- c <- d, e
+	var parent *int
+	ids := make([]int, 0)
+	for _, body := range []string{"a", "b", "c", "d"} {
+		comment := &models.Comment{PostID: post.ID, ParentID: parent, Body: body}
+		if err := db.SaveComment(comment); err != nil {
+			t.Fatalf("could not save comment: %v", err)
+		}
+		id := comment.ID
+		parent = &id
+		ids = append(ids, id)
+	}
+	if err := db.SaveComment(&models.Comment{PostID: post.ID, Body: "e"}); err != nil {
+		t.Fatalf("could not save comment: %v", err)
+	}
+	tree, err := db.GetCommentTree(postid, 0)
+	if err != nil {
+		t.Fatalf("could not get comment tree: %v", err)
+	}
+	if len(tree) != 2 || tree[0].Body != "a" || tree[1].Body != "e" {
+		t.Fatalf("unexpected top level comments %v", tree)
+	}
+	d := tree[0].Replies[0].Replies[0].Replies[0]
+	if d.Body != "d" || d.Depth != 3 || *d.ParentID != ids[2] {
+		t.Errorf("unexpected deepest reply %v", d)
+	}
+	tree, err = db.GetCommentTree(postid, 2)
+	if err != nil {
+		t.Fatalf("could not get comment tree: %v", err)
+	}
+	replies := tree[0].Replies
+	if len(replies) != 3 || replies[0].Body != "b" || replies[1].Body != "c" || replies[2].Body != "d" {
+		t.Errorf("replies are not limited to depth 2: %v", replies)
+	}
+	for _, reply := range replies {
+		if reply.Depth != 1 || len(reply.Replies) != 0 {
+			t.Errorf("unexpected reply %v", reply)
+		}
+	}
+	if tree, _ := db.GetCommentTree(postid, 1); len(tree) != 5 {
+		t.Errorf("got %d top level comments with depth 1, expected 5", len(tree))
+	}
+}
+
+func TestCommentStatus(t *testing.T) {
+	prepare()
+	user := &models.User{Name: "Commenter"}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	post := &models.Post{Title: "Moderated", Body: "Moderated"}
+	if err := db.SavePost(post); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	postid := strconv.Itoa(post.ID)
+	imported := &models.Comment{PostID: post.ID, Body: "imported"}
+	pending := &models.Comment{PostID: post.ID, UserID: &user.ID, Body: "pending", Status: models.CommentPending}
+	for _, comment := range []*models.Comment{imported, pending} {
+		if err := db.SaveComment(comment); err != nil {
+			t.Fatalf("could not save comment: %v", err)
+		}
+	}
+	if imported.Status != models.CommentApproved {
+		t.Errorf("comments are not approved by default")
+	}
+	if _, err := db.GetComment(strconv.Itoa(pending.ID)); err == nil {
+		t.Errorf("pending comment is public")
+	}
+	if tree, _ := db.GetCommentTree(postid, 0); len(tree) != 1 {
+		t.Errorf("got %d public comments, expected 1", len(tree))
+	}
+	queue, err := db.GetCommentsStatus(models.CommentPending)
+	if err != nil || len(queue) == 0 || queue[len(queue)-1].Post == nil {
+		t.Fatalf("pending comment is not queued: %v", err)
+	}
+	userid := strconv.Itoa(user.ID)
+	if count, _ := db.CountApprovedCommentsUserID(userid); count != 0 {
+		t.Errorf("got %d approved comments, expected 0", count)
+	}
+	changed, err := db.SetCommentsStatus([]int{pending.ID}, models.CommentApproved)
+	if err != nil || changed != 1 {
+		t.Errorf("could not approve comment: %v", err)
+	}
+	if count, _ := db.CountApprovedCommentsUserID(userid); count != 1 {
+		t.Errorf("got %d approved comments, expected 1", count)
+	}
+	if _, err := db.GetComment(strconv.Itoa(pending.ID)); err != nil {
+		t.Errorf("approved comment is not public: %v", err)
+	}
+}
+
+func TestCommentFilters(t *testing.T) {
+	prepare()
+	post := &models.Post{Title: "Filtered", Body: "Filtered"}
+	if err := db.SavePost(post); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	userid := 4242
+	comment := &models.Comment{
+		PostID:   post.ID,
+		UserID:   &userid,
+		IP:       "192.0.2.1",
+		BodyHash: "filteredhash",
+		Body:     "cheap pills",
+		Status:   models.CommentSpam,
+	}
+	if err := db.SaveComment(comment); err != nil {
+		t.Fatalf("could not save comment: %v", err)
+	}
+	since := time.Now().Add(-time.Minute)
+	if count, _ := db.CountCommentsBodyHash("filteredhash", "4242", "198.51.100.1", since); count != 1 {
+		t.Errorf("got %d comments of the user with the body hash, expected 1", count)
+	}
+	if count, _ := db.CountCommentsBodyHash("filteredhash", "4343", "192.0.2.1", since); count != 1 {
+		t.Errorf("got %d comments from the address with the body hash, expected 1", count)
+	}
+	if count, _ := db.CountCommentsBodyHash("filteredhash", "4343", "198.51.100.1", since); count != 0 {
+		t.Errorf("got %d comments of another user with the body hash, expected 0", count)
+	}
+	if count, _ := db.CountCommentsUserID("4242", since); count != 1 {
+		t.Errorf("got %d comments of the user, expected 1", count)
+	}
+	if count, _ := db.CountCommentsIP("192.0.2.1", time.Now().Add(time.Minute)); count != 0 {
+		t.Errorf("got %d comments of the address in the future, expected 0", count)
+	}
+	tokens := []string{"cheap", "pills"}
+	if err := db.TrainComment(comment, models.ClassSpam, tokens); err != nil {
+		t.Fatalf("could not train comment: %v", err)
+	}
+	if err := db.TrainComment(comment, models.ClassSpam, tokens); err != nil {
+		t.Fatalf("could not train comment again: %v", err)
+	}
+	if spam, ham, _ := db.CountTrainedComments(); spam != 1 || ham != 0 {
+		t.Errorf("got %d spam and %d ham comments, expected 1 and 0", spam, ham)
+	}
+	if err := db.TrainComment(comment, models.ClassHam, tokens); err != nil {
+		t.Fatalf("could not retrain comment: %v", err)
+	}
+	known, err := db.GetSpamTokens(append(tokens, "unknown"))
+	if err != nil || len(known) != 2 {
+		t.Fatalf("got %d tokens, expected 2: %v", len(known), err)
+	}
+	for _, token := range known {
+		if token.Spam != 0 || token.Ham != 1 {
+			t.Errorf("unexpected counts %+v", token)
+		}
+	}
+	stored, _ := db.GetCommentsIDs([]int{comment.ID})
+	if len(stored) != 1 || stored[0].Trained != models.ClassHam {
+		t.Errorf("trained class is not stored: %v", stored)
+	}
+	comment.Body = "nice post"
+	comment.BodyHash = "editedhash"
+	if err := db.UpdateComment(comment, tokens); err != nil {
+		t.Fatalf("could not update comment: %v", err)
+	}
+	if comment.Trained != "" {
+		t.Errorf("edited comment is still trained as %q", comment.Trained)
+	}
+	if err := db.TrainComment(comment, models.ClassSpam, []string{"nice", "post"}); err != nil {
+		t.Fatalf("could not train edited comment: %v", err)
+	}
+	known, _ = db.GetSpamTokens(tokens)
+	for _, token := range known {
+		if token.Spam != 0 || token.Ham != 0 {
+			t.Errorf("tokens of the old body are still counted: %+v", token)
+		}
+	}
+	if spam, ham, _ := db.CountTrainedComments(); spam != 1 || ham != 0 {
+		t.Errorf("got %d spam and %d ham comments, expected 1 and 0", spam, ham)
+	}
+}
+
+func TestUpdateDeleteComment(t *testing.T) {
+	prepare()
+	post := &models.Post{Title: "Edited", Body: "Edited"}
+	if err := db.SavePost(post); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	comment := &models.Comment{PostID: post.ID, Body: "first"}
+	if err := db.SaveComment(comment); err != nil {
+		t.Fatalf("could not save comment: %v", err)
+	}
+	reply := &models.Comment{PostID: post.ID, ParentID: &comment.ID, Body: "reply"}
+	if err := db.SaveComment(reply); err != nil {
+		t.Fatalf("could not save reply: %v", err)
+	}
+	id := strconv.Itoa(comment.ID)
+	edited := time.Now()
+	comment.Body = "second"
+	comment.EditedAt = &edited
+	if err := db.UpdateComment(comment, nil); err != nil {
+		t.Fatalf("could not update comment: %v", err)
+	}
+	stored, err := db.GetComment(id)
+	if err != nil || stored.Body != "second" || stored.EditedAt == nil || stored.CreatedAt.IsZero() {
+		t.Errorf("comment is not updated: %v %v", stored, err)
+	}
+	if err := db.DeleteComment(id); err != nil {
+		t.Fatalf("could not delete comment: %v", err)
+	}
+	if _, err := db.GetComment(strconv.Itoa(reply.ID)); err == nil {
+		t.Errorf("reply of deleted comment still exists")
+	}
+	if err := db.DeleteComment(id); err == nil {
+		t.Errorf("deleting a deleted comment succeeds")
+	}
+}
+
+func TestPostRevisions(t *testing.T) {
+	prepare()
+	author := &models.User{Name: "Author"}
+	editor := &models.User{Name: "Editor"}
+	for _, user := range []*models.User{author, editor} {
+		if err := db.SaveUser(user); err != nil {
+			t.Fatalf("could not save user: %v", err)
+		}
+	}
+	post := &models.Post{UserID: author.ID, Title: "v1", Body: "first"}
+	if err := db.SavePost(post); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	postid := strconv.Itoa(post.ID)
+	for _, title := range []string{"v2", "v3"} {
+		post.Title = title
+		if err := db.UpdatePost(post, editor.ID); err != nil {
+			t.Fatalf("could not update post: %v", err)
+		}
+	}
+	revisions, err := db.GetPostRevisions(postid)
+	if err != nil || len(revisions) != 3 {
+		t.Fatalf("got %d revisions, expected 3: %v", len(revisions), err)
+	}
+	for i, want := range []string{"v1", "v2", "v3"} {
+		if revisions[i].Title != want {
+			t.Errorf("revision %d has title %s, expected %s", i, revisions[i].Title, want)
+		}
+	}
+	if revisions[0].User == nil || revisions[0].User.ID != author.ID || revisions[2].User.ID != editor.ID {
+		t.Errorf("revisions have wrong users")
+	}
+	revision, err := db.GetPostRevision(postid, strconv.Itoa(revisions[1].ID))
+	if err != nil || revision.Title != "v2" {
+		t.Errorf("could not get revision: %v", err)
+	}
+	if _, err := db.GetPostRevision("0", strconv.Itoa(revisions[1].ID)); err == nil {
+		t.Errorf("revision is found for another post")
+	}
+}
+
+func TestPostStatus(t *testing.T) {
+	prepare()
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	posts := []*models.Post{
+		{UserID: 901, Title: "published", Status: models.PostPublished},
+		{UserID: 901, Title: "draft", Status: models.PostDraft},
+		{UserID: 902, Title: "draft of another user", Status: models.PostDraft},
+		{UserID: 901, Title: "due", Status: models.PostScheduled, PublishAt: &past},
+		{UserID: 901, Title: "later", Status: models.PostScheduled, PublishAt: &future},
+	}
+	for _, post := range posts {
+		if err := db.SavePost(post); err != nil {
+			t.Fatalf("could not save post: %v", err)
+		}
+	}
+	// other tests leave published posts behind
+	titles := func(posts []models.Post) []string {
+		s := make([]string, 0, len(posts))
+		for _, post := range posts {
+			if post.UserID == 901 || post.UserID == 902 {
+				s = append(s, post.Title)
+			}
+		}
+		return s
+	}
+	published, err := db.GetPosts()
+	if err != nil || !reflect.DeepEqual(titles(published), []string{"published"}) {
+		t.Errorf("got published posts %v: %v", titles(published), err)
+	}
+	drafts, err := db.GetPostsStatus(models.PostDraft, 901)
+	if err != nil || !reflect.DeepEqual(titles(drafts), []string{"draft"}) {
+		t.Errorf("got drafts %v of user: %v", titles(drafts), err)
+	}
+	drafts, err = db.GetPostsStatus(models.PostDraft, 0)
+	if err != nil || len(titles(drafts)) != 2 {
+		t.Errorf("got drafts %v of all users: %v", titles(drafts), err)
+	}
+	if n, err := db.PublishDuePosts(now); err != nil || n < 1 {
+		t.Errorf("published %d posts, expected at least 1: %v", n, err)
+	}
+	published, err = db.GetPosts()
+	if err != nil || !reflect.DeepEqual(titles(published), []string{"published", "due"}) {
+		t.Errorf("got published posts %v: %v", titles(published), err)
+	}
+}
+
+func TestCommentTrash(t *testing.T) {
+	prepare()
+	post := &models.Post{Title: "Trash"}
+	if err := db.SavePost(post); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	save := func(parent *int) *models.Comment {
+		comment := &models.Comment{PostID: post.ID, ParentID: parent, Body: "trash"}
+		if err := db.SaveComment(comment); err != nil {
+			t.Fatalf("could not save comment: %v", err)
+		}
+		return comment
+	}
+	top := save(nil)
+	reply := save(&top.ID)
+	deletedReply := save(&top.ID)
+	if err := db.DeleteComment(strconv.Itoa(deletedReply.ID)); err != nil {
+		t.Fatalf("could not delete reply: %v", err)
+	}
+	// the earlier deleted reply stays in the trash when the thread
+	// is restored
+	time.Sleep(time.Millisecond)
+	if err := db.DeleteComment(strconv.Itoa(top.ID)); err != nil {
+		t.Fatalf("could not delete comment: %v", err)
+	}
+	if err := db.DeleteComment(strconv.Itoa(top.ID)); err == nil {
+		t.Errorf("deleted comment is deleted again")
+	}
+	trash, err := db.GetDeletedComments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[int]bool{}
+	for _, comment := range trash {
+		ids[comment.ID] = true
+	}
+	if !ids[top.ID] || ids[reply.ID] || ids[deletedReply.ID] {
+		t.Errorf("trash has comments %v, expected only %d", ids, top.ID)
+	}
+	if err := db.RestoreComment(strconv.Itoa(top.ID)); err != nil {
+		t.Fatalf("could not restore comment: %v", err)
+	}
+	tree, err := db.GetCommentTree(strconv.Itoa(post.ID), 5)
+	if err != nil || len(tree) != 1 || len(tree[0].Replies) != 1 || tree[0].Replies[0].ID != reply.ID {
+		t.Errorf("restored thread is wrong: %v", err)
+	}
+	if err := db.PurgeComment(strconv.Itoa(top.ID)); err == nil {
+		t.Errorf("comment which is not in the trash is purged")
+	}
+	if err := db.DeleteComment(strconv.Itoa(top.ID)); err != nil {
+		t.Fatalf("could not delete comment: %v", err)
+	}
+	if err := db.PurgeComment(strconv.Itoa(top.ID)); err != nil {
+		t.Errorf("could not purge comment: %v", err)
+	}
+	var count int64
+	db.DB.Unscoped().Model(&models.Comment{}).Where("post_id = ?", post.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d comments are left after purge", count)
+	}
+}
+
+func TestTagsCategories(t *testing.T) {
+	prepare()
+	parent := &models.Category{Name: "Languages", Slug: "languages"}
+	if err := db.SaveCategory(parent); err != nil {
+		t.Fatalf("could not save category: %v", err)
+	}
+	child := &models.Category{Name: "Go", Slug: "go", ParentID: &parent.ID}
+	if err := db.SaveCategory(child); err != nil {
+		t.Fatalf("could not save category: %v", err)
+	}
+	posts := []*models.Post{
+		{Title: "in child", CategoryID: &child.ID},
+		{Title: "in parent", CategoryID: &parent.ID},
+		{Title: "draft in child", CategoryID: &child.ID, Status: models.PostDraft},
+	}
+	for _, post := range posts {
+		if err := db.SavePost(post); err != nil {
+			t.Fatalf("could not save post: %v", err)
+		}
+	}
+	if err := db.SetPostTags(posts[0], []string{"golang", "tips"}); err != nil {
+		t.Fatalf("could not set tags: %v", err)
+	}
+	if err := db.SetPostTags(posts[1], []string{"tips"}); err != nil {
+		t.Fatalf("could not set tags: %v", err)
+	}
+	if err := db.SetPostTags(posts[2], []string{"tips"}); err != nil {
+		t.Fatalf("could not set tags: %v", err)
+	}
+	tagged, err := db.GetPostsTag("tips")
+	if err != nil || len(tagged) != 2 {
+		t.Errorf("got %d posts tagged tips, expected 2: %v", len(tagged), err)
+	}
+	tags, err := db.GetTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int64{}
+	for _, tag := range tags {
+		counts[tag.Name] = tag.Posts
+	}
+	if counts["golang"] != 1 || counts["tips"] != 2 {
+		t.Errorf("got tag counts %v", counts)
+	}
+	if err := db.SetPostTags(posts[0], []string{"golang"}); err != nil {
+		t.Fatalf("could not set tags: %v", err)
+	}
+	post, err := db.GetPost(strconv.Itoa(posts[0].ID))
+	if err != nil || post.TagNames() != "golang" || post.Category == nil || post.Category.ID != child.ID {
+		t.Errorf("post has wrong tags %q or category: %v", post.TagNames(), err)
+	}
+	inParent, err := db.GetPostsCategory(parent.ID)
+	if err != nil || len(inParent) != 2 {
+		t.Errorf("got %d posts in parent category, expected 2: %v", len(inParent), err)
+	}
+	if err := db.DeleteCategory(parent.ID); err != nil {
+		t.Fatalf("could not delete category: %v", err)
+	}
+	moved, err := db.GetCategory("go")
+	if err != nil || moved.ParentID != nil {
+		t.Errorf("child category is not moved to the top level: %v", err)
+	}
+	post, err = db.GetPost(strconv.Itoa(posts[1].ID))
+	if err != nil || post.CategoryID != nil {
+		t.Errorf("post keeps deleted category: %v", err)
+	}
+}
+
+func TestPostSlugs(t *testing.T) {
+	prepare()
+	first := &models.Post{Title: "Slug Test: Привіт!"}
+	second := &models.Post{Title: "slug test привіт"}
+	for _, post := range []*models.Post{first, second} {
+		if err := db.SavePost(post); err != nil {
+			t.Fatalf("could not save post: %v", err)
+		}
+	}
+	if first.Slug != "slug-test-pryvit" || second.Slug != "slug-test-pryvit-2" {
+		t.Errorf("got slugs %q and %q", first.Slug, second.Slug)
+	}
+	first.Slug = "renamed-slug-test"
+	if err := db.UpdatePost(first, 0); err != nil {
+		t.Fatalf("could not update post: %v", err)
+	}
+	for _, s := range []string{"renamed-slug-test", "slug-test-pryvit"} {
+		post, err := db.GetPostSlug(s)
+		if err != nil || post.ID != first.ID || post.Slug != "renamed-slug-test" {
+			t.Errorf("slug %s does not find the post: %v", s, err)
+		}
+	}
+	// a former slug is not given to other posts
+	third := &models.Post{Title: "Slug test pryvit"}
+	if err := db.SavePost(third); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	if third.Slug != "slug-test-pryvit-3" {
+		t.Errorf("got slug %q for a former slug", third.Slug)
+	}
+	// the post gets its former slug back
+	first.Slug = "slug-test-pryvit"
+	if err := db.UpdatePost(first, 0); err != nil {
+		t.Fatalf("could not update post: %v", err)
+	}
+	if first.Slug != "slug-test-pryvit" {
+		t.Errorf("post does not get its former slug back: %q", first.Slug)
+	}
+	if post, err := db.GetPostSlug("renamed-slug-test"); err != nil || post.ID != first.ID {
+		t.Errorf("renamed slug does not find the post: %v", err)
+	}
+	if _, err := db.GetPostSlug("no-such-slug"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("got %v for an unknown slug", err)
+	}
+
+	if err := db.DB.Exec("UPDATE posts SET slug = NULL WHERE id = ?", second.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTables(); err != nil {
+		t.Fatalf("could not migrate: %v", err)
+	}
+	post, err := db.GetPost(strconv.Itoa(second.ID))
+	if err != nil || post.Slug != "slug-test-pryvit-2" {
+		t.Errorf("got slug %q after migration: %v", post.Slug, err)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	prepare()
+	post := &models.Post{Title: "Attachments"}
+	if err := db.SavePost(post); err != nil {
+		t.Fatalf("could not save post: %v", err)
+	}
+	postid := strconv.Itoa(post.ID)
+	save := func(name string) *models.Attachment {
+		attachment := &models.Attachment{PostID: &post.ID, Name: name, Key: "key-" + name}
+		if err := db.SaveAttachment(attachment); err != nil {
+			t.Fatalf("could not save attachment: %v", err)
+		}
+		return attachment
+	}
+	first := save("a.png")
+	second := save("b.pdf")
+	third := save("c.txt")
+	attachments, err := db.GetAttachmentsPostID(postid)
+	if err != nil || len(attachments) != 3 || attachments[0].ID != first.ID {
+		t.Fatalf("attachments of post are wrong: %v %v", attachments, err)
+	}
+	if n, err := db.DetachAttachments(postid, []int{second.ID}); err != nil || n != 1 {
+		t.Errorf("DetachAttachments = %d, %v, expected 1", n, err)
+	}
+	detached, err := db.GetDetachedAttachments()
+	if err != nil || len(detached) != 1 || detached[0].ID != second.ID {
+		t.Errorf("detached attachments are %v, %v, expected %d", detached, err, second.ID)
+	}
+	if err := db.DeleteAttachment(second.ID); err != nil {
+		t.Errorf("could not delete attachment: %v", err)
+	}
+	if err := db.DeleteAttachment(second.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("deleting a missing attachment: %v", err)
+	}
+	// attachments stay with posts in the trash and are detached when
+	// the post is deleted permanently
+	if err := db.DeletePost(postid); err != nil {
+		t.Fatalf("could not delete post: %v", err)
+	}
+	if detached, _ := db.GetDetachedAttachments(); len(detached) != 0 {
+		t.Errorf("attachments of a post in the trash are detached: %v", detached)
+	}
+	if err := db.PurgePost(postid); err != nil {
+		t.Fatalf("could not purge post: %v", err)
+	}
+	detached, err = db.GetDetachedAttachments()
+	if err != nil || len(detached) != 2 || detached[0].ID != first.ID || detached[1].ID != third.ID {
+		t.Errorf("detached attachments are %v, %v, expected %d and %d", detached, err, first.ID, third.ID)
+	}
+	for _, attachment := range detached {
+		db.DeleteAttachment(attachment.ID)
+	}
+}
+
+func TestBackfillIdentities(t *testing.T) {
+	prepare()
+	user := &models.User{Email: "legacy@example.com", Name: "Legacy"}
+	if err := db.SaveUser(user); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	if err := db.SaveGoogleUser(&models.GoogleUser{ID: "legacy-google-id", UserID: user.ID}); err != nil {
+		t.Fatalf("could not save google user: %v", err)
+	}
+	// the second migration must not copy the google user again
+	for i := 0; i < 2; i++ {
+		if err := db.CreateTables(); err != nil {
+			t.Fatalf("could not migrate: %v", err)
+		}
+	}
+	identity, err := db.GetIdentity("google", "legacy-google-id")
+	if err != nil {
+		t.Fatalf("google user is not copied into an identity: %v", err)
+	}
+	if identity.UserID != user.ID || identity.Email != user.Email {
+		t.Errorf("identity is %+v, expected user %d with email %s", identity, user.ID, user.Email)
+	}
+	identities, err := db.GetIdentitiesUserID(strconv.Itoa(user.ID))
+	if err != nil || len(identities) != 1 {
+		t.Errorf("user has identities %v, %v, expected one", identities, err)
+	}
+}
+
+func TestGetCommentsPublished(t *testing.T) {
+	prepare()
+	published := &models.Post{Title: "Published comments"}
+	draft := &models.Post{Title: "Draft comments", Status: models.PostDraft}
+	for _, post := range []*models.Post{published, draft} {
+		if err := db.SavePost(post); err != nil {
+			t.Fatalf("could not save post: %v", err)
+		}
+	}
+	visible := &models.Comment{PostID: published.ID, Body: "visible", Status: models.CommentApproved}
+	hidden := &models.Comment{PostID: draft.ID, Body: "hidden", Status: models.CommentApproved}
+	for _, comment := range []*models.Comment{visible, hidden} {
+		if err := db.SaveComment(comment); err != nil {
+			t.Fatalf("could not save comment: %v", err)
+		}
+	}
+	comments, err := db.GetComments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[int]bool{}
+	for _, comment := range comments {
+		ids[comment.ID] = true
+	}
+	if !ids[visible.ID] || ids[hidden.ID] {
+		t.Errorf("comments of a draft post are listed or of a published one are not: %v", ids)
+	}
+	db.DB.Unscoped().Delete(draft)
+	db.DB.Unscoped().Delete(published)
+}
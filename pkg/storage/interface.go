@@ -1,23 +1,108 @@
 package storage
 
-import "github.com/vestlog/nix/pkg/models"
+import (
+	"time"
+
+	"github.com/vestlog/nix/pkg/models"
+)
 
 type Database interface {
 	SaveUser(user *models.User) error
 	GetUser(id string) (*models.User, error)
+	GetUserEmail(email string) (*models.User, error)
+	GetUsers() ([]models.User, error)
+	SetUserRole(userid string, role string) error
+
+	SaveIdentity(identity *models.Identity) error
+	GetIdentity(provider string, subject string) (*models.Identity, error)
+	GetIdentitiesUserID(userid string) ([]models.Identity, error)
+	DeleteIdentity(userid string, provider string) error
+
+	SaveCredential(credential *models.Credential) error
+	CreateAccount(user *models.User, credential *models.Credential) error
+	GetCredential(username string) (*models.Credential, error)
+	GetCredentialUserID(userid string) (*models.Credential, error)
+	UpdateCredential(credential *models.Credential) error
+	CountLoginAttempt(userid string, max int, lockout time.Duration) (bool, error)
+	ResetLoginAttempts(userid string) error
+
+	SaveAPIToken(token *models.APIToken) error
+	GetAPIToken(hash string) (*models.APIToken, error)
+	GetAPITokensUserID(userid string) ([]models.APIToken, error)
+	TouchAPIToken(id int, usedAt time.Time) error
+	DeleteAPIToken(userid string, id string) error
+
+	SaveTOTP(totp *models.TOTP) error
+	GetTOTP(userid string) (*models.TOTP, error)
+	UseTOTPStep(userid string, step int64) error
+	CountTOTPAttempt(userid string, max int, lockout time.Duration) (bool, error)
+	ResetTOTPAttempts(userid string) error
+	DeleteTOTP(userid string) error
+	ReplaceRecoveryCodes(userid string, codes []models.RecoveryCode) error
+	UseRecoveryCode(userid string, hash string) error
+	CountRecoveryCodes(userid string) (int64, error)
+
+	SaveSession(session *models.Session) error
+	GetSession(id string) (*models.Session, error)
+	GetSessionsUserID(userid string) ([]models.Session, error)
+	TouchSession(id string, now time.Time) error
+	DeleteSession(id string) error
+	DeleteSessionUserID(userid string, id string) error
+	DeleteExpiredSessions(now time.Time, idleSince time.Time) (int64, error)
 
 	SaveGoogleUser(user *models.GoogleUser) error
 	GetGoogleUser(id string) (*models.GoogleUser, error)
 
 	GetPosts() ([]models.Post, error)
+	GetPostsAnyStatus() ([]models.Post, error)
 	GetPost(key string) (*models.Post, error)
+	GetPostSlug(slug string) (*models.Post, error)
+	GetPostsStatus(status string, userID int) ([]models.Post, error)
+	GetPostsTag(name string) ([]models.Post, error)
+	GetPostsCategory(id int) ([]models.Post, error)
+	SetPostTags(post *models.Post, names []string) error
+	GetTags() ([]models.TagCount, error)
+	GetCategories() ([]models.Category, error)
+	GetCategory(slug string) (*models.Category, error)
+	SaveCategory(category *models.Category) error
+	DeleteCategory(id int) error
+	PublishDuePosts(now time.Time) (int64, error)
 	SavePost(post *models.Post) error
-	UpdatePost(post *models.Post) error
+	UpdatePost(post *models.Post, editorID int) error
+	GetPostRevisions(postid string) ([]models.PostRevision, error)
+	GetPostRevision(postid string, id string) (*models.PostRevision, error)
+	SaveAttachment(attachment *models.Attachment) error
+	GetAttachment(id string) (*models.Attachment, error)
+	GetAttachmentsPostID(postid string) ([]models.Attachment, error)
+	DetachAttachments(postid string, ids []int) (int64, error)
+	GetDetachedAttachments() ([]models.Attachment, error)
+	DeleteAttachment(id int) error
 	DeletePost(postid string) error
+	GetDeletedPosts() ([]models.Post, error)
+	RestorePost(postid string) error
+	PurgePost(postid string) error
+	PurgeDeleted(before time.Time) (int64, error)
 
 	GetComments() ([]models.Comment, error)
 	GetComment(key string) (*models.Comment, error)
 	SaveComment(comment *models.Comment) error
+	UpdateComment(comment *models.Comment, forget []string) error
+	DeleteComment(id string) error
+	GetDeletedComments() ([]models.Comment, error)
+	RestoreComment(id string) error
+	PurgeComment(id string) error
 	GetCommentsPostID(postid string) ([]models.Comment, error)
+	GetCommentTree(postid string, maxDepth int) ([]*models.CommentNode, error)
+	GetCommentsStatus(status string) ([]models.Comment, error)
+	SetCommentsStatus(ids []int, status string) (int64, error)
+	CountApprovedCommentsUserID(userid string) (int64, error)
+	GetCommentsIDs(ids []int) ([]models.Comment, error)
+	CountCommentsBodyHash(hash string, userid string, ip string, since time.Time) (int64, error)
+	CountCommentsUserID(userid string, since time.Time) (int64, error)
+	CountCommentsIP(ip string, since time.Time) (int64, error)
+
+	GetSpamTokens(tokens []string) ([]models.SpamToken, error)
+	CountTrainedComments() (spam int64, ham int64, err error)
+	TrainComment(comment *models.Comment, class string, tokens []string) error
 	CreateTables() error
 }
@@ -8,6 +8,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/vestlog/nix/pkg/models"
 	reflect "reflect"
+	time "time"
 )
 
 // MockDatabase is a mock of Database interface
@@ -62,91 +63,891 @@ func (mr *MockDatabaseMockRecorder) GetUser(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockDatabase)(nil).GetUser), id)
 }
 
+// GetUserEmail mocks base method
+func (m *MockDatabase) GetUserEmail(email string) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserEmail", email)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserEmail indicates an expected call of GetUserEmail
+func (mr *MockDatabaseMockRecorder) GetUserEmail(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserEmail", reflect.TypeOf((*MockDatabase)(nil).GetUserEmail), email)
+}
+
+// GetUsers mocks base method
+func (m *MockDatabase) GetUsers() ([]models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsers")
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsers indicates an expected call of GetUsers
+func (mr *MockDatabaseMockRecorder) GetUsers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockDatabase)(nil).GetUsers))
+}
+
+// SetUserRole mocks base method
+func (m *MockDatabase) SetUserRole(userid, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", userid, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole
+func (mr *MockDatabaseMockRecorder) SetUserRole(userid, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockDatabase)(nil).SetUserRole), userid, role)
+}
+
+// SaveIdentity mocks base method
+func (m *MockDatabase) SaveIdentity(identity *models.Identity) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdentity", identity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdentity indicates an expected call of SaveIdentity
+func (mr *MockDatabaseMockRecorder) SaveIdentity(identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdentity", reflect.TypeOf((*MockDatabase)(nil).SaveIdentity), identity)
+}
+
+// GetIdentity mocks base method
+func (m *MockDatabase) GetIdentity(provider, subject string) (*models.Identity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdentity", provider, subject)
+	ret0, _ := ret[0].(*models.Identity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIdentity indicates an expected call of GetIdentity
+func (mr *MockDatabaseMockRecorder) GetIdentity(provider, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdentity", reflect.TypeOf((*MockDatabase)(nil).GetIdentity), provider, subject)
+}
+
+// GetIdentitiesUserID mocks base method
+func (m *MockDatabase) GetIdentitiesUserID(userid string) ([]models.Identity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdentitiesUserID", userid)
+	ret0, _ := ret[0].([]models.Identity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIdentitiesUserID indicates an expected call of GetIdentitiesUserID
+func (mr *MockDatabaseMockRecorder) GetIdentitiesUserID(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdentitiesUserID", reflect.TypeOf((*MockDatabase)(nil).GetIdentitiesUserID), userid)
+}
+
+// DeleteIdentity mocks base method
+func (m *MockDatabase) DeleteIdentity(userid, provider string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdentity", userid, provider)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdentity indicates an expected call of DeleteIdentity
+func (mr *MockDatabaseMockRecorder) DeleteIdentity(userid, provider interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdentity", reflect.TypeOf((*MockDatabase)(nil).DeleteIdentity), userid, provider)
+}
+
+// SaveCredential mocks base method
+func (m *MockDatabase) SaveCredential(credential *models.Credential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCredential", credential)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCredential indicates an expected call of SaveCredential
+func (mr *MockDatabaseMockRecorder) SaveCredential(credential interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCredential", reflect.TypeOf((*MockDatabase)(nil).SaveCredential), credential)
+}
+
+// CreateAccount mocks base method
+func (m *MockDatabase) CreateAccount(user *models.User, credential *models.Credential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAccount", user, credential)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAccount indicates an expected call of CreateAccount
+func (mr *MockDatabaseMockRecorder) CreateAccount(user, credential interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockDatabase)(nil).CreateAccount), user, credential)
+}
+
+// GetCredential mocks base method
+func (m *MockDatabase) GetCredential(username string) (*models.Credential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCredential", username)
+	ret0, _ := ret[0].(*models.Credential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCredential indicates an expected call of GetCredential
+func (mr *MockDatabaseMockRecorder) GetCredential(username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCredential", reflect.TypeOf((*MockDatabase)(nil).GetCredential), username)
+}
+
+// GetCredentialUserID mocks base method
+func (m *MockDatabase) GetCredentialUserID(userid string) (*models.Credential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCredentialUserID", userid)
+	ret0, _ := ret[0].(*models.Credential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCredentialUserID indicates an expected call of GetCredentialUserID
+func (mr *MockDatabaseMockRecorder) GetCredentialUserID(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCredentialUserID", reflect.TypeOf((*MockDatabase)(nil).GetCredentialUserID), userid)
+}
+
+// UpdateCredential mocks base method
+func (m *MockDatabase) UpdateCredential(credential *models.Credential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCredential", credential)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateCredential indicates an expected call of UpdateCredential
+func (mr *MockDatabaseMockRecorder) UpdateCredential(credential interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCredential", reflect.TypeOf((*MockDatabase)(nil).UpdateCredential), credential)
+}
+
+// CountLoginAttempt mocks base method
+func (m *MockDatabase) CountLoginAttempt(userid string, max int, lockout time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountLoginAttempt", userid, max, lockout)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountLoginAttempt indicates an expected call of CountLoginAttempt
+func (mr *MockDatabaseMockRecorder) CountLoginAttempt(userid, max, lockout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountLoginAttempt", reflect.TypeOf((*MockDatabase)(nil).CountLoginAttempt), userid, max, lockout)
+}
+
+// ResetLoginAttempts mocks base method
+func (m *MockDatabase) ResetLoginAttempts(userid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetLoginAttempts", userid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetLoginAttempts indicates an expected call of ResetLoginAttempts
+func (mr *MockDatabaseMockRecorder) ResetLoginAttempts(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLoginAttempts", reflect.TypeOf((*MockDatabase)(nil).ResetLoginAttempts), userid)
+}
+
+// SaveAPIToken mocks base method
+func (m *MockDatabase) SaveAPIToken(token *models.APIToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAPIToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAPIToken indicates an expected call of SaveAPIToken
+func (mr *MockDatabaseMockRecorder) SaveAPIToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAPIToken", reflect.TypeOf((*MockDatabase)(nil).SaveAPIToken), token)
+}
+
+// GetAPIToken mocks base method
+func (m *MockDatabase) GetAPIToken(hash string) (*models.APIToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIToken", hash)
+	ret0, _ := ret[0].(*models.APIToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIToken indicates an expected call of GetAPIToken
+func (mr *MockDatabaseMockRecorder) GetAPIToken(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIToken", reflect.TypeOf((*MockDatabase)(nil).GetAPIToken), hash)
+}
+
+// GetAPITokensUserID mocks base method
+func (m *MockDatabase) GetAPITokensUserID(userid string) ([]models.APIToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPITokensUserID", userid)
+	ret0, _ := ret[0].([]models.APIToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPITokensUserID indicates an expected call of GetAPITokensUserID
+func (mr *MockDatabaseMockRecorder) GetAPITokensUserID(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPITokensUserID", reflect.TypeOf((*MockDatabase)(nil).GetAPITokensUserID), userid)
+}
+
+// TouchAPIToken mocks base method
+func (m *MockDatabase) TouchAPIToken(id int, usedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchAPIToken", id, usedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAPIToken indicates an expected call of TouchAPIToken
+func (mr *MockDatabaseMockRecorder) TouchAPIToken(id, usedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchAPIToken", reflect.TypeOf((*MockDatabase)(nil).TouchAPIToken), id, usedAt)
+}
+
+// DeleteAPIToken mocks base method
+func (m *MockDatabase) DeleteAPIToken(userid, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAPIToken", userid, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAPIToken indicates an expected call of DeleteAPIToken
+func (mr *MockDatabaseMockRecorder) DeleteAPIToken(userid, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAPIToken", reflect.TypeOf((*MockDatabase)(nil).DeleteAPIToken), userid, id)
+}
+
+// SaveTOTP mocks base method
+func (m *MockDatabase) SaveTOTP(totp *models.TOTP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTP", totp)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTOTP indicates an expected call of SaveTOTP
+func (mr *MockDatabaseMockRecorder) SaveTOTP(totp interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTP", reflect.TypeOf((*MockDatabase)(nil).SaveTOTP), totp)
+}
+
+// GetTOTP mocks base method
+func (m *MockDatabase) GetTOTP(userid string) (*models.TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTP", userid)
+	ret0, _ := ret[0].(*models.TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTOTP indicates an expected call of GetTOTP
+func (mr *MockDatabaseMockRecorder) GetTOTP(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTP", reflect.TypeOf((*MockDatabase)(nil).GetTOTP), userid)
+}
+
+// UseTOTPStep mocks base method
+func (m *MockDatabase) UseTOTPStep(userid string, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", userid, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep
+func (mr *MockDatabaseMockRecorder) UseTOTPStep(userid, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockDatabase)(nil).UseTOTPStep), userid, step)
+}
+
+// CountTOTPAttempt mocks base method
+func (m *MockDatabase) CountTOTPAttempt(userid string, max int, lockout time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountTOTPAttempt", userid, max, lockout)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountTOTPAttempt indicates an expected call of CountTOTPAttempt
+func (mr *MockDatabaseMockRecorder) CountTOTPAttempt(userid, max, lockout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountTOTPAttempt", reflect.TypeOf((*MockDatabase)(nil).CountTOTPAttempt), userid, max, lockout)
+}
+
+// ResetTOTPAttempts mocks base method
+func (m *MockDatabase) ResetTOTPAttempts(userid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetTOTPAttempts", userid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetTOTPAttempts indicates an expected call of ResetTOTPAttempts
+func (mr *MockDatabaseMockRecorder) ResetTOTPAttempts(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetTOTPAttempts", reflect.TypeOf((*MockDatabase)(nil).ResetTOTPAttempts), userid)
+}
+
+// DeleteTOTP mocks base method
+func (m *MockDatabase) DeleteTOTP(userid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTOTP", userid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTOTP indicates an expected call of DeleteTOTP
+func (mr *MockDatabaseMockRecorder) DeleteTOTP(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTOTP", reflect.TypeOf((*MockDatabase)(nil).DeleteTOTP), userid)
+}
+
+// ReplaceRecoveryCodes mocks base method
+func (m *MockDatabase) ReplaceRecoveryCodes(userid string, codes []models.RecoveryCode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceRecoveryCodes", userid, codes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceRecoveryCodes indicates an expected call of ReplaceRecoveryCodes
+func (mr *MockDatabaseMockRecorder) ReplaceRecoveryCodes(userid, codes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceRecoveryCodes", reflect.TypeOf((*MockDatabase)(nil).ReplaceRecoveryCodes), userid, codes)
+}
+
+// UseRecoveryCode mocks base method
+func (m *MockDatabase) UseRecoveryCode(userid, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", userid, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode
+func (mr *MockDatabaseMockRecorder) UseRecoveryCode(userid, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockDatabase)(nil).UseRecoveryCode), userid, hash)
+}
+
+// CountRecoveryCodes mocks base method
+func (m *MockDatabase) CountRecoveryCodes(userid string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountRecoveryCodes", userid)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountRecoveryCodes indicates an expected call of CountRecoveryCodes
+func (mr *MockDatabaseMockRecorder) CountRecoveryCodes(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountRecoveryCodes", reflect.TypeOf((*MockDatabase)(nil).CountRecoveryCodes), userid)
+}
+
+// SaveSession mocks base method
+func (m *MockDatabase) SaveSession(session *models.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSession", session)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSession indicates an expected call of SaveSession
+func (mr *MockDatabaseMockRecorder) SaveSession(session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSession", reflect.TypeOf((*MockDatabase)(nil).SaveSession), session)
+}
+
+// GetSession mocks base method
+func (m *MockDatabase) GetSession(id string) (*models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", id)
+	ret0, _ := ret[0].(*models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession
+func (mr *MockDatabaseMockRecorder) GetSession(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockDatabase)(nil).GetSession), id)
+}
+
+// GetSessionsUserID mocks base method
+func (m *MockDatabase) GetSessionsUserID(userid string) ([]models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSessionsUserID", userid)
+	ret0, _ := ret[0].([]models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSessionsUserID indicates an expected call of GetSessionsUserID
+func (mr *MockDatabaseMockRecorder) GetSessionsUserID(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSessionsUserID", reflect.TypeOf((*MockDatabase)(nil).GetSessionsUserID), userid)
+}
+
+// TouchSession mocks base method
+func (m *MockDatabase) TouchSession(id string, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", id, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchSession indicates an expected call of TouchSession
+func (mr *MockDatabaseMockRecorder) TouchSession(id, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockDatabase)(nil).TouchSession), id, now)
+}
+
+// DeleteSession mocks base method
+func (m *MockDatabase) DeleteSession(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSession", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSession indicates an expected call of DeleteSession
+func (mr *MockDatabaseMockRecorder) DeleteSession(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockDatabase)(nil).DeleteSession), id)
+}
+
+// DeleteSessionUserID mocks base method
+func (m *MockDatabase) DeleteSessionUserID(userid, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSessionUserID", userid, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSessionUserID indicates an expected call of DeleteSessionUserID
+func (mr *MockDatabaseMockRecorder) DeleteSessionUserID(userid, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSessionUserID", reflect.TypeOf((*MockDatabase)(nil).DeleteSessionUserID), userid, id)
+}
+
+// DeleteExpiredSessions mocks base method
+func (m *MockDatabase) DeleteExpiredSessions(now, idleSince time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredSessions", now, idleSince)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpiredSessions indicates an expected call of DeleteExpiredSessions
+func (mr *MockDatabaseMockRecorder) DeleteExpiredSessions(now, idleSince interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredSessions", reflect.TypeOf((*MockDatabase)(nil).DeleteExpiredSessions), now, idleSince)
+}
+
 // SaveGoogleUser mocks base method
 func (m *MockDatabase) SaveGoogleUser(user *models.GoogleUser) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveGoogleUser", user)
+	ret := m.ctrl.Call(m, "SaveGoogleUser", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveGoogleUser indicates an expected call of SaveGoogleUser
+func (mr *MockDatabaseMockRecorder) SaveGoogleUser(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveGoogleUser", reflect.TypeOf((*MockDatabase)(nil).SaveGoogleUser), user)
+}
+
+// GetGoogleUser mocks base method
+func (m *MockDatabase) GetGoogleUser(id string) (*models.GoogleUser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGoogleUser", id)
+	ret0, _ := ret[0].(*models.GoogleUser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGoogleUser indicates an expected call of GetGoogleUser
+func (mr *MockDatabaseMockRecorder) GetGoogleUser(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoogleUser", reflect.TypeOf((*MockDatabase)(nil).GetGoogleUser), id)
+}
+
+// GetPosts mocks base method
+func (m *MockDatabase) GetPosts() ([]models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPosts")
+	ret0, _ := ret[0].([]models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPosts indicates an expected call of GetPosts
+func (mr *MockDatabaseMockRecorder) GetPosts() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPosts", reflect.TypeOf((*MockDatabase)(nil).GetPosts))
+}
+
+// GetPostsAnyStatus mocks base method
+func (m *MockDatabase) GetPostsAnyStatus() ([]models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsAnyStatus")
+	ret0, _ := ret[0].([]models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsAnyStatus indicates an expected call of GetPostsAnyStatus
+func (mr *MockDatabaseMockRecorder) GetPostsAnyStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsAnyStatus", reflect.TypeOf((*MockDatabase)(nil).GetPostsAnyStatus))
+}
+
+// GetPost mocks base method
+func (m *MockDatabase) GetPost(key string) (*models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPost", key)
+	ret0, _ := ret[0].(*models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPost indicates an expected call of GetPost
+func (mr *MockDatabaseMockRecorder) GetPost(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPost", reflect.TypeOf((*MockDatabase)(nil).GetPost), key)
+}
+
+// GetPostSlug mocks base method
+func (m *MockDatabase) GetPostSlug(slug string) (*models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostSlug", slug)
+	ret0, _ := ret[0].(*models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostSlug indicates an expected call of GetPostSlug
+func (mr *MockDatabaseMockRecorder) GetPostSlug(slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostSlug", reflect.TypeOf((*MockDatabase)(nil).GetPostSlug), slug)
+}
+
+// GetPostsStatus mocks base method
+func (m *MockDatabase) GetPostsStatus(status string, userID int) ([]models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsStatus", status, userID)
+	ret0, _ := ret[0].([]models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsStatus indicates an expected call of GetPostsStatus
+func (mr *MockDatabaseMockRecorder) GetPostsStatus(status, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsStatus", reflect.TypeOf((*MockDatabase)(nil).GetPostsStatus), status, userID)
+}
+
+// GetPostsTag mocks base method
+func (m *MockDatabase) GetPostsTag(name string) ([]models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsTag", name)
+	ret0, _ := ret[0].([]models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsTag indicates an expected call of GetPostsTag
+func (mr *MockDatabaseMockRecorder) GetPostsTag(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsTag", reflect.TypeOf((*MockDatabase)(nil).GetPostsTag), name)
+}
+
+// GetPostsCategory mocks base method
+func (m *MockDatabase) GetPostsCategory(id int) ([]models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsCategory", id)
+	ret0, _ := ret[0].([]models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsCategory indicates an expected call of GetPostsCategory
+func (mr *MockDatabaseMockRecorder) GetPostsCategory(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsCategory", reflect.TypeOf((*MockDatabase)(nil).GetPostsCategory), id)
+}
+
+// SetPostTags mocks base method
+func (m *MockDatabase) SetPostTags(post *models.Post, names []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPostTags", post, names)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPostTags indicates an expected call of SetPostTags
+func (mr *MockDatabaseMockRecorder) SetPostTags(post, names interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPostTags", reflect.TypeOf((*MockDatabase)(nil).SetPostTags), post, names)
+}
+
+// GetTags mocks base method
+func (m *MockDatabase) GetTags() ([]models.TagCount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTags")
+	ret0, _ := ret[0].([]models.TagCount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTags indicates an expected call of GetTags
+func (mr *MockDatabaseMockRecorder) GetTags() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTags", reflect.TypeOf((*MockDatabase)(nil).GetTags))
+}
+
+// GetCategories mocks base method
+func (m *MockDatabase) GetCategories() ([]models.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCategories")
+	ret0, _ := ret[0].([]models.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCategories indicates an expected call of GetCategories
+func (mr *MockDatabaseMockRecorder) GetCategories() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockDatabase)(nil).GetCategories))
+}
+
+// GetCategory mocks base method
+func (m *MockDatabase) GetCategory(slug string) (*models.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCategory", slug)
+	ret0, _ := ret[0].(*models.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCategory indicates an expected call of GetCategory
+func (mr *MockDatabaseMockRecorder) GetCategory(slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockDatabase)(nil).GetCategory), slug)
+}
+
+// SaveCategory mocks base method
+func (m *MockDatabase) SaveCategory(category *models.Category) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCategory", category)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCategory indicates an expected call of SaveCategory
+func (mr *MockDatabaseMockRecorder) SaveCategory(category interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCategory", reflect.TypeOf((*MockDatabase)(nil).SaveCategory), category)
+}
+
+// DeleteCategory mocks base method
+func (m *MockDatabase) DeleteCategory(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCategory", id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// SaveGoogleUser indicates an expected call of SaveGoogleUser
-func (mr *MockDatabaseMockRecorder) SaveGoogleUser(user interface{}) *gomock.Call {
+// DeleteCategory indicates an expected call of DeleteCategory
+func (mr *MockDatabaseMockRecorder) DeleteCategory(id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveGoogleUser", reflect.TypeOf((*MockDatabase)(nil).SaveGoogleUser), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockDatabase)(nil).DeleteCategory), id)
 }
 
-// GetGoogleUser mocks base method
-func (m *MockDatabase) GetGoogleUser(id string) (*models.GoogleUser, error) {
+// PublishDuePosts mocks base method
+func (m *MockDatabase) PublishDuePosts(now time.Time) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetGoogleUser", id)
-	ret0, _ := ret[0].(*models.GoogleUser)
+	ret := m.ctrl.Call(m, "PublishDuePosts", now)
+	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetGoogleUser indicates an expected call of GetGoogleUser
-func (mr *MockDatabaseMockRecorder) GetGoogleUser(id interface{}) *gomock.Call {
+// PublishDuePosts indicates an expected call of PublishDuePosts
+func (mr *MockDatabaseMockRecorder) PublishDuePosts(now interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoogleUser", reflect.TypeOf((*MockDatabase)(nil).GetGoogleUser), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishDuePosts", reflect.TypeOf((*MockDatabase)(nil).PublishDuePosts), now)
 }
 
-// GetPosts mocks base method
-func (m *MockDatabase) GetPosts() ([]models.Post, error) {
+// SavePost mocks base method
+func (m *MockDatabase) SavePost(post *models.Post) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPosts")
-	ret0, _ := ret[0].([]models.Post)
+	ret := m.ctrl.Call(m, "SavePost", post)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePost indicates an expected call of SavePost
+func (mr *MockDatabaseMockRecorder) SavePost(post interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePost", reflect.TypeOf((*MockDatabase)(nil).SavePost), post)
+}
+
+// UpdatePost mocks base method
+func (m *MockDatabase) UpdatePost(post *models.Post, editorID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePost", post, editorID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePost indicates an expected call of UpdatePost
+func (mr *MockDatabaseMockRecorder) UpdatePost(post, editorID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePost", reflect.TypeOf((*MockDatabase)(nil).UpdatePost), post, editorID)
+}
+
+// GetPostRevisions mocks base method
+func (m *MockDatabase) GetPostRevisions(postid string) ([]models.PostRevision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostRevisions", postid)
+	ret0, _ := ret[0].([]models.PostRevision)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetPosts indicates an expected call of GetPosts
-func (mr *MockDatabaseMockRecorder) GetPosts() *gomock.Call {
+// GetPostRevisions indicates an expected call of GetPostRevisions
+func (mr *MockDatabaseMockRecorder) GetPostRevisions(postid interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPosts", reflect.TypeOf((*MockDatabase)(nil).GetPosts))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostRevisions", reflect.TypeOf((*MockDatabase)(nil).GetPostRevisions), postid)
 }
 
-// GetPost mocks base method
-func (m *MockDatabase) GetPost(key string) (*models.Post, error) {
+// GetPostRevision mocks base method
+func (m *MockDatabase) GetPostRevision(postid, id string) (*models.PostRevision, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPost", key)
-	ret0, _ := ret[0].(*models.Post)
+	ret := m.ctrl.Call(m, "GetPostRevision", postid, id)
+	ret0, _ := ret[0].(*models.PostRevision)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetPost indicates an expected call of GetPost
-func (mr *MockDatabaseMockRecorder) GetPost(key interface{}) *gomock.Call {
+// GetPostRevision indicates an expected call of GetPostRevision
+func (mr *MockDatabaseMockRecorder) GetPostRevision(postid, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPost", reflect.TypeOf((*MockDatabase)(nil).GetPost), key)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostRevision", reflect.TypeOf((*MockDatabase)(nil).GetPostRevision), postid, id)
 }
 
-// SavePost mocks base method
-func (m *MockDatabase) SavePost(post *models.Post) error {
+// SaveAttachment mocks base method
+func (m *MockDatabase) SaveAttachment(attachment *models.Attachment) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SavePost", post)
+	ret := m.ctrl.Call(m, "SaveAttachment", attachment)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// SavePost indicates an expected call of SavePost
-func (mr *MockDatabaseMockRecorder) SavePost(post interface{}) *gomock.Call {
+// SaveAttachment indicates an expected call of SaveAttachment
+func (mr *MockDatabaseMockRecorder) SaveAttachment(attachment interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePost", reflect.TypeOf((*MockDatabase)(nil).SavePost), post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAttachment", reflect.TypeOf((*MockDatabase)(nil).SaveAttachment), attachment)
 }
 
-// UpdatePost mocks base method
-func (m *MockDatabase) UpdatePost(post *models.Post) error {
+// GetAttachment mocks base method
+func (m *MockDatabase) GetAttachment(id string) (*models.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachment", id)
+	ret0, _ := ret[0].(*models.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachment indicates an expected call of GetAttachment
+func (mr *MockDatabaseMockRecorder) GetAttachment(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachment", reflect.TypeOf((*MockDatabase)(nil).GetAttachment), id)
+}
+
+// GetAttachmentsPostID mocks base method
+func (m *MockDatabase) GetAttachmentsPostID(postid string) ([]models.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachmentsPostID", postid)
+	ret0, _ := ret[0].([]models.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachmentsPostID indicates an expected call of GetAttachmentsPostID
+func (mr *MockDatabaseMockRecorder) GetAttachmentsPostID(postid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachmentsPostID", reflect.TypeOf((*MockDatabase)(nil).GetAttachmentsPostID), postid)
+}
+
+// DetachAttachments mocks base method
+func (m *MockDatabase) DetachAttachments(postid string, ids []int) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DetachAttachments", postid, ids)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DetachAttachments indicates an expected call of DetachAttachments
+func (mr *MockDatabaseMockRecorder) DetachAttachments(postid, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetachAttachments", reflect.TypeOf((*MockDatabase)(nil).DetachAttachments), postid, ids)
+}
+
+// GetDetachedAttachments mocks base method
+func (m *MockDatabase) GetDetachedAttachments() ([]models.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDetachedAttachments")
+	ret0, _ := ret[0].([]models.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDetachedAttachments indicates an expected call of GetDetachedAttachments
+func (mr *MockDatabaseMockRecorder) GetDetachedAttachments() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDetachedAttachments", reflect.TypeOf((*MockDatabase)(nil).GetDetachedAttachments))
+}
+
+// DeleteAttachment mocks base method
+func (m *MockDatabase) DeleteAttachment(id int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdatePost", post)
+	ret := m.ctrl.Call(m, "DeleteAttachment", id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdatePost indicates an expected call of UpdatePost
-func (mr *MockDatabaseMockRecorder) UpdatePost(post interface{}) *gomock.Call {
+// DeleteAttachment indicates an expected call of DeleteAttachment
+func (mr *MockDatabaseMockRecorder) DeleteAttachment(id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePost", reflect.TypeOf((*MockDatabase)(nil).UpdatePost), post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAttachment", reflect.TypeOf((*MockDatabase)(nil).DeleteAttachment), id)
 }
 
 // DeletePost mocks base method
@@ -163,6 +964,64 @@ func (mr *MockDatabaseMockRecorder) DeletePost(postid interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockDatabase)(nil).DeletePost), postid)
 }
 
+// GetDeletedPosts mocks base method
+func (m *MockDatabase) GetDeletedPosts() ([]models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeletedPosts")
+	ret0, _ := ret[0].([]models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedPosts indicates an expected call of GetDeletedPosts
+func (mr *MockDatabaseMockRecorder) GetDeletedPosts() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedPosts", reflect.TypeOf((*MockDatabase)(nil).GetDeletedPosts))
+}
+
+// RestorePost mocks base method
+func (m *MockDatabase) RestorePost(postid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestorePost", postid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestorePost indicates an expected call of RestorePost
+func (mr *MockDatabaseMockRecorder) RestorePost(postid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestorePost", reflect.TypeOf((*MockDatabase)(nil).RestorePost), postid)
+}
+
+// PurgePost mocks base method
+func (m *MockDatabase) PurgePost(postid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgePost", postid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgePost indicates an expected call of PurgePost
+func (mr *MockDatabaseMockRecorder) PurgePost(postid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgePost", reflect.TypeOf((*MockDatabase)(nil).PurgePost), postid)
+}
+
+// PurgeDeleted mocks base method
+func (m *MockDatabase) PurgeDeleted(before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeleted", before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeleted indicates an expected call of PurgeDeleted
+func (mr *MockDatabaseMockRecorder) PurgeDeleted(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeleted", reflect.TypeOf((*MockDatabase)(nil).PurgeDeleted), before)
+}
+
 // GetComments mocks base method
 func (m *MockDatabase) GetComments() ([]models.Comment, error) {
 	m.ctrl.T.Helper()
@@ -207,6 +1066,77 @@ func (mr *MockDatabaseMockRecorder) SaveComment(comment interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveComment", reflect.TypeOf((*MockDatabase)(nil).SaveComment), comment)
 }
 
+// UpdateComment mocks base method
+func (m *MockDatabase) UpdateComment(comment *models.Comment, forget []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateComment", comment, forget)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateComment indicates an expected call of UpdateComment
+func (mr *MockDatabaseMockRecorder) UpdateComment(comment, forget interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateComment", reflect.TypeOf((*MockDatabase)(nil).UpdateComment), comment, forget)
+}
+
+// DeleteComment mocks base method
+func (m *MockDatabase) DeleteComment(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteComment", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteComment indicates an expected call of DeleteComment
+func (mr *MockDatabaseMockRecorder) DeleteComment(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockDatabase)(nil).DeleteComment), id)
+}
+
+// GetDeletedComments mocks base method
+func (m *MockDatabase) GetDeletedComments() ([]models.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeletedComments")
+	ret0, _ := ret[0].([]models.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedComments indicates an expected call of GetDeletedComments
+func (mr *MockDatabaseMockRecorder) GetDeletedComments() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedComments", reflect.TypeOf((*MockDatabase)(nil).GetDeletedComments))
+}
+
+// RestoreComment mocks base method
+func (m *MockDatabase) RestoreComment(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreComment", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreComment indicates an expected call of RestoreComment
+func (mr *MockDatabaseMockRecorder) RestoreComment(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreComment", reflect.TypeOf((*MockDatabase)(nil).RestoreComment), id)
+}
+
+// PurgeComment mocks base method
+func (m *MockDatabase) PurgeComment(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeComment", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeComment indicates an expected call of PurgeComment
+func (mr *MockDatabaseMockRecorder) PurgeComment(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeComment", reflect.TypeOf((*MockDatabase)(nil).PurgeComment), id)
+}
+
 // GetCommentsPostID mocks base method
 func (m *MockDatabase) GetCommentsPostID(postid string) ([]models.Comment, error) {
 	m.ctrl.T.Helper()
@@ -222,6 +1152,171 @@ func (mr *MockDatabaseMockRecorder) GetCommentsPostID(postid interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentsPostID", reflect.TypeOf((*MockDatabase)(nil).GetCommentsPostID), postid)
 }
 
+// GetCommentTree mocks base method
+func (m *MockDatabase) GetCommentTree(postid string, maxDepth int) ([]*models.CommentNode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentTree", postid, maxDepth)
+	ret0, _ := ret[0].([]*models.CommentNode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentTree indicates an expected call of GetCommentTree
+func (mr *MockDatabaseMockRecorder) GetCommentTree(postid, maxDepth interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentTree", reflect.TypeOf((*MockDatabase)(nil).GetCommentTree), postid, maxDepth)
+}
+
+// GetCommentsStatus mocks base method
+func (m *MockDatabase) GetCommentsStatus(status string) ([]models.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentsStatus", status)
+	ret0, _ := ret[0].([]models.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentsStatus indicates an expected call of GetCommentsStatus
+func (mr *MockDatabaseMockRecorder) GetCommentsStatus(status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentsStatus", reflect.TypeOf((*MockDatabase)(nil).GetCommentsStatus), status)
+}
+
+// SetCommentsStatus mocks base method
+func (m *MockDatabase) SetCommentsStatus(ids []int, status string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCommentsStatus", ids, status)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetCommentsStatus indicates an expected call of SetCommentsStatus
+func (mr *MockDatabaseMockRecorder) SetCommentsStatus(ids, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCommentsStatus", reflect.TypeOf((*MockDatabase)(nil).SetCommentsStatus), ids, status)
+}
+
+// CountApprovedCommentsUserID mocks base method
+func (m *MockDatabase) CountApprovedCommentsUserID(userid string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountApprovedCommentsUserID", userid)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountApprovedCommentsUserID indicates an expected call of CountApprovedCommentsUserID
+func (mr *MockDatabaseMockRecorder) CountApprovedCommentsUserID(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountApprovedCommentsUserID", reflect.TypeOf((*MockDatabase)(nil).CountApprovedCommentsUserID), userid)
+}
+
+// GetCommentsIDs mocks base method
+func (m *MockDatabase) GetCommentsIDs(ids []int) ([]models.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentsIDs", ids)
+	ret0, _ := ret[0].([]models.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentsIDs indicates an expected call of GetCommentsIDs
+func (mr *MockDatabaseMockRecorder) GetCommentsIDs(ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentsIDs", reflect.TypeOf((*MockDatabase)(nil).GetCommentsIDs), ids)
+}
+
+// CountCommentsBodyHash mocks base method
+func (m *MockDatabase) CountCommentsBodyHash(hash, userid, ip string, since time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountCommentsBodyHash", hash, userid, ip, since)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountCommentsBodyHash indicates an expected call of CountCommentsBodyHash
+func (mr *MockDatabaseMockRecorder) CountCommentsBodyHash(hash, userid, ip, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCommentsBodyHash", reflect.TypeOf((*MockDatabase)(nil).CountCommentsBodyHash), hash, userid, ip, since)
+}
+
+// CountCommentsUserID mocks base method
+func (m *MockDatabase) CountCommentsUserID(userid string, since time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountCommentsUserID", userid, since)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountCommentsUserID indicates an expected call of CountCommentsUserID
+func (mr *MockDatabaseMockRecorder) CountCommentsUserID(userid, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCommentsUserID", reflect.TypeOf((*MockDatabase)(nil).CountCommentsUserID), userid, since)
+}
+
+// CountCommentsIP mocks base method
+func (m *MockDatabase) CountCommentsIP(ip string, since time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountCommentsIP", ip, since)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountCommentsIP indicates an expected call of CountCommentsIP
+func (mr *MockDatabaseMockRecorder) CountCommentsIP(ip, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCommentsIP", reflect.TypeOf((*MockDatabase)(nil).CountCommentsIP), ip, since)
+}
+
+// GetSpamTokens mocks base method
+func (m *MockDatabase) GetSpamTokens(tokens []string) ([]models.SpamToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSpamTokens", tokens)
+	ret0, _ := ret[0].([]models.SpamToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSpamTokens indicates an expected call of GetSpamTokens
+func (mr *MockDatabaseMockRecorder) GetSpamTokens(tokens interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSpamTokens", reflect.TypeOf((*MockDatabase)(nil).GetSpamTokens), tokens)
+}
+
+// CountTrainedComments mocks base method
+func (m *MockDatabase) CountTrainedComments() (int64, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountTrainedComments")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CountTrainedComments indicates an expected call of CountTrainedComments
+func (mr *MockDatabaseMockRecorder) CountTrainedComments() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountTrainedComments", reflect.TypeOf((*MockDatabase)(nil).CountTrainedComments))
+}
+
+// TrainComment mocks base method
+func (m *MockDatabase) TrainComment(comment *models.Comment, class string, tokens []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrainComment", comment, class, tokens)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrainComment indicates an expected call of TrainComment
+func (mr *MockDatabaseMockRecorder) TrainComment(comment, class, tokens interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrainComment", reflect.TypeOf((*MockDatabase)(nil).TrainComment), comment, class, tokens)
+}
+
 // CreateTables mocks base method
 func (m *MockDatabase) CreateTables() error {
 	m.ctrl.T.Helper()
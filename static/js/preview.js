@@ -0,0 +1,24 @@
+// Renders the Markdown of a textarea on the server when its preview tab is shown.
+document.querySelectorAll('[data-preview]').forEach(function (tab) {
+    tab.addEventListener('show.bs.tab', function () {
+        var form = tab.closest('form');
+        var source = document.getElementById(tab.dataset.preview);
+        var target = document.querySelector(tab.dataset.bsTarget);
+        var body = new URLSearchParams();
+        body.set('body', source.value);
+        fetch('/admin/preview', {
+            method: 'POST',
+            headers: { 'X-CSRF-Token': form.elements['csrf_token'].value },
+            body: body,
+        }).then(function (response) {
+            if (!response.ok) {
+                throw new Error(response.statusText);
+            }
+            return response.text();
+        }).then(function (html) {
+            target.innerHTML = html;
+        }).catch(function (err) {
+            target.textContent = 'Preview failed: ' + err.message;
+        });
+    });
+});